@@ -0,0 +1,305 @@
+package blogger
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/api/blogger/v3"
+	"tiddlywiki-converter/tiddlywiki"
+)
+
+// --- ИМПОРТ ЭКСПОРТА BLOGGER (Google Takeout, feed.atom) ---
+//
+// Встречаются два формата:
+//   - старый (Настройки -> Резервное копирование до 2021 г.): тип записи задан
+//     <category scheme="...#kind" term="...kind#post">, черновики - <app:control><app:draft>,
+//     комментарий ссылается на пост через <thr:in-reply-to ref="...">, а на родительский
+//     комментарий - через <link rel="related">;
+//   - новый (Takeout): <blogger:type>POST|COMMENT|PAGE</blogger:type>,
+//     <blogger:status>, <blogger:parent> и <blogger:inReplyTo>.
+// Элементы описаны только локальными именами, поэтому одна модель читает оба формата.
+
+type atomFeed struct {
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+	Href string `xml:"href,attr"`
+}
+
+type atomCategory struct {
+	Scheme string `xml:"scheme,attr"`
+	Term   string `xml:"term,attr"`
+}
+
+type atomAuthor struct {
+	Name  string `xml:"name"`
+	URI   string `xml:"uri"`
+	Image struct {
+		Src string `xml:"src,attr"`
+	} `xml:"image"` // gd:image в старом формате
+}
+
+type atomInReplyTo struct {
+	Ref  string `xml:"ref,attr"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Created    string         `xml:"created"`
+	Title      string         `xml:"title"`
+	Content    string         `xml:"content"`
+	Categories []atomCategory `xml:"category"`
+	Links      []atomLink     `xml:"link"`
+	Author     atomAuthor     `xml:"author"`
+
+	// Старый формат.
+	ThrInReplyTo *atomInReplyTo `xml:"in-reply-to"`
+	Draft        string         `xml:"control>draft"`
+
+	// Новый формат.
+	Type      string `xml:"type"`
+	Status    string `xml:"status"`
+	Parent    string `xml:"parent"`
+	InReplyTo string `xml:"inReplyTo"`
+	Filename  string `xml:"filename"`
+}
+
+const kindScheme = "http://schemas.google.com/g/2005#kind"
+
+// kind возвращает тип записи в нижнем регистре: post, comment, page, settings, template.
+func (e *atomEntry) kind() string {
+	if e.Type != "" {
+		return strings.ToLower(e.Type)
+	}
+	for _, c := range e.Categories {
+		if c.Scheme == kindScheme {
+			if i := strings.LastIndex(c.Term, "#"); i != -1 {
+				return c.Term[i+1:]
+			}
+		}
+	}
+	return ""
+}
+
+// status приводит статус к значениям API: LIVE, DRAFT, SOFT_TRASHED ...
+func (e *atomEntry) status() string {
+	if e.Status != "" {
+		return strings.ToUpper(e.Status)
+	}
+	if strings.EqualFold(e.Draft, "yes") {
+		return "DRAFT"
+	}
+	return "LIVE"
+}
+
+func (e *atomEntry) labels() []string {
+	var labels []string
+	for _, c := range e.Categories {
+		if c.Scheme != kindScheme && c.Term != "" {
+			labels = append(labels, c.Term)
+		}
+	}
+	return labels
+}
+
+func (e *atomEntry) link(rel string) string {
+	for _, l := range e.Links {
+		if l.Rel == rel && (l.Type == "" || l.Type == "text/html" || rel != "alternate") {
+			return l.Href
+		}
+	}
+	return ""
+}
+
+// entryURL - адрес записи в блоге. В новом формате ссылки нет, есть только путь.
+func (e *atomEntry) entryURL(blogURL string) string {
+	if u := e.link("alternate"); u != "" {
+		return u
+	}
+	if e.Filename != "" && blogURL != "" {
+		return strings.TrimSuffix(blogURL, "/") + e.Filename
+	}
+	return ""
+}
+
+func (e *atomEntry) published() string {
+	if e.Published != "" {
+		return e.Published
+	}
+	return e.Created
+}
+
+// entryIDPattern выделяет числовой ID из "tag:blogger.com,1999:blog-123.post-456".
+var entryIDPattern = regexp.MustCompile(`(?:post|page|comment)-(\d+)$`)
+
+func idFromTag(tag string) string {
+	tag = strings.TrimSpace(tag)
+	if m := entryIDPattern.FindStringSubmatch(tag); m != nil {
+		return m[1]
+	}
+	return tag
+}
+
+// relatedComment извлекает ID родительского комментария из ссылки rel="related"
+// старого формата: .../feeds/<blog>/<post>/comments/default/<id>.
+func (e *atomEntry) relatedComment() string {
+	related := e.link("related")
+	if i := strings.LastIndex(related, "/comments/default/"); i != -1 {
+		return related[i+len("/comments/default/"):]
+	}
+	return ""
+}
+
+// ConvertFromAtomFile импортирует экспорт блога без обращения к API: ключ
+// не нужен, а в архив попадают черновики и страницы. blogURL используется,
+// если в файле нет ссылки на блог (новый формат Takeout). Из opts
+// учитывается только CommentHTML.
+func ConvertFromAtomFile(atomPath, blogURL string, opts Options) ([]*tiddlywiki.Tiddler, error) {
+	f, err := os.Open(atomPath)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия файла %s: %w", atomPath, err)
+	}
+	defer f.Close()
+
+	var feed atomFeed
+	if err := xml.NewDecoder(f).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("ошибка парсинга Atom: %w", err)
+	}
+	if blogURL == "" {
+		for _, l := range feed.Links {
+			if l.Rel == "alternate" {
+				blogURL = l.Href
+				break
+			}
+		}
+	}
+
+	content := contentFromAtom(&feed, blogURL)
+	log.Printf("Экспорт Blogger: постов %d, страниц %d, комментариев %d.",
+		len(content.Posts), len(content.Pages), countComments(content.Comments))
+	return buildTiddlers(content, opts.CommentHTML), nil
+}
+
+// contentFromAtom раскладывает записи ленты по типам API Blogger, чтобы
+// дальше работал тот же построитель тиддлеров, что и для импорта через API.
+func contentFromAtom(feed *atomFeed, blogURL string) *blogContent {
+	content := &blogContent{
+		Title:    feed.Title,
+		URL:      blogURL,
+		Comments: make(map[string][]*blogger.Comment),
+	}
+	skipped := make(map[string]int)
+
+	for i := range feed.Entries {
+		e := &feed.Entries[i]
+		status := e.status()
+		if status == "SOFT_TRASHED" || status == "DELETED" {
+			skipped[e.kind()+" "+strings.ToLower(status)]++
+			continue
+		}
+		switch e.kind() {
+		case "post":
+			content.Posts = append(content.Posts, &blogger.Post{
+				Id:        idFromTag(e.ID),
+				Title:     e.Title,
+				Content:   e.Content,
+				Published: e.published(),
+				Updated:   e.Updated,
+				Url:       e.entryURL(blogURL),
+				Labels:    e.labels(),
+				Status:    status,
+				Author: &blogger.PostAuthor{
+					DisplayName: e.Author.Name,
+					Url:         e.Author.URI,
+					Image:       &blogger.PostAuthorImage{Url: e.Author.Image.Src},
+				},
+			})
+		case "page":
+			page := &blogger.Page{
+				Id:        idFromTag(e.ID),
+				Title:     e.Title,
+				Content:   e.Content,
+				Published: e.published(),
+				Updated:   e.Updated,
+				Url:       e.entryURL(blogURL),
+				Status:    status,
+			}
+			if e.Author.Name != "" {
+				page.Author = &blogger.PageAuthor{
+					DisplayName: e.Author.Name,
+					Url:         e.Author.URI,
+					Image:       &blogger.PageAuthorImage{Url: e.Author.Image.Src},
+				}
+			}
+			content.Pages = append(content.Pages, page)
+		case "comment":
+			postID := idFromTag(e.Parent)
+			if e.ThrInReplyTo != nil {
+				postID = idFromTag(e.ThrInReplyTo.Ref)
+			}
+			if postID == "" {
+				skipped["комментарий без поста"]++
+				continue
+			}
+			comment := &blogger.Comment{
+				Id:        idFromTag(e.ID),
+				Content:   e.Content,
+				Published: e.published(),
+				Updated:   e.Updated,
+				Status:    status,
+				Post:      &blogger.CommentPost{Id: postID},
+				Author:    &blogger.CommentAuthor{DisplayName: e.Author.Name, Url: e.Author.URI},
+			}
+			parentID := idFromTag(e.InReplyTo)
+			if parentID == "" {
+				parentID = e.relatedComment()
+			}
+			if parentID != "" {
+				comment.InReplyTo = &blogger.CommentInReplyTo{Id: parentID}
+			}
+			content.Comments[postID] = append(content.Comments[postID], comment)
+		default:
+			// settings и template не содержат контента.
+		}
+	}
+
+	// Старый экспорт перечисляет записи от новых к старым; комментарии
+	// выстраиваем по времени, чтобы обсуждение читалось по порядку.
+	for _, comments := range content.Comments {
+		sort.SliceStable(comments, func(i, j int) bool {
+			return parseTime(comments[i].Published).Before(parseTime(comments[j].Published))
+		})
+	}
+	for reason, n := range skipped {
+		log.Printf("   пропущено (%s): %d", reason, n)
+	}
+	return content
+}
+
+func parseTime(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339, s)
+	return t
+}
+
+func countComments(comments map[string][]*blogger.Comment) int {
+	n := 0
+	for _, list := range comments {
+		n += len(list)
+	}
+	return n
+}
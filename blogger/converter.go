@@ -12,6 +12,7 @@ import (
 	"google.golang.org/api/blogger/v3"
 	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
+	"tiddlywiki-converter/tags"
 	"tiddlywiki-converter/tiddlywiki"
 )
 
@@ -45,135 +46,337 @@ func getBlogIDByURL(service *blogger.Service, blogURL string) (string, error) {
 	return blog.Id, nil
 }
 
-// convertBlogContent выполняет основную работу по конвертации постов и комментариев.
-// Она принимает уже созданный сервис и ID блога.
-// Файл: tiddlywiki-converter/blogger/converter.go
-
-// convertBlogContent выполняет основную работу по конвертации постов и комментариев.
-// Она принимает уже созданный сервис и ID блога.
-func convertBlogContent(service *blogger.Service, blogID string) ([]*tiddlywiki.Tiddler, error) {
-	var allTiddlers []*tiddlywiki.Tiddler
+// blogContent - все, из чего строятся тиддлеры блога, независимо от источника:
+// API Blogger или файл экспорта Takeout.
+type blogContent struct {
+	Title    string
+	URL      string
+	Posts    []*blogger.Post
+	Pages    []*blogger.Page
+	Comments map[string][]*blogger.Comment // ID поста -> комментарии
+}
 
-	// --- НАЧАЛО ИЗМЕНЕНИЙ (БЛОК 1) ---
+// convertBlogContent загружает посты, страницы и комментарии через API
+// и передает их в общий построитель тиддлеров. При входе через OAuth
+// запрашиваются также черновики и запланированные посты.
+func convertBlogContent(service *blogger.Service, blogID string, opts Options) ([]*tiddlywiki.Tiddler, error) {
 	log.Println("Шаг 0: Загрузка информации о блоге...")
 	blogInfo, err := service.Blogs.Get(blogID).Do()
 	if err != nil {
 		return nil, fmt.Errorf("не удалось получить информацию о блоге с ID '%s': %w", blogID, err)
 	}
-	blogURL := blogInfo.Url
-	log.Printf("URL блога для субтитула: %s", blogURL)
-	// --- КОНЕЦ ИЗМЕНЕНИЙ (БЛОК 1) ---
+	log.Printf("URL блога для субтитула: %s", blogInfo.Url)
 
 	log.Println("Шаг 1: Загрузка всех постов...")
-	posts, err := fetchAllPosts(service, blogID)
+	posts, err := fetchAllPosts(service, blogID, opts.OAuth())
 	if err != nil {
 		return nil, err
 	}
 	log.Printf("Загружено %d постов.", len(posts))
 
-	log.Println("Шаг 2: Обработка постов и загрузка комментариев...")
-	for i, post := range posts {
-		// --- ОБРАБОТКА ПОСТА ---
-		cleanTitle := html.UnescapeString(post.Title)
-		cleanContent := post.Content // Контент поста берем "КАК ЕСТЬ"
-		authorName := html.UnescapeString(post.Author.DisplayName)
-		
-		// --- НАЧАЛО ИЗМЕНЕНИЙ (БЛОК 2) ---
-		// Скрипт для автоматического отображения комментариев
-		commentScript := `
-<br>
----
-<h3>Комментарии:</h3>
-<$list filter="[tag[comment]parent-post{!!post-slug}]" emptyMessage="Комментариев нет.">
-<div style="border-left: 3px solid #ccc; padding-left: 15px; margin-top: 15px; margin-bottom: 15px;">
-<$transclude tiddler=<<currentTiddler>> mode="block"/>
-</div>
-</$list>`
-		
-		cleanContent += fmt.Sprintf("\n\n<p>''Автор: %s''</p>", authorName)
-		cleanContent += commentScript // Добавляем скрипт в конец поста
-		
-		created, _ := time.Parse(time.RFC3339, post.Published)
-		tiddlyTime := created.UTC().Format(tiddlywiki.TiddlyTimeFormat)
+	// Страницы - дополнение к постам: без них импорт все равно полезен.
+	pages, err := fetchAllPages(service, blogID, opts.OAuth())
+	if err != nil {
+		log.Printf("Предупреждение: %v", err)
+	}
+	log.Printf("Загружено %d страниц.", len(pages))
 
-		postTiddler := tiddlywiki.NewTiddler(cleanTitle, cleanContent, strings.Join(post.Labels, " "))
-		postTiddler.Created = tiddlyTime
-		postTiddler.Modified = tiddlyTime
-		postTiddler.Fields["post-slug"] = post.Id
-		postTiddler.Fields["source-url"] = post.Url // Добавляем URL на оригинальный пост
-		allTiddlers = append(allTiddlers, postTiddler)
-		// --- КОНЕЦ ИЗМЕНЕНИЙ (БЛОК 2) ---
-		
-		// --- ОБРАБОТКА КОММЕНТАРИЕВ ---
-		log.Printf("Запрос комментариев для поста %d/%d: %s", i+1, len(posts), cleanTitle)
+	log.Println("Шаг 2: Загрузка комментариев...")
+	content := &blogContent{
+		Title:    blogInfo.Name,
+		URL:      blogInfo.Url,
+		Posts:    posts,
+		Pages:    pages,
+		Comments: make(map[string][]*blogger.Comment),
+	}
+	for i, post := range posts {
+		if post.Status != "" && post.Status != "LIVE" {
+			continue // у неопубликованных постов комментариев нет
+		}
+		log.Printf("Запрос комментариев для поста %d/%d: %s", i+1, len(posts), html.UnescapeString(post.Title))
 		comments, err := fetchAllComments(service, blogID, post.Id)
 		if err != nil {
 			log.Printf(" -> Не удалось получить комментарии: %v", err)
-			time.Sleep(1 * time.Second)
-			continue
-		}
-		
-		if len(comments) > 0 {
+		} else if len(comments) > 0 {
 			log.Printf(" -> Найдено %d комментариев.", len(comments))
+			content.Comments[post.Id] = comments
+		}
+		time.Sleep(1 * time.Second)
+	}
+
+	log.Println("Шаг 3: Создание тиддлеров...")
+	return buildTiddlers(content, opts.CommentHTML), nil
+}
+
+// buildTiddlers создает тиддлеры постов, страниц, комментариев и системные тиддлеры.
+func buildTiddlers(content *blogContent, commentHTML bool) []*tiddlywiki.Tiddler {
+	var allTiddlers []*tiddlywiki.Tiddler
+	authors := &authorSet{seen: make(map[string]bool)}
+	for _, post := range content.Posts {
+		postTiddler := newPostTiddler(post)
+		allTiddlers = append(allTiddlers, postTiddler)
+		allTiddlers = append(allTiddlers, commentTiddlers(post, postTiddler.Title, content.Comments[post.Id], commentHTML)...)
+		if post.Author != nil {
+			authors.add(post.Author.Id, post.Author.DisplayName, post.Author.Url, postAuthorImage(post.Author))
 		}
+	}
+	for _, page := range content.Pages {
+		allTiddlers = append(allTiddlers, newPageTiddler(page))
+		if page.Author != nil {
+			authors.add(page.Author.Id, page.Author.DisplayName, page.Author.Url, pageAuthorImage(page.Author))
+		}
+	}
+	allTiddlers = append(allTiddlers, authors.tiddlers...)
+
+	siteTitle := html.UnescapeString(content.Title)
+	if siteTitle == "" {
+		siteTitle = "Blogger"
+	}
+	allTiddlers = append(allTiddlers,
+		tiddlywiki.NewTiddler("$:/SiteTitle", siteTitle, ""),
+		tiddlywiki.NewTiddler("$:/SiteSubtitle", content.URL, ""))
+	return allTiddlers
+}
 
-		commentCounter := 0
-		for _, comment := range comments {
-			commentCounter++ 
+// authorSet собирает тиддлеры авторов постов и страниц в порядке появления.
+type authorSet struct {
+	seen     map[string]bool
+	tiddlers []*tiddlywiki.Tiddler
+}
+
+func (a *authorSet) add(id, displayName, profileURL, imageURL string) {
+	name := html.UnescapeString(displayName)
+	if name == "" || a.seen[name] {
+		return
+	}
+	a.seen[name] = true
+
+	var b strings.Builder
+	if imageURL != "" {
+		b.WriteString(fmt.Sprintf("[img width=64 [%s]]\n\n", imageURL))
+	}
+	if profileURL != "" {
+		b.WriteString(fmt.Sprintf("''Профиль:'' [[%s|%s]]\n\n", profileURL, profileURL))
+	}
+	b.WriteString(fmt.Sprintf("<<list-links filter:\"[field:%s[%s]field:%s<currentTiddler>]\">>",
+		tiddlywiki.FieldImportType, tiddlywiki.ImportTypePost, tiddlywiki.FieldAuthor))
+
+	authorTiddler := tiddlywiki.NewTiddler(name, b.String(), "author")
+	authorTiddler.Fields[tiddlywiki.FieldImportType] = tiddlywiki.ImportTypeAuthor
+	if id != "" {
+		authorTiddler.Fields["blogger-author-id"] = id
+	}
+	if profileURL != "" {
+		authorTiddler.Fields["author-url"] = profileURL
+	}
+	if imageURL != "" {
+		authorTiddler.Fields["author-image"] = imageURL
+	}
+	a.tiddlers = append(a.tiddlers, authorTiddler)
+}
+
+// Адрес аватара приходит без схемы: //blogger.googleusercontent.com/...
+func avatarURL(u string) string {
+	if strings.HasPrefix(u, "//") {
+		return "https:" + u
+	}
+	return u
+}
 
-			decodedText := html.UnescapeString(comment.Content)
-			// --- ИЗМЕНЕНИЕ: Улучшенная очистка + ссылка на источник для комментариев ---
-			cleanCommentText := stripHTML(decodedText)
-			cleanCommentText += fmt.Sprintf("\n\n''Источник: [[%s]]''", cleanTitle)
+func postAuthorImage(author *blogger.PostAuthor) string {
+	if author.Image == nil {
+		return ""
+	}
+	return avatarURL(author.Image.Url)
+}
 
+func pageAuthorImage(author *blogger.PageAuthor) string {
+	if author.Image == nil {
+		return ""
+	}
+	return avatarURL(author.Image.Url)
+}
+
+func newPostTiddler(post *blogger.Post) *tiddlywiki.Tiddler {
+	cleanTitle := html.UnescapeString(post.Title)
+	cleanContent := post.Content // Контент поста берем "КАК ЕСТЬ"
+	authorName := ""
+	if post.Author != nil {
+		authorName = html.UnescapeString(post.Author.DisplayName)
+	}
 
-			commentAuthor := html.UnescapeString(comment.Author.DisplayName)
-			
-			commentTitle := fmt.Sprintf("Комментарий %d от %s к посту «%s»", commentCounter, commentAuthor, cleanTitle)
+	// Комментарии отображает шаблон $:/converter/templates/comment-thread
+	// по полям parent/thread-root, поэтому в текст поста ничего не добавляем.
+	cleanContent += fmt.Sprintf("\n\n<p>''Автор: %s''</p>", authorName)
 
-			commentCreated, _ := time.Parse(time.RFC3339, comment.Published)
-			commentTiddlyTime := commentCreated.UTC().Format(tiddlywiki.TiddlyTimeFormat)
+	created, _ := time.Parse(time.RFC3339, post.Published)
+	tiddlyTime := created.UTC().Format(tiddlywiki.TiddlyTimeFormat)
 
-			commentTiddler := tiddlywiki.NewTiddler(
-				commentTitle,
-				cleanCommentText,
-				"comment",
-			)
-			commentTiddler.Created = commentTiddlyTime
-			commentTiddler.Modified = commentTiddlyTime
-			commentTiddler.Fields["parent-post"] = post.Id
-			allTiddlers = append(allTiddlers, commentTiddler)
+	labels := tags.NormalizeList(post.Labels)
+	if post.Status != "" && post.Status != "LIVE" {
+		labels = append(labels, strings.ToLower(post.Status)) // draft или scheduled
+	}
+	postTiddler := tiddlywiki.NewTiddler(cleanTitle, cleanContent, tiddlywiki.StringifyList(labels))
+	postTiddler.Created = tiddlyTime
+	postTiddler.Modified = tiddlyTime
+	postTiddler.Fields["post-slug"] = post.Id
+	postTiddler.Fields[tiddlywiki.FieldSourceURL] = post.Url // Добавляем URL на оригинальный пост
+	postTiddler.Fields[tiddlywiki.FieldImportType] = tiddlywiki.ImportTypePost
+	postTiddler.Fields[tiddlywiki.FieldAuthor] = authorName
+	if post.Status != "" && post.Status != "LIVE" {
+		postTiddler.Fields["blogger-status"] = strings.ToLower(post.Status)
+		// Черновики и запланированные посты не попадают в навигацию.
+		postTiddler.Fields[tiddlywiki.FieldImportType] = tiddlywiki.ImportTypeDraft
+	}
+	return postTiddler
+}
+
+func newPageTiddler(page *blogger.Page) *tiddlywiki.Tiddler {
+	created, _ := time.Parse(time.RFC3339, page.Published)
+	tiddlyTime := created.UTC().Format(tiddlywiki.TiddlyTimeFormat)
+
+	tags := []string{"page"}
+	if page.Status != "" && page.Status != "LIVE" {
+		tags = append(tags, "draft")
+	}
+	pageTiddler := tiddlywiki.NewTiddler(html.UnescapeString(page.Title), page.Content, tiddlywiki.StringifyList(tags))
+	pageTiddler.Created = tiddlyTime
+	pageTiddler.Modified = tiddlyTime
+	pageTiddler.Fields["page-id"] = page.Id
+	pageTiddler.Fields[tiddlywiki.FieldImportType] = tiddlywiki.ImportTypePage
+	if page.Url != "" {
+		pageTiddler.Fields[tiddlywiki.FieldSourceURL] = page.Url
+	}
+	if page.Author != nil {
+		pageTiddler.Fields[tiddlywiki.FieldAuthor] = html.UnescapeString(page.Author.DisplayName)
+	}
+	if page.Status != "" && page.Status != "LIVE" {
+		pageTiddler.Fields["blogger-status"] = strings.ToLower(page.Status)
+	}
+	return pageTiddler
+}
+
+// commentTiddlers строит дерево комментариев поста так же, как импорт
+// WordPress: заголовок "<пост>-comment-<id>" не зависит от порядка выдачи,
+// родитель - пост или комментарий из inReplyTo. Если родительского
+// комментария нет среди загруженных (удален), ответ привязывается к посту.
+// Без commentHTML из текста удаляется разметка, как раньше; с ним HTML
+// сохраняется и проходит общую очистку sanitize.
+func commentTiddlers(post *blogger.Post, postTitle string, comments []*blogger.Comment, commentHTML bool) []*tiddlywiki.Tiddler {
+	known := make(map[string]bool, len(comments))
+	for _, comment := range comments {
+		known[comment.Id] = true
+	}
+
+	var result []*tiddlywiki.Tiddler
+	for _, comment := range comments {
+		parentTitle := postTitle
+		if comment.InReplyTo != nil && known[comment.InReplyTo.Id] {
+			parentTitle = fmt.Sprintf("%s-comment-%s", postTitle, comment.InReplyTo.Id)
 		}
-		
-		time.Sleep(1 * time.Second)
+
+		text := comment.Content
+		if !commentHTML {
+			text = stripHTML(html.UnescapeString(text))
+		}
+		commentAuthor, authorURL := "", ""
+		if comment.Author != nil {
+			commentAuthor = html.UnescapeString(comment.Author.DisplayName)
+			authorURL = comment.Author.Url
+		}
+		sourceURL := ""
+		if post.Url != "" {
+			sourceURL = post.Url + "#c" + comment.Id
+		}
+		created, _ := time.Parse(time.RFC3339, comment.Published)
+		tiddlyTime := created.UTC().Format(tiddlywiki.TiddlyTimeFormat)
+
+		commentTiddler := tiddlywiki.NewTiddler(
+			fmt.Sprintf("%s-comment-%s", postTitle, comment.Id),
+			text,
+			tiddlywiki.StringifyList([]string{parentTitle}),
+		)
+		commentTiddler.Created = tiddlyTime
+		commentTiddler.Modified = tiddlyTime
+		commentTiddler.Fields["parent-post"] = post.Id
+		commentTiddler.Fields["comment-id"] = comment.Id
+		commentTiddler.Fields[tiddlywiki.FieldImportType] = tiddlywiki.ImportTypeComment
+		commentTiddler.Fields[tiddlywiki.FieldAuthor] = commentAuthor
+		commentTiddler.Fields[tiddlywiki.FieldParent] = parentTitle
+		commentTiddler.Fields[tiddlywiki.FieldThreadRoot] = postTitle
+		commentTiddler.Fields[tiddlywiki.FieldCommentAuthor] = commentAuthor
+		commentTiddler.Fields[tiddlywiki.FieldCommentDate] = tiddlyTime
+		if authorURL != "" {
+			commentTiddler.Fields["comment-author-url"] = authorURL
+		}
+		if sourceURL != "" {
+			commentTiddler.Fields[tiddlywiki.FieldSourceURL] = sourceURL
+		}
+		result = append(result, commentTiddler)
 	}
+	return result
+}
 
-	// --- НАЧАЛО ИЗМЕНЕНИЙ (БЛОК 3) ---
-	log.Println("Шаг 3: Добавление системных тиддлеров...")
-	siteTitleTiddler := tiddlywiki.NewTiddler("$:/SiteTitle", "Blogger", "")
-	siteSubtitleTiddler := tiddlywiki.NewTiddler("$:/SiteSubtitle", blogURL, "")
-	allTiddlers = append(allTiddlers, siteTitleTiddler, siteSubtitleTiddler)
-	// --- КОНЕЦ ИЗМЕНЕНИЙ (БЛОК 3) ---
+// Options - способ доступа к API Blogger. Нужен либо ключ API (только
+// опубликованные посты открытых блогов), либо OAuth-клиент: тогда
+// импортируются черновики, запланированные посты и закрытые блоги.
+type Options struct {
+	APIKey string
+	// ClientSecretPath - client_secret.json OAuth-клиента типа «Приложение для ПК».
+	ClientSecretPath string
+	// TokenCachePath - файл токена; по умолчанию в пользовательском каталоге настроек.
+	TokenCachePath string
+	// CommentHTML сохраняет разметку комментариев вместо простого текста.
+	CommentHTML bool
+}
 
-	return allTiddlers, nil
+// OAuth сообщает, выбран ли вход через OAuth.
+func (o Options) OAuth() bool {
+	return o.ClientSecretPath != ""
+}
+
+func newService(ctx context.Context, opts Options) (*blogger.Service, error) {
+	var clientOption option.ClientOption
+	if opts.OAuth() {
+		tokenSource, err := oauthTokenSource(ctx, opts.ClientSecretPath, opts.TokenCachePath)
+		if err != nil {
+			return nil, err
+		}
+		clientOption = option.WithTokenSource(tokenSource)
+	} else {
+		clientOption = option.WithAPIKey(opts.APIKey)
+	}
+	bloggerService, err := blogger.NewService(ctx, clientOption)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось создать сервис Blogger: %w", err)
+	}
+	return bloggerService, nil
 }
 
 // ConvertFromBlogID создает сервис и запускает конвертацию по ID блога.
 func ConvertFromBlogID(apiKey, blogID string) ([]*tiddlywiki.Tiddler, error) {
-	ctx := context.Background()
-	bloggerService, err := blogger.NewService(ctx, option.WithAPIKey(apiKey))
+	return ConvertFromBlogIDWithOptions(blogID, Options{APIKey: apiKey})
+}
+
+// ConvertFromBlogIDWithOptions - то же, что ConvertFromBlogID, с выбором способа доступа.
+func ConvertFromBlogIDWithOptions(blogID string, opts Options) ([]*tiddlywiki.Tiddler, error) {
+	bloggerService, err := newService(context.Background(), opts)
 	if err != nil {
-		return nil, fmt.Errorf("не удалось создать сервис Blogger: %w", err)
+		return nil, err
 	}
-	return convertBlogContent(bloggerService, blogID)
+	return convertBlogContent(bloggerService, blogID, opts)
 }
 
 // ConvertFromURL создает сервис, находит ID по URL и запускает конвертацию.
 func ConvertFromURL(apiKey, blogURL string) ([]*tiddlywiki.Tiddler, error) {
-	ctx := context.Background()
-	bloggerService, err := blogger.NewService(ctx, option.WithAPIKey(apiKey))
+	return ConvertFromURLWithOptions(blogURL, Options{APIKey: apiKey})
+}
+
+// ConvertFromURLWithOptions - то же, что ConvertFromURL, с выбором способа доступа.
+func ConvertFromURLWithOptions(blogURL string, opts Options) ([]*tiddlywiki.Tiddler, error) {
+	bloggerService, err := newService(context.Background(), opts)
 	if err != nil {
-		return nil, fmt.Errorf("не удалось создать сервис Blogger: %w", err)
+		return nil, err
 	}
 
 	blogID, err := getBlogIDByURL(bloggerService, blogURL)
@@ -181,15 +384,19 @@ func ConvertFromURL(apiKey, blogURL string) ([]*tiddlywiki.Tiddler, error) {
 		return nil, err
 	}
 
-	return convertBlogContent(bloggerService, blogID)
+	return convertBlogContent(bloggerService, blogID, opts)
 }
 
-// Функции fetchAllPosts и fetchAllComments остаются без изменений
-func fetchAllPosts(service *blogger.Service, blogID string) ([]*blogger.Post, error) {
+// fetchAllPosts загружает посты. Черновики и запланированные посты видны
+// только в представлении ADMIN, которое требует OAuth.
+func fetchAllPosts(service *blogger.Service, blogID string, admin bool) ([]*blogger.Post, error) {
 	var allPosts []*blogger.Post
 	var pageToken string
 	for {
 		call := service.Posts.List(blogID).MaxResults(50)
+		if admin {
+			call.Status("draft", "live", "scheduled").View("ADMIN")
+		}
 		if pageToken != "" { 
 			call.PageToken(pageToken) 
 		}
@@ -215,6 +422,37 @@ func fetchAllPosts(service *blogger.Service, blogID string) ([]*blogger.Post, er
 	return allPosts, nil
 }
 
+// fetchAllPages загружает статические страницы блога.
+func fetchAllPages(service *blogger.Service, blogID string, admin bool) ([]*blogger.Page, error) {
+	var allPages []*blogger.Page
+	var pageToken string
+	for {
+		call := service.Pages.List(blogID).MaxResults(50)
+		if admin {
+			call.Status("draft", "live").View("ADMIN")
+		}
+		if pageToken != "" {
+			call.PageToken(pageToken)
+		}
+		pageList, err := call.Do()
+		if err != nil {
+			if gerr, ok := err.(*googleapi.Error); ok && gerr.Code == 429 {
+				log.Println("Превышен лимит при запросе страниц. Ждем 5 секунд...")
+				time.Sleep(5 * time.Second)
+				continue
+			}
+			return allPages, fmt.Errorf("не удалось загрузить страницы: %w", err)
+		}
+		allPages = append(allPages, pageList.Items...)
+		if pageList.NextPageToken == "" {
+			break
+		}
+		pageToken = pageList.NextPageToken
+		time.Sleep(500 * time.Millisecond)
+	}
+	return allPages, nil
+}
+
 func fetchAllComments(service *blogger.Service, blogID, postID string) ([]*blogger.Comment, error) {
 	var allComments []*blogger.Comment
 	var pageToken string
@@ -0,0 +1,180 @@
+package blogger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/blogger/v3"
+)
+
+// --- OAUTH2 ДЛЯ ЗАКРЫТЫХ БЛОГОВ ---
+//
+// С ключом API доступны только опубликованные посты открытых блогов.
+// Черновики, запланированные посты и закрытые блоги требуют входа владельца
+// или автора блога. Используется поток для установленных приложений:
+// браузер открывает страницу согласия Google, а код авторизации возвращается
+// на локальный адрес 127.0.0.1. Полученный токен сохраняется в файл, и при
+// следующих запусках браузер уже не нужен.
+
+// defaultTokenCacheFile - имя файла токена в пользовательском каталоге настроек.
+const defaultTokenCacheFile = "tiddlywiki-converter/blogger-token.json"
+
+// oauthTokenSource читает client_secret.json (OAuth-клиент типа «Приложение
+// для ПК» из Google Cloud Console) и возвращает источник токенов. Если
+// в кэше нет токена, запускается вход через браузер.
+func oauthTokenSource(ctx context.Context, clientSecretPath, tokenCachePath string) (oauth2.TokenSource, error) {
+	secret, err := os.ReadFile(clientSecretPath)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать файл OAuth-клиента %s: %w", clientSecretPath, err)
+	}
+	config, err := google.ConfigFromJSON(secret, blogger.BloggerReadonlyScope)
+	if err != nil {
+		return nil, fmt.Errorf("некорректный файл OAuth-клиента: %w", err)
+	}
+	if tokenCachePath == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, fmt.Errorf("не удалось определить каталог для токена, укажите --blogger_token_cache: %w", err)
+		}
+		tokenCachePath = filepath.Join(dir, defaultTokenCacheFile)
+	}
+
+	token, err := loadToken(tokenCachePath)
+	if err != nil {
+		token, err = authorizeInBrowser(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+		if err := saveToken(tokenCachePath, token); err != nil {
+			log.Printf("Предупреждение: не удалось сохранить токен: %v", err)
+		} else {
+			log.Printf("Токен сохранен в %s", tokenCachePath)
+		}
+	}
+	return &cachingTokenSource{
+		base:  config.TokenSource(ctx, token),
+		path:  tokenCachePath,
+		saved: token.AccessToken,
+	}, nil
+}
+
+// authorizeInBrowser выводит ссылку на страницу согласия и ждет, пока Google
+// перенаправит браузер на локальный адрес с кодом авторизации.
+func authorizeInBrowser(ctx context.Context, config *oauth2.Config) (*oauth2.Token, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("не удалось открыть локальный порт для OAuth: %w", err)
+	}
+	defer listener.Close()
+	config.RedirectURL = fmt.Sprintf("http://%s/", listener.Addr())
+
+	state := oauth2.GenerateVerifier()
+	verifier := oauth2.GenerateVerifier()
+	authURL := config.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.S256ChallengeOption(verifier))
+
+	type result struct {
+		code string
+		err  error
+	}
+	done := make(chan result, 1)
+	report := func(r result) {
+		select {
+		case done <- r:
+		default: // повторный запрос (обновление страницы) игнорируется
+		}
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch {
+		case q.Get("state") != state:
+			http.Error(w, "Неверный параметр state", http.StatusBadRequest)
+			return
+		case q.Get("error") != "":
+			fmt.Fprintln(w, "Доступ не предоставлен. Окно можно закрыть.")
+			report(result{err: fmt.Errorf("авторизация отклонена: %s", q.Get("error"))})
+		default:
+			fmt.Fprintln(w, "Авторизация завершена. Окно можно закрыть и вернуться в терминал.")
+			report(result{code: q.Get("code")})
+		}
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	log.Println("Откройте в браузере ссылку и разрешите доступ к блогу:")
+	log.Println(authURL)
+
+	var res result
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if res.err != nil {
+		return nil, res.err
+	}
+	token, err := config.Exchange(ctx, res.code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("не удалось обменять код авторизации на токен: %w", err)
+	}
+	return token, nil
+}
+
+// cachingTokenSource сохраняет токен в файл каждый раз, когда он обновляется,
+// чтобы при следующем запуске не выполнять лишний запрос обновления.
+type cachingTokenSource struct {
+	base oauth2.TokenSource
+	path string
+
+	mu    sync.Mutex
+	saved string
+}
+
+func (s *cachingTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.base.Token()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось обновить токен (удалите %s, чтобы войти заново): %w", s.path, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if token.AccessToken != s.saved {
+		if err := saveToken(s.path, token); err != nil {
+			log.Printf("Предупреждение: не удалось сохранить токен: %v", err)
+		}
+		s.saved = token.AccessToken
+	}
+	return token, nil
+}
+
+func loadToken(path string) (*oauth2.Token, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var token oauth2.Token
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// saveToken записывает токен с правами 0600: в нем refresh-токен,
+// дающий доступ к блогу без пароля.
+func saveToken(path string, token *oauth2.Token) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(token, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
@@ -3,9 +3,11 @@ package main
 import (
 	"flag"
 	"log"
+	"strconv"
 	"strings"
 
 	tiddlywiki_converter "tiddlywiki-converter"
+	"tiddlywiki-converter/split"
 	"tiddlywiki-converter/tiddlywiki"
 )
 
@@ -14,32 +16,94 @@ func main() {
 	urlPtr := flag.String("url", "", "URL для конвертации (WordPress, Blogger, Wikipedia, LiveJournal)")
 	usernamePtr := flag.String("user", "", "Имя пользователя Hashnode")
 	hostPtr := flag.String("host", "", "Кастомный домен блога Hashnode")
-	xmlPathPtr := flag.String("xml_path", "", "Путь к XML-файлу экспорта WordPress")
+	hashnodeAllPublicationsPtr := flag.Bool("hashnode_all_publications", false, "Hashnode: импортировать все публикации пользователя (--user), а не только первую; черновики - с токеном из HASHNODE_TOKEN")
+	xmlPathPtr := flag.String("xml_path", "", "Путь к экспорту WordPress: файл .xml или .xml.gz, каталог, шаблон или список через запятую")
 	apiKeyPtr := flag.String("api_key", "", "API ключ для Blogger")
 	blogIDPtr := flag.String("blog_id", "", "ID блога на Blogger")
+	bloggerClientSecretPtr := flag.String("blogger_client_secret", "", "Blogger OAuth: client_secret.json приложения для ПК; дает доступ к черновикам, запланированным постам и закрытым блогам")
+	bloggerTokenCachePtr := flag.String("blogger_token_cache", "", "Blogger OAuth: файл для сохранения токена (по умолчанию в каталоге настроек пользователя)")
+	bloggerCommentHTMLPtr := flag.Bool("blogger_comment_html", false, "Blogger: сохранять HTML комментариев (ссылки, форматирование) вместо простого текста")
+	atomPathPtr := flag.String("atom_path", "", "Путь к экспорту Blogger (feed.atom из Google Takeout); --api_key не нужен, --url задает адрес блога для ссылок")
+	ljCookiesPtr := flag.String("lj_cookies", "", "LiveJournal: файл cookies.txt (формат Netscape) для доступа к закрытым записям; куки сессии можно задать в LJ_SESSION")
+	ljProtocolPtr := flag.Bool("lj_protocol", false, "LiveJournal: импорт через протокол XML-RPC с логином и паролем из LJ_USERNAME и LJ_PASSWORD")
+	ljBackupPtr := flag.String("lj_backup", "", "LiveJournal: резервная копия без обращения к сети - каталог ljdump (файлы L-*, C-*) или файл ljArchive")
+	ljHostPtr := flag.String("lj_host", "", "LiveJournal: сервер протокола для сайтов на движке ЖЖ, например www.dreamwidth.org (по умолчанию www.livejournal.com)")
+	ljFromPtr := flag.String("lj_from", "", "LiveJournal: импортировать записи начиная с даты ГГГГ, ГГГГ-ММ или ГГГГ-ММ-ДД")
+	ljToPtr := flag.String("lj_to", "", "LiveJournal: импортировать записи по дату ГГГГ, ГГГГ-ММ или ГГГГ-ММ-ДД включительно")
+	sanitizePtr := flag.String("sanitize", "embeds", "Режим очистки HTML: off, strict, embeds (встраивания известных провайдеров)")
+	sanitizeOverridesPtr := flag.String("sanitize_overrides", "", "Режимы очистки для отдельных источников, например: wikipedia:off,livejournal:strict")
+	sanitizeEmbedHostsPtr := flag.String("sanitize_embed_hosts", "", "Дополнительные разрешенные хосты для iframe через запятую")
+	navigationPtr := flag.Bool("navigation", false, "Создать навигацию: архив по годам и месяцам, облако тегов, авторов и вкладку в боковой панели")
+	splitPtr := flag.String("split", "", "Разбить результат на несколько вики: year (по годам), size (по размеру), tag (по тегам)")
+	splitMaxMBPtr := flag.String("split_max_mb", "", "Максимальный размер одной вики в мегабайтах (для --split size)")
+	splitMaxTiddlersPtr := flag.String("split_max_tiddlers", "", "Максимальное число тиддлеров в одной вики (для --split size)")
+	includeDraftsPtr := flag.Bool("include_drafts", false, "WordPress XML: импортировать черновики, записи на утверждении и запланированные")
+	includePrivatePtr := flag.Bool("include_private", false, "WordPress XML: импортировать личные записи")
+	includeUnapprovedPtr := flag.Bool("include_unapproved_comments", false, "WordPress XML: импортировать комментарии на модерации, спам и удаленные")
+	wpPostTypesPtr := flag.String("wp_post_types", "", "WordPress REST: дополнительные типы записей через запятую, например: product,portfolio")
+	tagSlugPtr := flag.Bool("tag_slug", false, "Теги: заменять пробелы и знаки препинания дефисом (буквы любых алфавитов сохраняются)")
+	tagCaseFoldPtr := flag.Bool("tag_case_fold", false, "Теги: приводить к нижнему регистру")
+	tagAliasesPtr := flag.String("tag_aliases", "", "Теги: файл синонимов, строки вида \"js, javascript = JavaScript\"")
+	tagPrefixPtr := flag.String("tag_prefix", "", "Теги: префикс для всех источников или по платформам, например: livejournal:lj/,hashnode:hn/")
+	tagMaxLengthPtr := flag.String("tag_max_length", "", "Теги: максимальная длина в символах")
+	deterministicPtr := flag.Bool("deterministic", false, "Воспроизводимый результат: стабильный порядок и даты, повторный импорт неизменного блога дает идентичный файл")
 	flag.Parse()
 
 	config := map[string]string{
-		"platform": *platformPtr,
-		"url":      *urlPtr,
-		"username": *usernamePtr,
-		"host":     *hostPtr,
-		"xml_path": *xmlPathPtr,
-		"api_key":  *apiKeyPtr,
-		"blog_id":  *blogIDPtr,
-	}
+		"platform":  *platformPtr,
+		"url":       *urlPtr,
+		"username":  *usernamePtr,
+		"host":      *hostPtr,
+		"xml_path":  *xmlPathPtr,
+		"api_key":   *apiKeyPtr,
+		"blog_id":   *blogIDPtr,
+		"atom_path": *atomPathPtr,
 
-	if config["platform"] == "" {
-		log.Fatal("Ошибка: Укажите платформу (--platform)")
+		"blogger_client_secret": *bloggerClientSecretPtr,
+		"blogger_token_cache":   *bloggerTokenCachePtr,
+		"blogger_comment_html":  strconv.FormatBool(*bloggerCommentHTMLPtr),
+
+		"hashnode_all_publications": strconv.FormatBool(*hashnodeAllPublicationsPtr),
+
+		"lj_cookies":  *ljCookiesPtr,
+		"lj_protocol": strconv.FormatBool(*ljProtocolPtr),
+		"lj_host":     *ljHostPtr,
+		"lj_backup":   *ljBackupPtr,
+		"lj_from":     *ljFromPtr,
+		"lj_to":       *ljToPtr,
+
+		"sanitize":             *sanitizePtr,
+		"sanitize_overrides":   *sanitizeOverridesPtr,
+		"sanitize_embed_hosts": *sanitizeEmbedHostsPtr,
+
+		"navigation": strconv.FormatBool(*navigationPtr),
+
+		"split":              *splitPtr,
+		"split_max_mb":       *splitMaxMBPtr,
+		"split_max_tiddlers": *splitMaxTiddlersPtr,
+
+		"include_drafts":  strconv.FormatBool(*includeDraftsPtr),
+		"include_private": strconv.FormatBool(*includePrivatePtr),
+
+		"include_unapproved_comments": strconv.FormatBool(*includeUnapprovedPtr),
+		"wp_post_types":               *wpPostTypesPtr,
+
+		"tag_slug":       strconv.FormatBool(*tagSlugPtr),
+		"tag_case_fold":  strconv.FormatBool(*tagCaseFoldPtr),
+		"tag_aliases":    *tagAliasesPtr,
+		"tag_prefix":     *tagPrefixPtr,
+		"tag_max_length": *tagMaxLengthPtr,
+
+		"deterministic": strconv.FormatBool(*deterministicPtr),
 	}
 
-	log.Printf("Запускаем конвертацию для платформы '%s'...", config["platform"])
-    
-    log.Println("main: Вызываем tiddlywiki-converter.Convert с config:", config["platform"], config["url"])
-    
-	tiddlers, err := tiddlywiki_converter.Convert(config)
+	splitOptions, err := split.OptionsFromMap(config)
 	if err != nil {
-		log.Fatalf("Ошибка конвертации: %v", err)
+		log.Fatalf("Ошибка: %v", err)
+	}
+
+	if config["platform"] == "" {
+		log.Fatal("Ошибка: Укажите платформу (--platform)")
 	}
 
 	var baseName string
@@ -62,9 +126,40 @@ func main() {
 	// === ИСПРАВЛЕНИЕ: ПРАВИЛЬНЫЙ ПУТЬ К ШАБЛОНУ ===
 	templatePath := "../../internal/template.html" 
 	
+	if splitOptions == nil && tiddlywiki_converter.CanStream(config) {
+		// Экспорт WordPress может занимать гигабайты: тиддлеры пишутся в файл
+		// по мере разбора, не собираясь в памяти.
+		log.Printf("Запускаем потоковую конвертацию для платформы '%s'...", config["platform"])
+		count, err := tiddlywiki_converter.ConvertToHTML(config, templatePath, outputPath)
+		if err != nil {
+			log.Fatalf("Ошибка конвертации: %v", err)
+		}
+		log.Printf("Сконвертировано %d тиддлеров.", count)
+		log.Printf("Файл успешно создан: %s", outputPath)
+		return
+	}
+
+	log.Printf("Запускаем конвертацию для платформы '%s'...", config["platform"])
+    
+    log.Println("main: Вызываем tiddlywiki-converter.Convert с config:", config["platform"], config["url"])
+    
+	tiddlers, err := tiddlywiki_converter.Convert(config)
+	if err != nil {
+		log.Fatalf("Ошибка конвертации: %v", err)
+	}
+
 	log.Printf("Сконвертировано %d тиддлеров.", len(tiddlers))
 	log.Println("Генерация TiddlyWiki файла...")
 
+	if splitOptions != nil {
+		parts := split.Split(tiddlers, *splitOptions, outputPath)
+		if err := split.WriteHTML(parts, templatePath); err != nil {
+			log.Fatalf("Ошибка при генерации HTML: %v", err)
+		}
+		log.Printf("Создано файлов: %d", len(parts))
+		return
+	}
+
 	err = tiddlywiki.GenerateHTML(tiddlers, templatePath, outputPath)
 	if err != nil {
 		log.Fatalf("Ошибка при генерации HTML: %v", err)
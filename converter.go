@@ -4,15 +4,88 @@ import (
 	"fmt"
 	"log" 
 	"net/url"    
+	"time"
 	"tiddlywiki-converter/blogger"
 	"tiddlywiki-converter/hashnode"
 	"tiddlywiki-converter/livejournal"
+	"tiddlywiki-converter/tags"
 	"tiddlywiki-converter/tiddlywiki"
 	"tiddlywiki-converter/wordpress"
 	"tiddlywiki-converter/wikipedia"
 )
 
+// Convert запускает конвертер нужной платформы, а затем общий для всех
+// платформ конвейер постобработки (очистка HTML и т.д.).
 func Convert(config map[string]string) ([]*tiddlywiki.Tiddler, error) {
+	if err := setup(config); err != nil {
+		return nil, err
+	}
+	tiddlers, err := convertPlatform(config)
+	if err != nil {
+		return nil, err
+	}
+	return postProcess(config, tiddlers)
+}
+
+// CanStream сообщает, можно ли записать результат потоково, не собирая
+// все тиддлеры в памяти. Сейчас это импорт файла экспорта WordPress;
+// разбиение и детерминированный режим требуют полного списка тиддлеров.
+func CanStream(config map[string]string) bool {
+	return config["platform"] == "wordpress" && config["xml_path"] != "" &&
+		config["split"] == "" && config["deterministic"] != "true"
+}
+
+// ConvertToHTML конвертирует потоково и сразу пишет вики в outputPath.
+// Вызывать, только если CanStream вернул true. Возвращает число записанных тиддлеров.
+func ConvertToHTML(config map[string]string, templatePath, outputPath string) (int, error) {
+	if err := setup(config); err != nil {
+		return 0, err
+	}
+	out, err := tiddlywiki.NewHTMLWriter(templatePath, outputPath)
+	if err != nil {
+		return 0, err
+	}
+	p, err := newStreamPipeline(config, out)
+	if err != nil {
+		out.Close()
+		return 0, err
+	}
+	log.Println("Вызываю потоковый конвертер WordPress для XML...")
+	if err := wordpress.StreamXMLFiles(config["xml_path"], wxrOptions(config), p.add); err != nil {
+		out.Close()
+		return out.Count(), err
+	}
+	if err := p.finish(); err != nil {
+		return out.Count(), err
+	}
+	return out.Count(), nil
+}
+
+// setup применяет общие для всех платформ настройки.
+func setup(config map[string]string) error {
+	if config["deterministic"] == "true" {
+		// Служебные тиддлеры получат не текущее время, а фиксированное;
+		// в конце конвейера оно заменяется на дату самого свежего контента.
+		tiddlywiki.SetFixedTime(time.Unix(0, 0))
+	}
+	tagOpts, err := tags.OptionsFromMap(config)
+	if err != nil {
+		return fmt.Errorf("ошибка настройки тегов: %w", err)
+	}
+	tags.SetDefault(tags.New(tagOpts))
+	return nil
+}
+
+func wxrOptions(config map[string]string) wordpress.WXROptions {
+	return wordpress.WXROptions{
+		IncludeDrafts:  config["include_drafts"] == "true",
+		IncludePrivate: config["include_private"] == "true",
+
+		IncludeUnapprovedComments: config["include_unapproved_comments"] == "true",
+	}
+}
+
+func convertPlatform(config map[string]string) ([]*tiddlywiki.Tiddler, error) {
 	platform, ok := config["platform"]
 	if !ok {
 		return nil, fmt.Errorf("платформа не указана в конфигурации")
@@ -39,7 +112,7 @@ func Convert(config map[string]string) ([]*tiddlywiki.Tiddler, error) {
             return nil, fmt.Errorf("для Hashnode необходимо указать --url, --host или --user")
         }
     
-        return hashnode.ConvertFromAPI(username, host)
+        return hashnode.ConvertFromAPIWithOptions(username, host, hashnode.OptionsFromMap(config))
 	
     case "wordpress":
 		url := config["url"]
@@ -47,12 +120,15 @@ func Convert(config map[string]string) ([]*tiddlywiki.Tiddler, error) {
 
 		if xmlPath != "" {
 			log.Println("Вызываю конвертер WordPress для XML...")
-			return wordpress.ConvertFromXMLFile(xmlPath)
+			return wordpress.ConvertFromXMLFileWithOptions(xmlPath, wxrOptions(config))
 		}
 		
 		if url != "" {
 			log.Println("Вызываю конвертер WordPress для URL...")
-			return wordpress.ConvertFromURL(url)
+			return wordpress.ConvertFromURLWithOptions(url, wordpress.RESTOptions{
+				Credentials: wordpress.CredentialsFromMap(config),
+				PostTypes:   wordpress.ParsePostTypes(config["wp_post_types"]),
+			})
 		}
 		
 		return nil, fmt.Errorf("для WordPress необходимо указать --url или --xml_path")
@@ -62,25 +138,47 @@ func Convert(config map[string]string) ([]*tiddlywiki.Tiddler, error) {
 		blogID := config["blog_id"]
 		blogURL := config["url"]
 
-		if apiKey == "" {
-			return nil, fmt.Errorf("для Blogger необходимо указать --api_key")
+		opts := blogger.Options{
+			APIKey:           apiKey,
+			ClientSecretPath: config["blogger_client_secret"],
+			TokenCachePath:   config["blogger_token_cache"],
+			CommentHTML:      config["blogger_comment_html"] == "true",
+		}
+
+		// Экспорт Takeout читается локально, ключ API для него не нужен.
+		if atomPath := config["atom_path"]; atomPath != "" {
+			log.Println("Вызываю конвертер Blogger для файла экспорта...")
+			return blogger.ConvertFromAtomFile(atomPath, blogURL, opts)
+		}
+
+		if apiKey == "" && !opts.OAuth() {
+			return nil, fmt.Errorf("для Blogger необходимо указать --api_key, --blogger_client_secret или --atom_path")
 		}
 
 		if blogURL != "" {
-			return blogger.ConvertFromURL(apiKey, blogURL)
+			return blogger.ConvertFromURLWithOptions(blogURL, opts)
 		} else if blogID != "" {
-			return blogger.ConvertFromBlogID(apiKey, blogID)
+			return blogger.ConvertFromBlogIDWithOptions(blogID, opts)
 		} else {
 			return nil, fmt.Errorf("для Blogger необходимо указать --url или --blog_id")
 		}
 
 	case "livejournal":
+		opts, err := livejournal.OptionsFromMap(config)
+		if err != nil {
+			return nil, err
+		}
+		// Резервная копия читается локально, журнал может быть уже недоступен.
+		if backupPath := config["lj_backup"]; backupPath != "" {
+			log.Printf("Запускаем конвертацию резервной копии LiveJournal: %s", backupPath)
+			return livejournal.ConvertFromBackupWithOptions(backupPath, opts)
+		}
 		pageURL := config["url"]
 		if pageURL == "" {
-			return nil, fmt.Errorf("для LiveJournal необходимо указать --url")
+			return nil, fmt.Errorf("для LiveJournal необходимо указать --url или --lj_backup")
 		}
 		log.Printf("Запускаем конвертацию LiveJournal для URL: %s", pageURL)
-		return livejournal.ConvertFromURL(pageURL)
+		return livejournal.ConvertFromURLWithOptions(pageURL, opts)
 		
 	// =========================================================================
 	// ВОЗВРАЩАЕМ УДАЛЕННЫЙ КОД
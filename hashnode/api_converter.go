@@ -4,53 +4,105 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"regexp"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/gomarkdown/markdown"
 	"github.com/shurcooL/graphql"
+	"tiddlywiki-converter/tags"
 	"tiddlywiki-converter/tiddlywiki"
 )
 
 // ИСПРАВЛЕННАЯ ВЕРСИЯ
 type PublicationGQL struct {
+	Title graphql.String
 	Posts struct {
-		PageInfo struct {
-			EndCursor   graphql.String
-			HasNextPage graphql.Boolean
-		}
-		Edges []struct {
+		PageInfo PageInfoGQL
+		Edges    []struct {
 			Node struct {
-				Title       graphql.String
-				Slug        graphql.String
-				Content     struct{ Markdown graphql.String }
+				ID       graphql.String
+				Title    graphql.String
+				Slug     graphql.String
+				Content  struct{ Markdown graphql.String }
+				PostMetaGQL
 				PublishedAt graphql.String
+				Author      struct{ Name graphql.String }
 				Tags        []struct {
 					Name graphql.String
 					Slug graphql.String
 				}
-				Comments struct {
-					Edges []struct{ Node CommentGQL }
-				} `graphql:"comments(first: 50)"`
+				Comments CommentConnectionGQL `graphql:"comments(first: 50)"`
 			}
 		}
 	} `graphql:"posts(first: $first, after: $after)"`
 }
 
+// PostMetaGQL - поля, общие для опубликованных постов и черновиков.
+type PostMetaGQL struct {
+	Subtitle          graphql.String
+	CoverImage        struct{ URL graphql.String `graphql:"url"` }
+	CanonicalURL      graphql.String `graphql:"canonicalUrl"`
+	ReadTimeInMinutes graphql.Int
+}
+
+type PageInfoGQL struct {
+	EndCursor   graphql.String
+	HasNextPage graphql.Boolean
+}
+
 type ReplyGQL struct {
+	ID        graphql.String
 	Author    struct{ Name graphql.String }
 	Content   struct{ Text graphql.String }
 	DateAdded graphql.String
 }
 
+type ReplyConnectionGQL struct {
+	PageInfo PageInfoGQL
+	Edges    []struct{ Node ReplyGQL }
+}
+
 type CommentGQL struct {
+	ID        graphql.String
 	Author    struct{ Name graphql.String }
 	Content   struct{ Text graphql.String }
 	DateAdded graphql.String
-	Replies   struct {
-		Edges []struct{ Node ReplyGQL }
-	} `graphql:"replies(first: 50)"`
+	Replies   ReplyConnectionGQL `graphql:"replies(first: 50)"`
+}
+
+// CommentEdgeGQL хранит курсор комментария: по нему дозагружаются его ответы.
+type CommentEdgeGQL struct {
+	Cursor graphql.String
+	Node   CommentGQL
+}
+
+type CommentConnectionGQL struct {
+	PageInfo PageInfoGQL
+	Edges    []CommentEdgeGQL
+}
+
+// Запрос следующей страницы комментариев поста
+type postCommentsQuery struct {
+	Post struct {
+		Comments CommentConnectionGQL `graphql:"comments(first: 50, after: $after)"`
+	} `graphql:"post(id: $id)"`
+}
+
+// Запрос следующей страницы ответов на комментарий. Отдельного запроса
+// комментария по ID в API нет, поэтому комментарий выбирается из списка
+// комментариев поста курсором предыдущего комментария.
+type commentRepliesQuery struct {
+	Post struct {
+		Comments struct {
+			Edges []struct {
+				Node struct {
+					ID      graphql.String
+					Replies ReplyConnectionGQL `graphql:"replies(first: 50, after: $repliesAfter)"`
+				}
+			}
+		} `graphql:"comments(first: 1, after: $commentAfter)"`
+	} `graphql:"post(id: $id)"`
 }
 
 // Запрос для получения постов по хосту (основной рабочий запрос)
@@ -58,86 +110,221 @@ type publicationByHostQuery struct {
 	Publication PublicationGQL `graphql:"publication(host: $host)"`
 }
 
-// Запрос для получения хоста по имени пользователя (используется один раз)
-type userHostQuery struct {
+// Запрос публикаций пользователя
+type userPublicationsQuery struct {
 	User struct {
 		Publications struct {
-			Edges []struct {
+			PageInfo PageInfoGQL
+			Edges    []struct {
 				Node struct {
 					Host graphql.String
 				}
 			}
-		} `graphql:"publications(first: 1)"`
+		} `graphql:"publications(first: 20, after: $after)"`
 	} `graphql:"user(username: $username)"`
 }
 
-// processComments остается без изменений
-func processComments(commentEdges []struct{ Node CommentGQL }, postTitle, postSlug string, tiddlers *[]*tiddlywiki.Tiddler) {
-	for _, commentEdge := range commentEdges {
+// fetchAllComments дочитывает комментарии поста и ответы на них по курсорам:
+// в запросе постов приходят только первые 50 комментариев и по 50 ответов.
+func fetchAllComments(client *graphql.Client, postID string, first CommentConnectionGQL) ([]CommentEdgeGQL, error) {
+	comments := first.Edges
+	pageInfo := first.PageInfo
+	for pageInfo.HasNextPage {
+		var query postCommentsQuery
+		variables := map[string]interface{}{
+			"id":    graphql.ID(postID),
+			"after": &pageInfo.EndCursor,
+		}
+		if err := client.Query(context.Background(), &query, variables); err != nil {
+			return comments, fmt.Errorf("ошибка при загрузке комментариев: %w", err)
+		}
+		comments = append(comments, query.Post.Comments.Edges...)
+		pageInfo = query.Post.Comments.PageInfo
+	}
+
+	for i := range comments {
+		var commentAfter *graphql.String
+		if i > 0 {
+			commentAfter = &comments[i-1].Cursor
+		}
+		replies := &comments[i].Node.Replies
+		for replies.PageInfo.HasNextPage {
+			var query commentRepliesQuery
+			variables := map[string]interface{}{
+				"id":           graphql.ID(postID),
+				"commentAfter": commentAfter,
+				"repliesAfter": &replies.PageInfo.EndCursor,
+			}
+			if err := client.Query(context.Background(), &query, variables); err != nil {
+				return comments, fmt.Errorf("ошибка при загрузке ответов: %w", err)
+			}
+			edges := query.Post.Comments.Edges
+			if len(edges) == 0 || edges[0].Node.ID != comments[i].Node.ID {
+				// Список комментариев изменился во время импорта.
+				log.Printf("Предупреждение: не удалось дозагрузить ответы на комментарий %s", comments[i].Node.ID)
+				break
+			}
+			replies.Edges = append(replies.Edges, edges[0].Node.Replies.Edges...)
+			replies.PageInfo = edges[0].Node.Replies.PageInfo
+		}
+	}
+	return comments, nil
+}
+
+// processComments создает тиддлеры комментариев и ответов. Заголовок
+// "<пост>-comment-<id>" уникален, как в импорте WordPress и Blogger;
+// ответ ссылается на свой комментарий через поле parent и тег.
+func processComments(comments []CommentEdgeGQL, postTitle, postSlug string, tiddlers *[]*tiddlywiki.Tiddler) {
+	for _, commentEdge := range comments {
 		comment := commentEdge.Node
-		author := string(comment.Author.Name)
-		commentText := fmt.Sprintf("<blockquote>%s</blockquote>\n\n''- %s''", string(comment.Content.Text), author)
-		createdComm, _ := time.Parse(time.RFC3339, string(comment.DateAdded))
-		tiddlyCommTime := createdComm.UTC().Format(tiddlywiki.TiddlyTimeFormat)
-
-		commentTiddler := tiddlywiki.NewTiddler(
-			fmt.Sprintf("Комментарий от %s к посту «%s»", author, postTitle),
-			commentText, "comment",
-		)
-		commentTiddler.Created = tiddlyCommTime
-		commentTiddler.Modified = tiddlyCommTime
-		commentTiddler.Fields["parent-post"] = postSlug
-		*tiddlers = append(*tiddlers, commentTiddler)
+		commentTitle := fmt.Sprintf("%s-comment-%s", postTitle, comment.ID)
+		*tiddlers = append(*tiddlers, newCommentTiddler(commentTitle, postTitle, postTitle, postSlug,
+			string(comment.ID), string(comment.Author.Name), string(comment.Content.Text), string(comment.DateAdded)))
 
 		for _, replyEdge := range comment.Replies.Edges {
 			reply := replyEdge.Node
-			replyAuthor := string(reply.Author.Name)
-			replyText := fmt.Sprintf("<blockquote>%s</blockquote>\n\n''- %s''", string(reply.Content.Text), replyAuthor)
-			createdReply, _ := time.Parse(time.RFC3339, string(reply.DateAdded))
-			tiddlyReplyTime := createdReply.UTC().Format(tiddlywiki.TiddlyTimeFormat)
-
-			replyTiddler := tiddlywiki.NewTiddler(
-				fmt.Sprintf("Ответ от %s на комментарий к посту «%s»", replyAuthor, postTitle),
-				replyText, "comment reply",
-			)
-			replyTiddler.Created = tiddlyReplyTime
-			replyTiddler.Modified = tiddlyReplyTime
-			replyTiddler.Fields["parent-post"] = postSlug
-			*tiddlers = append(*tiddlers, replyTiddler)
+			*tiddlers = append(*tiddlers, newCommentTiddler(
+				fmt.Sprintf("%s-comment-%s", postTitle, reply.ID), commentTitle, postTitle, postSlug,
+				string(reply.ID), string(reply.Author.Name), string(reply.Content.Text), string(reply.DateAdded)))
 		}
 	}
 }
 
+func newCommentTiddler(title, parentTitle, postTitle, postSlug, id, author, text, dateAdded string) *tiddlywiki.Tiddler {
+	created, _ := time.Parse(time.RFC3339, dateAdded)
+	tiddlyTime := created.UTC().Format(tiddlywiki.TiddlyTimeFormat)
+
+	commentTiddler := tiddlywiki.NewTiddler(title, text, tiddlywiki.StringifyList([]string{parentTitle}))
+	commentTiddler.Created = tiddlyTime
+	commentTiddler.Modified = tiddlyTime
+	commentTiddler.Fields["parent-post"] = postSlug
+	commentTiddler.Fields["comment-id"] = id
+	commentTiddler.Fields[tiddlywiki.FieldImportType] = tiddlywiki.ImportTypeComment
+	commentTiddler.Fields[tiddlywiki.FieldAuthor] = author
+	commentTiddler.Fields[tiddlywiki.FieldParent] = parentTitle
+	commentTiddler.Fields[tiddlywiki.FieldThreadRoot] = postTitle
+	commentTiddler.Fields[tiddlywiki.FieldCommentAuthor] = author
+	commentTiddler.Fields[tiddlywiki.FieldCommentDate] = tiddlyTime
+	return commentTiddler
+}
+
+// Options - дополнительные возможности импорта Hashnode.
+type Options struct {
+	// AllPublications - импортировать все публикации пользователя, а не только первую.
+	AllPublications bool
+	// Token - персональный токен доступа (Settings -> Developer). Нужен для черновиков.
+	Token string
+}
+
+// OptionsFromMap читает ключи hashnode_all_publications и hashnode_token;
+// токен можно передать и через переменную окружения HASHNODE_TOKEN.
+func OptionsFromMap(config map[string]string) Options {
+	token := strings.TrimSpace(config["hashnode_token"])
+	if token == "" {
+		token = strings.TrimSpace(os.Getenv("HASHNODE_TOKEN"))
+	}
+	return Options{
+		AllPublications: config["hashnode_all_publications"] == "true",
+		Token:           token,
+	}
+}
+
 // --- ИЗМЕНЕНИЕ: Полностью переписанная функция ConvertFromAPI ---
 func ConvertFromAPI(username, host string) ([]*tiddlywiki.Tiddler, error) {
-	client := graphql.NewClient("https://gql.hashnode.com/", nil)
+	return ConvertFromAPIWithOptions(username, host, Options{})
+}
+
+// ConvertFromAPIWithOptions импортирует одну публикацию по хосту или
+// публикации пользователя: первую либо все, если задан AllPublications.
+func ConvertFromAPIWithOptions(username, host string, opts Options) ([]*tiddlywiki.Tiddler, error) {
+	client := newClient(opts.Token)
 	var allTiddlers []*tiddlywiki.Tiddler
-	
-	var publicationHost string
 
-	// Шаг 1: Определяем хост блога.
+	// Шаг 1: Определяем хосты блогов.
+	var hosts []string
 	if host != "" {
-		publicationHost = host
-		log.Printf("Используем предоставленный хост: %s", publicationHost)
+		hosts = []string{host}
+		log.Printf("Используем предоставленный хост: %s", host)
 	} else if username != "" {
-		log.Printf("Хост не предоставлен, ищем публикацию для пользователя: %s", username)
-		var query userHostQuery
-		variables := map[string]interface{}{"username": graphql.String(username)}
-		err := client.Query(context.Background(), &query, variables)
+		log.Printf("Хост не предоставлен, ищем публикации пользователя: %s", username)
+		var err error
+		hosts, err = fetchPublicationHosts(client, username, opts.AllPublications)
 		if err != nil {
-			return nil, fmt.Errorf("ошибка при поиске публикации пользователя '%s': %w", username, err)
-		}
-		if len(query.User.Publications.Edges) == 0 {
-			return nil, fmt.Errorf("у пользователя '%s' не найдено публикаций", username)
+			return nil, err
 		}
-		publicationHost = string(query.User.Publications.Edges[0].Node.Host)
-		log.Printf("Найдена публикация с хостом: %s", publicationHost)
+		log.Printf("Найдены публикации: %s", strings.Join(hosts, ", "))
 	} else {
 		// Эта проверка дублируется в converter.go, но так надежнее
 		return nil, fmt.Errorf("необходимо указать имя пользователя или хост")
 	}
 
-	// Шаг 2: Запускаем цикл пагинации, используя только хост.
+	// Шаг 2: Импортируем каждую публикацию.
+	var siteTitle string
+	for _, publicationHost := range hosts {
+		tiddlers, title, err := convertPublication(client, publicationHost, opts)
+		if err != nil {
+			if len(hosts) == 1 {
+				return nil, err
+			}
+			log.Printf("Предупреждение: публикация %s пропущена: %v", publicationHost, err)
+			continue
+		}
+		if siteTitle == "" {
+			siteTitle = title
+		}
+		allTiddlers = append(allTiddlers, tiddlers...)
+	}
+	if len(hosts) > 1 || siteTitle == "" {
+		siteTitle = "Hashnode"
+	}
+
+	// ДОБАВЛЕНО: Создание системных тиддлеров для заголовка
+	siteTitleTiddler := tiddlywiki.NewTiddler("$:/SiteTitle", siteTitle, "")
+	siteSubtitleTiddler := tiddlywiki.NewTiddler("$:/SiteSubtitle", strings.Join(hosts, ", "), "")
+	allTiddlers = append(allTiddlers, siteTitleTiddler, siteSubtitleTiddler)
+
+	return allTiddlers, nil
+}
+
+// fetchPublicationHosts возвращает хосты публикаций пользователя.
+func fetchPublicationHosts(client *graphql.Client, username string, all bool) ([]string, error) {
+	var hosts []string
+	var cursor *graphql.String
+	for {
+		var query userPublicationsQuery
+		variables := map[string]interface{}{
+			"username": graphql.String(username),
+			"after":    cursor,
+		}
+		if err := client.Query(context.Background(), &query, variables); err != nil {
+			return nil, fmt.Errorf("ошибка при поиске публикации пользователя '%s': %w", username, err)
+		}
+		publications := query.User.Publications
+		for _, edge := range publications.Edges {
+			hosts = append(hosts, string(edge.Node.Host))
+		}
+		if !all || !bool(publications.PageInfo.HasNextPage) {
+			break
+		}
+		cursor = &publications.PageInfo.EndCursor
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("у пользователя '%s' не найдено публикаций", username)
+	}
+	if !all {
+		hosts = hosts[:1]
+	}
+	return hosts, nil
+}
+
+// convertPublication импортирует посты с комментариями, серии, статические
+// страницы и, если есть токен, черновики одной публикации. Возвращает
+// также название публикации для $:/SiteTitle.
+func convertPublication(client *graphql.Client, publicationHost string, opts Options) ([]*tiddlywiki.Tiddler, string, error) {
+	var allTiddlers []*tiddlywiki.Tiddler
+	var publicationTitle string
+
+	// Запускаем цикл пагинации, используя только хост.
 	hasNextPage := true
 	cursor := (*graphql.String)(nil)
 
@@ -150,60 +337,97 @@ func ConvertFromAPI(username, host string) ([]*tiddlywiki.Tiddler, error) {
 		var query publicationByHostQuery
 		err := client.Query(context.Background(), &query, variables)
 		if err != nil {
-			return nil, fmt.Errorf("ошибка при получении постов с хоста '%s': %w", publicationHost, err)
+			return nil, "", fmt.Errorf("ошибка при получении постов с хоста '%s': %w", publicationHost, err)
 		}
-		
+
 		publication := query.Publication
+		publicationTitle = string(publication.Title)
 
 		if len(publication.Posts.Edges) == 0 && len(allTiddlers) == 0 {
-			return nil, fmt.Errorf("на хосте '%s' не найдено постов", publicationHost)
+			return nil, "", fmt.Errorf("на хосте '%s' не найдено постов", publicationHost)
 		}
 
 		for _, edge := range publication.Posts.Edges {
 			post := edge.Node
-			htmlContent := string(markdown.ToHTML([]byte(post.Content.Markdown), nil, nil))
-			postSlug := string(post.Slug)
 			postTitle := string(post.Title)
-			
+
 			var postTags []string
 			for _, tag := range post.Tags {
-				postTags = append(postTags, SanitizeTag(string(tag.Name)))
+				postTags = append(postTags, string(tag.Name))
 			}
-			tagsString := strings.Join(postTags, " ")
-
-			created, _ := time.Parse(time.RFC3339, string(post.PublishedAt))
-			tiddlyTime := created.UTC().Format(tiddlywiki.TiddlyTimeFormat)
-			
-			postTiddler := tiddlywiki.NewTiddler(postTitle, htmlContent, tagsString)
-			postTiddler.Created = tiddlyTime
-			postTiddler.Modified = tiddlyTime
-			postTiddler.Fields["post-slug"] = postSlug
-			
+			postTiddler := newPostTiddler(postTitle, string(post.Content.Markdown), tags.NormalizeList(postTags), string(post.PublishedAt), post.PostMetaGQL)
+			postTiddler.Fields["post-slug"] = string(post.Slug)
+			postTiddler.Fields[tiddlywiki.FieldAuthor] = string(post.Author.Name)
+
 			// ДОБАВЛЕНО: Ссылка на источник
-			sourceURL := fmt.Sprintf("https://%s/%s", publicationHost, postSlug)
-			postTiddler.Fields["source-url"] = sourceURL
-			
+			sourceURL := fmt.Sprintf("https://%s/%s", publicationHost, post.Slug)
+			postTiddler.Fields[tiddlywiki.FieldSourceURL] = sourceURL
+
 			allTiddlers = append(allTiddlers, postTiddler)
 
-			processComments(post.Comments.Edges, postTitle, postSlug, &allTiddlers)
+			comments, err := fetchAllComments(client, string(post.ID), post.Comments)
+			if err != nil {
+				log.Printf("Предупреждение: пост «%s»: %v", postTitle, err)
+			}
+			processComments(comments, postTitle, string(post.Slug), &allTiddlers)
 		}
-		
+
 		hasNextPage = bool(publication.Posts.PageInfo.HasNextPage)
 		cursor = &publication.Posts.PageInfo.EndCursor
 		log.Printf("Загружено %d постов, следующая страница: %v", len(publication.Posts.Edges), hasNextPage)
 	}
 
-	// ДОБАВЛЕНО: Создание системных тиддлеров для заголовка
-	siteTitleTiddler := tiddlywiki.NewTiddler("$:/SiteTitle", "Hashnode", "")
-	siteSubtitleTiddler := tiddlywiki.NewTiddler("$:/SiteSubtitle", publicationHost, "")
-	allTiddlers = append(allTiddlers, siteTitleTiddler, siteSubtitleTiddler)
+	seriesTiddlers, err := fetchSeries(client, publicationHost)
+	if err != nil {
+		log.Printf("Предупреждение: не удалось загрузить серии: %v", err)
+	}
+	allTiddlers = append(allTiddlers, seriesTiddlers...)
 
-	return allTiddlers, nil
+	pageTiddlers, err := fetchStaticPages(client, publicationHost)
+	if err != nil {
+		log.Printf("Предупреждение: не удалось загрузить страницы: %v", err)
+	}
+	allTiddlers = append(allTiddlers, pageTiddlers...)
+
+	if opts.Token != "" {
+		draftTiddlers, err := fetchDrafts(client, publicationHost)
+		if err != nil {
+			log.Printf("Предупреждение: не удалось загрузить черновики: %v", err)
+		}
+		allTiddlers = append(allTiddlers, draftTiddlers...)
+	}
+	return allTiddlers, publicationTitle, nil
+}
+
+// newPostTiddler создает тиддлер поста или черновика из Markdown.
+func newPostTiddler(title, markdownText string, postTags []string, date string, meta PostMetaGQL) *tiddlywiki.Tiddler {
+	htmlContent := string(markdown.ToHTML([]byte(markdownText), nil, nil))
+	created, _ := time.Parse(time.RFC3339, date)
+	tiddlyTime := created.UTC().Format(tiddlywiki.TiddlyTimeFormat)
+
+	postTiddler := tiddlywiki.NewTiddler(title, htmlContent, tiddlywiki.StringifyList(postTags))
+	postTiddler.Created = tiddlyTime
+	postTiddler.Modified = tiddlyTime
+	postTiddler.Fields[tiddlywiki.FieldImportType] = tiddlywiki.ImportTypePost
+	if meta.Subtitle != "" {
+		postTiddler.Fields["subtitle"] = string(meta.Subtitle)
+	}
+	if meta.CoverImage.URL != "" {
+		postTiddler.Fields["cover-image"] = string(meta.CoverImage.URL)
+	}
+	if meta.CanonicalURL != "" {
+		postTiddler.Fields["canonical-url"] = string(meta.CanonicalURL)
+	}
+	if meta.ReadTimeInMinutes > 0 {
+		postTiddler.Fields["reading-time"] = fmt.Sprintf("%d", meta.ReadTimeInMinutes)
+	}
+	return postTiddler
 }
 
-// SanitizeTag остается без изменений
+// SanitizeTag нормализует тег общим нормализатором тегов.
+//
+// Deprecated: конвертер передает исходные имена тегов в tags.NormalizeList;
+// используйте tags.Normalize.
 func SanitizeTag(tag string) string {
-	tag = strings.ReplaceAll(tag, " ", "-")
-	reg := regexp.MustCompile("[^a-zA-Z0-9-]+")
-	return reg.ReplaceAllString(tag, "")
-}
\ No newline at end of file
+	return tags.Normalize(tag)
+}
@@ -0,0 +1,252 @@
+package hashnode
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gomarkdown/markdown"
+	"github.com/shurcooL/graphql"
+	"tiddlywiki-converter/tags"
+	"tiddlywiki-converter/tiddlywiki"
+)
+
+// --- ОСТАЛЬНАЯ ЧАСТЬ ПУБЛИКАЦИИ ---
+// Кроме постов импортируются серии, статические страницы и черновики.
+// Черновики видны только владельцу, поэтому для них нужен токен.
+
+// newClient создает клиент GraphQL. Токен Hashnode передается в заголовке
+// Authorization как есть, без префикса Bearer.
+func newClient(token string) *graphql.Client {
+	var httpClient *http.Client
+	if token != "" {
+		httpClient = &http.Client{
+			Timeout:   60 * time.Second,
+			Transport: &authTransport{token: token, base: http.DefaultTransport},
+		}
+	}
+	return graphql.NewClient("https://gql.hashnode.com/", httpClient)
+}
+
+type authTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", t.token)
+	return t.base.RoundTrip(req)
+}
+
+type SeriesGQL struct {
+	Name        graphql.String
+	Slug        graphql.String
+	Description struct {
+		HTML graphql.String `graphql:"html"`
+	}
+	CoverImage graphql.String
+	Posts      struct {
+		PageInfo PageInfoGQL
+		Edges    []struct {
+			Node struct{ Title graphql.String }
+		}
+	} `graphql:"posts(first: 50)"`
+}
+
+type seriesListQuery struct {
+	Publication struct {
+		SeriesList struct {
+			PageInfo PageInfoGQL
+			Edges    []struct{ Node SeriesGQL }
+		} `graphql:"seriesList(first: 20, after: $after)"`
+	} `graphql:"publication(host: $host)"`
+}
+
+// Дозагрузка постов длинной серии
+type seriesPostsQuery struct {
+	Publication struct {
+		Series struct {
+			Posts struct {
+				PageInfo PageInfoGQL
+				Edges    []struct {
+					Node struct{ Title graphql.String }
+				}
+			} `graphql:"posts(first: 50, after: $after)"`
+		} `graphql:"series(slug: $slug)"`
+	} `graphql:"publication(host: $host)"`
+}
+
+type staticPagesQuery struct {
+	Publication struct {
+		StaticPages struct {
+			PageInfo PageInfoGQL
+			Edges    []struct {
+				Node struct {
+					ID      graphql.String
+					Title   graphql.String
+					Slug    graphql.String
+					Content struct{ Markdown graphql.String }
+				}
+			}
+		} `graphql:"staticPages(first: 20, after: $after)"`
+	} `graphql:"publication(host: $host)"`
+}
+
+type draftsQuery struct {
+	Publication struct {
+		Drafts struct {
+			PageInfo PageInfoGQL
+			Edges    []struct {
+				Node struct {
+					ID      graphql.String
+					Title   graphql.String
+					Slug    graphql.String
+					Content struct{ Markdown graphql.String }
+					PostMetaGQL
+					UpdatedAt graphql.String
+					Author    struct{ Name graphql.String }
+					Tags      []struct{ Name graphql.String }
+				}
+			}
+		} `graphql:"drafts(first: 20, after: $after)"`
+	} `graphql:"publication(host: $host)"`
+}
+
+// fetchSeries создает по тиддлеру на серию. Порядок постов серии хранится
+// в поле list, поэтому [list[Серия]] выдает посты в авторском порядке.
+func fetchSeries(client *graphql.Client, host string) ([]*tiddlywiki.Tiddler, error) {
+	var tiddlers []*tiddlywiki.Tiddler
+	var cursor *graphql.String
+	for {
+		var query seriesListQuery
+		variables := map[string]interface{}{"host": graphql.String(host), "after": cursor}
+		if err := client.Query(context.Background(), &query, variables); err != nil {
+			return tiddlers, err
+		}
+		list := query.Publication.SeriesList
+		for _, edge := range list.Edges {
+			series := edge.Node
+			titles, err := seriesPostTitles(client, host, series)
+			if err != nil {
+				log.Printf("Предупреждение: серия «%s»: %v", series.Name, err)
+			}
+			seriesTiddler := tiddlywiki.NewTiddler(string(series.Name),
+				string(series.Description.HTML)+"\n\n<<list-links filter:\"[list<currentTiddler>]\">>", "series")
+			seriesTiddler.Fields["list"] = tiddlywiki.StringifyList(titles)
+			seriesTiddler.Fields["series-slug"] = string(series.Slug)
+			seriesTiddler.Fields[tiddlywiki.FieldImportType] = tiddlywiki.ImportTypeSeries
+			seriesTiddler.Fields[tiddlywiki.FieldSourceURL] = fmt.Sprintf("https://%s/series/%s", host, series.Slug)
+			if series.CoverImage != "" {
+				seriesTiddler.Fields["cover-image"] = string(series.CoverImage)
+			}
+			tiddlers = append(tiddlers, seriesTiddler)
+		}
+		if !bool(list.PageInfo.HasNextPage) {
+			break
+		}
+		cursor = &list.PageInfo.EndCursor
+	}
+	log.Printf("Загружено серий: %d", len(tiddlers))
+	return tiddlers, nil
+}
+
+func seriesPostTitles(client *graphql.Client, host string, series SeriesGQL) ([]string, error) {
+	var titles []string
+	for _, edge := range series.Posts.Edges {
+		titles = append(titles, string(edge.Node.Title))
+	}
+	pageInfo := series.Posts.PageInfo
+	for pageInfo.HasNextPage {
+		var query seriesPostsQuery
+		variables := map[string]interface{}{
+			"host":  graphql.String(host),
+			"slug":  series.Slug,
+			"after": &pageInfo.EndCursor,
+		}
+		if err := client.Query(context.Background(), &query, variables); err != nil {
+			return titles, err
+		}
+		posts := query.Publication.Series.Posts
+		for _, edge := range posts.Edges {
+			titles = append(titles, string(edge.Node.Title))
+		}
+		pageInfo = posts.PageInfo
+	}
+	return titles, nil
+}
+
+// fetchStaticPages импортирует статические страницы публикации («О блоге» и т.п.).
+func fetchStaticPages(client *graphql.Client, host string) ([]*tiddlywiki.Tiddler, error) {
+	var tiddlers []*tiddlywiki.Tiddler
+	var cursor *graphql.String
+	for {
+		var query staticPagesQuery
+		variables := map[string]interface{}{"host": graphql.String(host), "after": cursor}
+		if err := client.Query(context.Background(), &query, variables); err != nil {
+			return tiddlers, err
+		}
+		pages := query.Publication.StaticPages
+		for _, edge := range pages.Edges {
+			page := edge.Node
+			htmlContent := string(markdown.ToHTML([]byte(page.Content.Markdown), nil, nil))
+			pageTiddler := tiddlywiki.NewTiddler(string(page.Title), htmlContent, "page")
+			pageTiddler.Fields[tiddlywiki.FieldImportType] = tiddlywiki.ImportTypePage
+			pageTiddler.Fields[tiddlywiki.FieldSourceURL] = fmt.Sprintf("https://%s/%s", host, page.Slug)
+			pageTiddler.Fields["page-id"] = string(page.ID)
+			pageTiddler.Fields["post-slug"] = string(page.Slug)
+			tiddlers = append(tiddlers, pageTiddler)
+		}
+		if !bool(pages.PageInfo.HasNextPage) {
+			break
+		}
+		cursor = &pages.PageInfo.EndCursor
+	}
+	log.Printf("Загружено страниц: %d", len(tiddlers))
+	return tiddlers, nil
+}
+
+// fetchDrafts импортирует черновики. Даты публикации у них нет,
+// поэтому created берется из времени последнего изменения.
+func fetchDrafts(client *graphql.Client, host string) ([]*tiddlywiki.Tiddler, error) {
+	var tiddlers []*tiddlywiki.Tiddler
+	var cursor *graphql.String
+	for {
+		var query draftsQuery
+		variables := map[string]interface{}{"host": graphql.String(host), "after": cursor}
+		if err := client.Query(context.Background(), &query, variables); err != nil {
+			if strings.Contains(err.Error(), "UNAUTHENTICATED") || strings.Contains(err.Error(), "FORBIDDEN") {
+				return tiddlers, fmt.Errorf("%w (проверьте токен HASHNODE_TOKEN)", err)
+			}
+			return tiddlers, err
+		}
+		drafts := query.Publication.Drafts
+		for _, edge := range drafts.Edges {
+			draft := edge.Node
+			var draftTags []string
+			for _, tag := range draft.Tags {
+				draftTags = append(draftTags, string(tag.Name))
+			}
+			draftTags = append(tags.NormalizeList(draftTags), "draft")
+			title := string(draft.Title)
+			if title == "" {
+				title = fmt.Sprintf("Черновик %s", draft.ID)
+			}
+			draftTiddler := newPostTiddler(title, string(draft.Content.Markdown), draftTags, string(draft.UpdatedAt), draft.PostMetaGQL)
+			draftTiddler.Fields[tiddlywiki.FieldImportType] = tiddlywiki.ImportTypeDraft
+			draftTiddler.Fields["post-slug"] = string(draft.Slug)
+			draftTiddler.Fields["draft-id"] = string(draft.ID)
+			draftTiddler.Fields[tiddlywiki.FieldAuthor] = string(draft.Author.Name)
+			tiddlers = append(tiddlers, draftTiddler)
+		}
+		if !bool(drafts.PageInfo.HasNextPage) {
+			break
+		}
+		cursor = &drafts.PageInfo.EndCursor
+	}
+	log.Printf("Загружено черновиков: %d", len(tiddlers))
+	return tiddlers, nil
+}
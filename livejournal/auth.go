@@ -0,0 +1,203 @@
+package livejournal
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// =============================================================================
+// АВТОРИЗАЦИЯ
+// =============================================================================
+//
+// Анонимно видны только публичные записи. Записи для друзей и личные
+// доступны двумя способами:
+//   - куки браузера (cookies.txt или значение сессии) - страницы журнала
+//     загружаются так, как их видит владелец;
+//   - протокол экспорта XML-RPC (getevents, getcomments) с логином и паролем.
+// Протокол поддерживают и другие сайты на движке ЖЖ (Dreamwidth,
+// InsaneJournal), их адрес задается в Host.
+
+// Options - настройки импорта из LiveJournal.
+type Options struct {
+	// CookiesPath - файл cookies.txt в формате Netscape, экспортированный из браузера.
+	CookiesPath string
+	// Session - куки сессии строкой "ljmastersession=...; ljloggedin=...".
+	// Значение без имени считается кукой ljsession.
+	Session string
+	// Username и Password нужны для протокола XML-RPC.
+	Username string
+	Password string
+	// Protocol включает импорт через XML-RPC вместо чтения страниц.
+	Protocol bool
+	// Host - сервер протокола: www.livejournal.com (по умолчанию), www.dreamwidth.org,
+	// www.insanejournal.com или полный адрес, например http://127.0.0.1:8080.
+	Host string
+	// From и To ограничивают импорт записями за период: From включительно,
+	// To не включительно. Нулевое значение - без ограничения.
+	From time.Time
+	To   time.Time
+}
+
+// OptionsFromMap читает ключи lj_cookies, lj_protocol, lj_host, lj_from и lj_to.
+// Секреты берутся из ключей lj_session, lj_username, lj_password или из
+// переменных окружения LJ_SESSION, LJ_USERNAME, LJ_PASSWORD.
+func OptionsFromMap(config map[string]string) (Options, error) {
+	get := func(key, env string) string {
+		if v := strings.TrimSpace(config[key]); v != "" {
+			return v
+		}
+		return strings.TrimSpace(os.Getenv(env))
+	}
+	opts := Options{
+		CookiesPath: strings.TrimSpace(config["lj_cookies"]),
+		Session:     get("lj_session", "LJ_SESSION"),
+		Username:    get("lj_username", "LJ_USERNAME"),
+		Password:    get("lj_password", "LJ_PASSWORD"),
+		Protocol:    config["lj_protocol"] == "true",
+		Host:        strings.TrimSpace(config["lj_host"]),
+	}
+	var err error
+	if opts.From, err = parseDateBound(config["lj_from"], false); err != nil {
+		return opts, fmt.Errorf("lj_from: %w", err)
+	}
+	if opts.To, err = parseDateBound(config["lj_to"], true); err != nil {
+		return opts, fmt.Errorf("lj_to: %w", err)
+	}
+	if !opts.From.IsZero() && !opts.To.IsZero() && !opts.From.Before(opts.To) {
+		return opts, fmt.Errorf("lj_from (%s) должна быть раньше lj_to", config["lj_from"])
+	}
+	return opts, nil
+}
+
+// dateRange возвращает период импорта.
+func (o Options) dateRange() dateRange {
+	return dateRange{From: o.From, To: o.To}
+}
+
+// endpoint возвращает адрес интерфейса XML-RPC.
+func (o Options) endpoint() string {
+	host := o.Host
+	if host == "" {
+		host = "www.livejournal.com"
+	}
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+	return strings.TrimSuffix(host, "/") + "/interface/xmlrpc"
+}
+
+// newHTTPClient создает клиент, общий для всех запросов импорта.
+// Куки из файла и сессии кладутся в его хранилище.
+func newHTTPClient(pageURL string, opts Options) (*http.Client, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	if opts.CookiesPath == "" && opts.Session == "" {
+		return client, nil
+	}
+	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	if err != nil {
+		return nil, err
+	}
+	client.Jar = jar
+	if opts.CookiesPath != "" {
+		count, err := loadCookiesFile(jar, opts.CookiesPath)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Загружено кук из %s: %d", opts.CookiesPath, count)
+	}
+	if opts.Session != "" {
+		if err := setSessionCookies(jar, pageURL, opts.Session); err != nil {
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// loadCookiesFile читает cookies.txt (Netscape): домен, флаг поддоменов,
+// путь, secure, срок действия, имя, значение - через табуляцию.
+// Строки с префиксом #HttpOnly_ - обычные куки с флагом HttpOnly.
+func loadCookiesFile(jar http.CookieJar, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка открытия файла кук: %w", err)
+	}
+	defer f.Close()
+
+	count := 0
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := strings.HasPrefix(line, "#HttpOnly_")
+		line = strings.TrimPrefix(line, "#HttpOnly_")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return count, fmt.Errorf("%s:%d: ожидается 7 полей через табуляцию", path, lineNo)
+		}
+		domain := fields[0]
+		host := strings.TrimPrefix(domain, ".")
+		cookie := &http.Cookie{
+			Name:     fields[5],
+			Value:    fields[6],
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			HttpOnly: httpOnly,
+		}
+		// Кука для домена с поддоменами: .livejournal.com подходит и user.livejournal.com.
+		if strings.HasPrefix(domain, ".") || strings.EqualFold(fields[1], "TRUE") {
+			cookie.Domain = host
+		}
+		if expires, err := strconv.ParseInt(fields[4], 10, 64); err == nil && expires > 0 {
+			cookie.Expires = time.Unix(expires, 0)
+		}
+		jar.SetCookies(&url.URL{Scheme: "https", Host: host, Path: "/"}, []*http.Cookie{cookie})
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return count, fmt.Errorf("ошибка чтения файла кук: %w", err)
+	}
+	return count, nil
+}
+
+// setSessionCookies устанавливает куки сессии для домена сервиса,
+// чтобы они отправлялись на страницы всех журналов.
+func setSessionCookies(jar http.CookieJar, pageURL, session string) error {
+	u, err := url.Parse(pageURL)
+	if err != nil || u.Hostname() == "" {
+		return fmt.Errorf("не удалось определить домен для кук сессии по адресу %q", pageURL)
+	}
+	domain, cookieDomain := newMarkupContext(pageURL).Domain, ""
+	if net.ParseIP(u.Hostname()) != nil {
+		// Локальный сервер по IP: куки только для этого адреса.
+		domain = u.Hostname()
+	} else {
+		cookieDomain = domain
+	}
+	var cookies []*http.Cookie
+	for _, part := range strings.Split(session, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			name, value = "ljsession", part
+		}
+		cookies = append(cookies, &http.Cookie{Name: strings.TrimSpace(name), Value: strings.TrimSpace(value), Path: "/", Domain: cookieDomain})
+	}
+	jar.SetCookies(&url.URL{Scheme: "https", Host: domain, Path: "/"}, cookies)
+	return nil
+}
@@ -0,0 +1,66 @@
+package livejournal
+
+import (
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+func cookieNames(jar *cookiejar.Jar, rawURL string) string {
+	u, _ := url.Parse(rawURL)
+	var names []string
+	for _, c := range jar.Cookies(u) {
+		names = append(names, c.Name+"="+c.Value)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestLoadCookiesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.txt")
+	data := strings.Join([]string{
+		"# Netscape HTTP Cookie File",
+		"",
+		".livejournal.com\tTRUE\t/\tTRUE\t0\tljloggedin\tu1",
+		"#HttpOnly_.livejournal.com\tTRUE\t/\tTRUE\t4102444800\tljmastersession\tv2",
+		"www.livejournal.com\tFALSE\t/\tFALSE\t0\tlangpref\tru\r",
+		".example.com\tTRUE\t/\tFALSE\t0\tother\tx",
+	}, "\n")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	count, err := loadCookiesFile(jar, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 4 {
+		t.Errorf("загружено кук: %d, ожидается 4", count)
+	}
+	// Куки домена с поддоменами видны журналу, куки хоста www - нет.
+	if got := cookieNames(jar, "https://user.livejournal.com/"); got != "ljloggedin=u1,ljmastersession=v2" {
+		t.Errorf("куки для журнала: %q", got)
+	}
+	if got := cookieNames(jar, "https://www.livejournal.com/"); !strings.Contains(got, "langpref=ru") {
+		t.Errorf("куки для www: %q", got)
+	}
+	if got := cookieNames(jar, "https://user.example.org/"); got != "" {
+		t.Errorf("куки не должны уходить на другой домен: %q", got)
+	}
+}
+
+func TestLoadCookiesFileMalformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.txt")
+	if err := os.WriteFile(path, []byte("# comment\n.livejournal.com TRUE / TRUE 0 name value\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	jar, _ := cookiejar.New(nil)
+	_, err := loadCookiesFile(jar, path)
+	if err == nil || !strings.Contains(err.Error(), ":2:") {
+		t.Errorf("ожидается ошибка с номером строки 2, получено: %v", err)
+	}
+}
@@ -0,0 +1,311 @@
+package livejournal
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"tiddlywiki-converter/tiddlywiki"
+)
+
+// =============================================================================
+// ИМПОРТ РЕЗЕРВНЫХ КОПИЙ (ljdump, ljArchive)
+// =============================================================================
+//
+// ljdump сохраняет каждую запись в файл L-<itemid>, а ее комментарии -
+// в C-<itemid>; поля записи совпадают с ответом getevents. ljArchive хранит
+// весь журнал в одном XML-файле (.lja) с таблицами Events, Comments и Users.
+// Оба формата разбираются без обращения к сети, тиддлеры собираются теми же
+// функциями, что и при загрузке со страниц, поэтому заголовки комментариев
+// (<пост>-comment-<dtalkid>) совпадают с онлайн-импортом.
+
+// ConvertFromBackup импортирует каталог ljdump или файл ljArchive.
+func ConvertFromBackup(path string) ([]*tiddlywiki.Tiddler, error) {
+	return ConvertFromBackupWithOptions(path, Options{})
+}
+
+// ConvertFromBackupWithOptions - то же с ограничением периода From - To;
+// остальные настройки для резервной копии не нужны.
+func ConvertFromBackupWithOptions(path string, opts Options) ([]*tiddlywiki.Tiddler, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("резервная копия не найдена: %w", err)
+	}
+	var tiddlers []*tiddlywiki.Tiddler
+	var journal string
+	if info.IsDir() {
+		log.Printf("Импорт каталога ljdump: %s", path)
+		tiddlers, journal, err = convertLJDump(path, opts.dateRange())
+	} else {
+		log.Printf("Импорт файла ljArchive: %s", path)
+		tiddlers, journal, err = convertLJArchive(path, opts.dateRange())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if journal != "" {
+		tiddlers = append([]*tiddlywiki.Tiddler{
+			tiddlywiki.NewTiddler("$:/SiteTitle", journal, ""),
+			tiddlywiki.NewTiddler("$:/DefaultTiddlers", "[list[$:/StoryList]]", ""),
+		}, tiddlers...)
+	}
+	log.Printf("Конвертация завершена. Всего создано тиддлеров: %d", len(tiddlers))
+	return tiddlers, nil
+}
+
+// xmlNode - элемент XML произвольной структуры.
+type xmlNode struct {
+	XMLName  xml.Name
+	Content  string    `xml:",chardata"`
+	Children []xmlNode `xml:",any"`
+}
+
+// toMap превращает элемент в map по именам дочерних элементов (в нижнем
+// регистре), как в ответах протокола; элемент без детей - строка.
+func (n xmlNode) toMap() interface{} {
+	if len(n.Children) == 0 {
+		return n.Content
+	}
+	m := make(map[string]interface{}, len(n.Children))
+	for _, c := range n.Children {
+		m[strings.ToLower(c.XMLName.Local)] = c.toMap()
+	}
+	return m
+}
+
+func readXMLNode(path string) (*xmlNode, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var root xmlNode
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	// ljdump пишет файлы в UTF-8; декларация другой кодировки не должна прерывать импорт.
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) { return input, nil }
+	if err := decoder.Decode(&root); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &root, nil
+}
+
+// --- ljdump ---
+
+// convertLJDump читает файлы L-* и C-* (в том числе во вложенных каталогах
+// сервер/пользователь, как их создает ljdump). Имя журнала - имя каталога с записями.
+func convertLJDump(dir string, dates dateRange) ([]*tiddlywiki.Tiddler, string, error) {
+	type entryFile struct {
+		itemID int64
+		path   string
+	}
+	var entries []entryFile
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() || !strings.HasPrefix(name, "L-") {
+			return nil
+		}
+		if id, err := strconv.ParseInt(strings.TrimPrefix(name, "L-"), 10, 64); err == nil {
+			entries = append(entries, entryFile{itemID: id, path: path})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if len(entries) == 0 {
+		return nil, "", fmt.Errorf("в каталоге %s нет файлов записей ljdump (L-*)", dir)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].itemID < entries[j].itemID })
+	log.Printf("Найдено записей: %d", len(entries))
+
+	var allTiddlers []*tiddlywiki.Tiddler
+	titles := make(postTitles)
+	for _, entry := range entries {
+		root, err := readXMLNode(entry.path)
+		if err != nil {
+			log.Printf("! Ошибка чтения записи: %v", err)
+			continue
+		}
+		event, _ := root.toMap().(map[string]interface{})
+		if event == nil {
+			continue
+		}
+		anum := jsonInt(event["anum"])
+		post := postFromEvent(event, entry.itemID*256+anum)
+		if !dates.contains(post.Published) {
+			continue
+		}
+
+		var comments []ljComment
+		commentsPath := filepath.Join(filepath.Dir(entry.path), fmt.Sprintf("C-%d", entry.itemID))
+		if _, err := os.Stat(commentsPath); err == nil {
+			comments, err = readLJDumpComments(commentsPath, anum, post.URL)
+			if err != nil {
+				log.Printf("! Ошибка чтения комментариев: %v", err)
+			}
+		}
+		if post.CommentCount == 0 {
+			post.CommentCount = len(comments)
+		}
+		titles.claim(post, entry.itemID*256+anum)
+		allTiddlers = append(allTiddlers, newPostTiddler(post))
+		allTiddlers = append(allTiddlers, buildCommentTiddlers(comments, post.Title)...)
+	}
+	return allTiddlers, filepath.Base(filepath.Dir(entries[0].path)), nil
+}
+
+// readLJDumpComments читает C-<itemid>. ljdump хранит номер комментария
+// внутри журнала (jtalkid); в ссылках и заголовках используется
+// dtalkid = jtalkid*256 + anum записи.
+func readLJDumpComments(path string, anum int64, postURL string) ([]ljComment, error) {
+	root, err := readXMLNode(path)
+	if err != nil {
+		return nil, err
+	}
+	var comments []ljComment
+	for _, node := range root.Children {
+		if node.XMLName.Local != "comment" {
+			continue
+		}
+		fields, _ := node.toMap().(map[string]interface{})
+		comment := backupComment(fields, anum, postURL)
+		comment.Author = rpcString(fields["user"])
+		if comment.ID != 0 {
+			comments = append(comments, comment)
+		}
+	}
+	return comments, nil
+}
+
+// backupComment собирает комментарий из полей id, parentid, subject, body,
+// date и state, общих для ljdump и ljArchive.
+func backupComment(fields map[string]interface{}, anum int64, postURL string) ljComment {
+	jtalkid := jsonInt(fields["id"])
+	if jtalkid == 0 {
+		return ljComment{}
+	}
+	comment := ljComment{ID: jtalkid*256 + anum, Loaded: true}
+	if parent := jsonInt(fields["parentid"]); parent != 0 {
+		comment.Parent = parent*256 + anum
+	}
+	if t, ok := parseEntryTime(rpcString(fields["date"])); ok {
+		comment.CtimeTS = t.Unix()
+	}
+	if postURL != "" {
+		comment.ThreadURL = fmt.Sprintf("%s?thread=%d#t%d", postURL, comment.ID, comment.ID)
+	}
+	comment.Deleted = rpcString(fields["state"]) == "D"
+	if !comment.Deleted {
+		body := strings.ReplaceAll(rpcString(fields["body"]), "\n", "<br>\n")
+		if subject := rpcString(fields["subject"]); subject != "" {
+			body = "<b>" + subject + "</b><br>\n" + body
+		}
+		comment.Article = &body
+	}
+	return comment
+}
+
+// --- ljArchive ---
+
+// convertLJArchive читает XML ljArchive. Поля таблицы Events переводятся
+// в имена протокола, после чего запись собирается как событие getevents.
+// Колонки названы в PascalCase (CurrentMood, CurrentMusic, PosterID) и читаются
+// в нижнем регистре; настроение может быть задано и ссылкой CurrentMoodID
+// на таблицу Moods.
+func convertLJArchive(path string, dates dateRange) ([]*tiddlywiki.Tiddler, string, error) {
+	root, err := readXMLNode(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var username, server string
+	users := make(map[int64]string)
+	moods := make(map[int64]string)
+	commentsByItem := make(map[int64][]map[string]interface{})
+	var events []map[string]interface{}
+	for _, node := range root.Children {
+		fields, _ := node.toMap().(map[string]interface{})
+		if fields == nil {
+			continue
+		}
+		switch node.XMLName.Local {
+		case "Options":
+			username = rpcString(fields["username"])
+			server = rpcString(fields["serverurl"])
+		case "Users":
+			users[jsonInt(fields["id"])] = rpcString(fields["user"])
+		case "Moods":
+			moods[jsonInt(fields["id"])] = rpcString(fields["name"])
+		case "Comments":
+			itemID := jsonInt(fields["itemid"])
+			commentsByItem[itemID] = append(commentsByItem[itemID], fields)
+		case "Events":
+			events = append(events, fields)
+		}
+	}
+	if len(events) == 0 {
+		return nil, "", fmt.Errorf("в файле %s нет записей ljArchive (Events)", path)
+	}
+	sort.Slice(events, func(i, j int) bool { return jsonInt(events[i]["id"]) < jsonInt(events[j]["id"]) })
+	log.Printf("Найдено записей: %d", len(events))
+
+	var allTiddlers []*tiddlywiki.Tiddler
+	titles := make(postTitles)
+	for _, fields := range events {
+		itemID := jsonInt(fields["id"])
+		anum := jsonInt(fields["anum"])
+		ditemid := itemID*256 + anum
+		event := map[string]interface{}{
+			"subject":   fields["subject"],
+			"event":     fields["body"],
+			"eventtime": fields["date"],
+			"security":  fields["security"],
+			"allowmask": fields["allowmask"],
+			"props": map[string]interface{}{
+				"current_mood":  firstNonEmpty(rpcString(fields["currentmood"]), moods[jsonInt(fields["currentmoodid"])]),
+				"current_music": fields["currentmusic"],
+				"taglist":       fields["tags"],
+			},
+		}
+		if username != "" {
+			event["url"] = archiveEntryURL(server, username, ditemid)
+		}
+		post := postFromEvent(event, ditemid)
+		if !dates.contains(post.Published) {
+			continue
+		}
+
+		var comments []ljComment
+		for _, commentFields := range commentsByItem[itemID] {
+			comment := backupComment(commentFields, anum, post.URL)
+			comment.Author = users[jsonInt(commentFields["posterid"])]
+			if comment.ID != 0 {
+				comments = append(comments, comment)
+			}
+		}
+		post.CommentCount = len(comments)
+		titles.claim(post, ditemid)
+		allTiddlers = append(allTiddlers, newPostTiddler(post))
+		allTiddlers = append(allTiddlers, buildCommentTiddlers(comments, post.Title)...)
+	}
+	return allTiddlers, username, nil
+}
+
+// archiveEntryURL восстанавливает адрес записи: ljArchive хранит только
+// адрес сервера (http://www.livejournal.com) и имя пользователя.
+func archiveEntryURL(server, username string, ditemid int64) string {
+	domain := "livejournal.com"
+	if server != "" {
+		domain = newMarkupContext(server).Domain
+	}
+	return fmt.Sprintf("https://%s.%s/%d.html", strings.ReplaceAll(username, "_", "-"), domain, ditemid)
+}
@@ -0,0 +1,350 @@
+package livejournal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"tiddlywiki-converter/tiddlywiki"
+)
+
+// =============================================================================
+// КАЛЕНДАРЬ ЖУРНАЛА
+// =============================================================================
+//
+// Вместо перебора всех месяцев с 1999 года читаем /calendar (список лет,
+// в которых есть записи) и календарь каждого года (дни с записями).
+// Обходятся только месяцы, где записи действительно есть.
+
+const userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36"
+
+// calendarDay - день с записями и число записей в нем по календарю.
+type calendarDay struct {
+	Day     int
+	Entries int
+}
+
+// journalCalendar - дни с записями: год -> месяц -> дни по возрастанию.
+// Failed - годы, календарь которых загрузить не удалось.
+type journalCalendar struct {
+	Days   map[int]map[int][]calendarDay
+	Failed map[int]bool
+}
+
+var (
+	yearLinkPattern = regexp.MustCompile(`^/(\d{4})/?$`)
+	dayLinkPattern  = regexp.MustCompile(`^/(\d{4})/(\d{2})/(\d{2})/?$`)
+	numberPattern   = regexp.MustCompile(`\d+`)
+	// На странице профиля: "Journal created: 12 March 2004" / "Создан: 12 марта 2004".
+	profileCreatedPattern = regexp.MustCompile(`(?i)(?:journal created|created on|создан[оа]?)\D{0,40}?(?:\d{1,2}\D{1,20}?)?(\d{4})`)
+)
+
+// fetchHTML загружает страницу журнала с заголовком браузера.
+func fetchHTML(pageURL string, client *http.Client) ([]byte, error) {
+	req, err := http.NewRequest("GET", pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("статус %d при запросе %s", resp.StatusCode, pageURL)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// journalLinks вызывает fn для путей всех ссылок страницы, ведущих в тот же журнал.
+// Для сообщества по пути (/community/name) путь передается без этого префикса.
+func journalLinks(body []byte, base *url.URL, fn func(path string)) error {
+	return journalAnchors(body, base, func(path string, _ *html.Node) { fn(path) })
+}
+
+// journalAnchors - то же, что journalLinks, но передает и сам элемент ссылки.
+func journalAnchors(body []byte, base *url.URL, fn func(path string, a *html.Node)) error {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "a" {
+			if href := getAttr(n, "href"); href != "" {
+				if u, err := base.Parse(href); err == nil && inJournal(base, u.String()) {
+					fn(strings.TrimPrefix(u.Path, base.Path), n)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return nil
+}
+
+// discoverYears возвращает годы с записями по странице /calendar.
+// Если календарь недоступен, год создания журнала берется из профиля,
+// и перебираются все годы от него до текущего.
+func discoverYears(baseURL string, client *http.Client) ([]int, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[int]bool)
+	var years []int
+	body, err := fetchHTML(baseURL+"/calendar", client)
+	if err == nil {
+		journalLinks(body, base, func(path string) {
+			if m := yearLinkPattern.FindStringSubmatch(path); m != nil {
+				year, _ := strconv.Atoi(m[1])
+				if !seen[year] {
+					seen[year] = true
+					years = append(years, year)
+				}
+			}
+		})
+	} else {
+		log.Printf("   ! Календарь недоступен: %v", err)
+	}
+	if len(years) > 0 {
+		sort.Ints(years)
+		return years, nil
+	}
+
+	startYear, err := getBlogStartYear(baseURL, client)
+	if err != nil {
+		// LiveJournal открылся в 1999 году, раньше записей быть не может.
+		log.Printf("   ! Год создания журнала не определен (%v), перебор начинается с 1999 года.", err)
+		startYear = 1999
+	}
+	for year := startYear; year <= time.Now().Year(); year++ {
+		years = append(years, year)
+	}
+	return years, nil
+}
+
+// getBlogStartYear определяет год создания журнала по странице профиля.
+func getBlogStartYear(baseURL string, client *http.Client) (int, error) {
+	body, err := fetchHTML(baseURL+"/profile", client)
+	if err != nil {
+		return 0, fmt.Errorf("не удалось загрузить профиль: %w", err)
+	}
+	m := profileCreatedPattern.FindSubmatch(body)
+	if m == nil {
+		return 0, fmt.Errorf("в профиле не найдена дата создания журнала")
+	}
+	year, _ := strconv.Atoi(string(m[1]))
+	if year < 1999 || year > time.Now().Year() {
+		return 0, fmt.Errorf("некорректный год создания журнала: %d", year)
+	}
+	log.Printf("Журнал создан в %d году (по профилю).", year)
+	return year, nil
+}
+
+// discoverCalendar читает календари перечисленных лет и собирает дни с записями.
+// Год, календарь которого не загрузился, отмечается в Failed.
+func discoverCalendar(baseURL string, years []int, client *http.Client) (journalCalendar, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return journalCalendar{}, err
+	}
+	calendar := journalCalendar{Days: make(map[int]map[int][]calendarDay), Failed: make(map[int]bool)}
+	for _, year := range years {
+		body, err := fetchHTML(fmt.Sprintf("%s/%d/", baseURL, year), client)
+		if err != nil {
+			log.Printf("   ! Календарь за %d год недоступен: %v", year, err)
+			calendar.Failed[year] = true
+			continue
+		}
+		seen := make(map[string]bool)
+		journalAnchors(body, base, func(path string, a *html.Node) {
+			m := dayLinkPattern.FindStringSubmatch(path)
+			if m == nil || seen[path] {
+				return
+			}
+			seen[path] = true
+			y, _ := strconv.Atoi(m[1])
+			month, _ := strconv.Atoi(m[2])
+			day, _ := strconv.Atoi(m[3])
+			if y != year || month < 1 || month > 12 {
+				return
+			}
+			if calendar.Days[y] == nil {
+				calendar.Days[y] = make(map[int][]calendarDay)
+			}
+			calendar.Days[y][month] = append(calendar.Days[y][month], calendarDay{Day: day, Entries: dayEntryCount(a, day)})
+		})
+	}
+	for _, months := range calendar.Days {
+		for _, days := range months {
+			sort.Slice(days, func(i, j int) bool { return days[i].Day < days[j].Day })
+		}
+	}
+	return calendar, nil
+}
+
+// dayEntryCount определяет число записей дня по ячейке календаря. В разных
+// стилях оформления ссылкой бывает номер дня или число записей ("5 (3)",
+// "<b>5</b> <a>3</a>"), поэтому из чисел ячейки исключается номер дня.
+// Если числа нет, считается, что запись одна.
+func dayEntryCount(a *html.Node, day int) int {
+	cell := a.Parent
+	for n := a.Parent; n != nil; n = n.Parent {
+		if n.Type == html.ElementNode && (n.Data == "td" || n.Data == "li") {
+			cell = n
+			break
+		}
+	}
+	if cell == nil {
+		return 1
+	}
+	// Числа ищутся в каждом текстовом узле отдельно: "<b>5</b><a>3</a>" - это 5 и 3, а не 53.
+	var numbers []string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			numbers = append(numbers, numberPattern.FindAllString(n.Data, -1)...)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(cell)
+	dayFound := false
+	for _, s := range numbers {
+		n, _ := strconv.Atoi(s)
+		if n == day && !dayFound {
+			dayFound = true
+			continue
+		}
+		if n > 0 {
+			return n
+		}
+	}
+	return 1
+}
+
+// crawlCalendarOrMonths обходит месяцы календаря. Если календарь не дал
+// ни одного дня (другая схема оформления, закрытый календарь), перебираются
+// все месяцы указанных лет, как раньше; так же обходятся годы, календарь
+// которых не загрузился. Месяцы вне периода dates пропускаются.
+func crawlCalendarOrMonths(baseURL string, years []int, calendar journalCalendar, dates dateRange, client *http.Client) []*tiddlywiki.Tiddler {
+	walkAll := len(calendar.Days) == 0
+	if walkAll {
+		log.Printf("   ! В календаре не найдено дней с записями, перебираются все месяцы.")
+	}
+	var allTiddlers []*tiddlywiki.Tiddler
+	for _, year := range years {
+		if walkAll || calendar.Failed[year] {
+			allTiddlers = append(allTiddlers, crawlAllMonths(baseURL, year, dates, client)...)
+			continue
+		}
+		allTiddlers = append(allTiddlers, crawlYear(baseURL, year, calendar.Days[year], dates, client)...)
+	}
+	return allTiddlers
+}
+
+// crawlAllMonths перебирает все месяцы года без календаря.
+func crawlAllMonths(baseURL string, year int, dates dateRange, client *http.Client) []*tiddlywiki.Tiddler {
+	log.Printf("==> Обрабатывается год: %d (все месяцы)", year)
+	var allTiddlers []*tiddlywiki.Tiddler
+	for month := 1; month <= 12; month++ {
+		if start := monthStart(year, month); !dates.overlaps(start, start.AddDate(0, 1, 0)) {
+			continue
+		}
+		monthlyURL := fmt.Sprintf("%s/%d/%02d/", baseURL, year, month)
+		log.Printf("-> Обрабатывается месяц: %s", monthlyURL)
+		archiveTiddlers, err := processArchivePage(monthlyURL, dates, client)
+		if err != nil {
+			log.Printf("   ! Ошибка обработки месяца %s (возможно, его не существует): %v", monthlyURL, err)
+			continue
+		}
+		allTiddlers = append(allTiddlers, archiveTiddlers...)
+	}
+	return allTiddlers
+}
+
+// crawlYear обходит месяцы года с записями по порядку.
+func crawlYear(baseURL string, year int, calendar map[int][]calendarDay, dates dateRange, client *http.Client) []*tiddlywiki.Tiddler {
+	var months []int
+	for month := range calendar {
+		if start := monthStart(year, month); dates.overlaps(start, start.AddDate(0, 1, 0)) {
+			months = append(months, month)
+		}
+	}
+	sort.Ints(months)
+	log.Printf("==> Обрабатывается год: %d (месяцев с записями: %d)", year, len(months))
+	var allTiddlers []*tiddlywiki.Tiddler
+	for _, month := range months {
+		allTiddlers = append(allTiddlers, crawlMonth(baseURL, year, month, calendar[month], dates, client)...)
+	}
+	return allTiddlers
+}
+
+// crawlMonth собирает ссылки на посты месяца. Архив месяца показывает
+// ограниченное число записей; если ссылок меньше, чем записей по календарю,
+// архив заведомо неполон, и ссылки собираются по архивам дней.
+// Если период захватывает месяц частично, сразу обходятся только дни периода.
+func crawlMonth(baseURL string, year, month int, days []calendarDay, dates dateRange, client *http.Client) []*tiddlywiki.Tiddler {
+	monthlyURL := fmt.Sprintf("%s/%d/%02d/", baseURL, year, month)
+	var postURLs []string
+	if start := monthStart(year, month); dates.covers(start, start.AddDate(0, 1, 0)) {
+		log.Printf("-> Обрабатывается месяц: %s", monthlyURL)
+		var err error
+		if postURLs, err = collectPostURLs(monthlyURL, client); err != nil {
+			log.Printf("   ! Ошибка обработки месяца %s: %v", monthlyURL, err)
+		}
+	} else {
+		var inRange []calendarDay
+		for _, day := range days {
+			if start := monthStart(year, month).AddDate(0, 0, day.Day-1); dates.overlaps(start, start.AddDate(0, 0, 1)) {
+				inRange = append(inRange, day)
+			}
+		}
+		log.Printf("-> Месяц %s входит в период частично, дней с записями в периоде: %d", monthlyURL, len(inRange))
+		days = inRange
+	}
+	entries := 0
+	for _, day := range days {
+		entries += day.Entries
+	}
+	if len(postURLs) < entries {
+		log.Printf("   Архив месяца неполон (постов %d, записей по календарю %d), обходим архивы дней.", len(postURLs), entries)
+		seen := make(map[string]bool, len(postURLs))
+		for _, u := range postURLs {
+			seen[u] = true
+		}
+		for _, day := range days {
+			dayURL := fmt.Sprintf("%s/%d/%02d/%02d/", baseURL, year, month, day.Day)
+			dayPosts, err := collectPostURLs(dayURL, client)
+			if err != nil {
+				log.Printf("   ! Ошибка обработки дня %s: %v", dayURL, err)
+				continue
+			}
+			for _, u := range dayPosts {
+				if !seen[u] {
+					seen[u] = true
+					postURLs = append(postURLs, u)
+				}
+			}
+		}
+	}
+	return convertPosts(postURLs, postFilter{Dates: dates}, client)
+}
+
+func monthStart(year, month int) time.Time {
+	return time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+}
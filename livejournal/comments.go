@@ -0,0 +1,291 @@
+package livejournal
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	"tiddlywiki-converter/tiddlywiki"
+)
+
+// =============================================================================
+// КОММЕНТАРИИ: ВСЕ СТРАНИЦЫ И СВЕРНУТЫЕ ВЕТКИ
+// =============================================================================
+//
+// Страница ?view=comments показывает только первую страницу обсуждения,
+// а глубокие ветки на ней свернуты: в Site.page у них нет текста (loaded = 0).
+// Поэтому обходятся все страницы ?page=N, а свернутые ветки раскрываются
+// загрузкой их thread_url. Повторы (одна ветка видна на нескольких
+// страницах) отбрасываются по dtalkid.
+
+// ljComment - комментарий из JSON Site.page.
+type ljComment struct {
+	ID        int64 // dtalkid (thread, если dtalkid нет)
+	Parent    int64
+	Author    string
+	Article   *string // nil - текст не загружен или комментарий удален
+	Ctime     string
+	CtimeTS   int64
+	ThreadURL string
+	Loaded    bool
+	Deleted   bool
+}
+
+// ljCommentPage - разобранная страница обсуждения.
+type ljCommentPage struct {
+	Comments   []ljComment
+	ReplyCount int // сколько комментариев у поста по данным страницы; 0 - неизвестно
+	Pages      int // число страниц обсуждения
+}
+
+var (
+	sitePagePattern    = regexp.MustCompile(`Site\.page\s*=\s*({.*?});`)
+	commentPagePattern = regexp.MustCompile(`\d+\.html\?(?:[^"'\s>]*&(?:amp;)?)?page=(\d+)`)
+)
+
+// parseCommentPage извлекает комментарии из самого большого блока Site.page.
+func parseCommentPage(htmlBody []byte) (*ljCommentPage, error) {
+	var largestJSON []byte
+	for _, match := range sitePagePattern.FindAllSubmatch(htmlBody, -1) {
+		if len(match[1]) > len(largestJSON) {
+			largestJSON = match[1]
+		}
+	}
+	if largestJSON == nil {
+		return nil, fmt.Errorf("на странице нет данных Site.page")
+	}
+
+	var sitePage map[string]interface{}
+	if err := json.Unmarshal(largestJSON, &sitePage); err != nil {
+		return nil, fmt.Errorf("ошибка разбора Site.page: %w", err)
+	}
+
+	page := &ljCommentPage{Pages: 1}
+	for _, key := range []string{"replycount", "reply_count", "comments_count"} {
+		if n := jsonInt(sitePage[key]); n > 0 {
+			page.ReplyCount = int(n)
+			break
+		}
+	}
+	for _, m := range commentPagePattern.FindAllSubmatch(htmlBody, -1) {
+		if n, err := strconv.Atoi(string(m[1])); err == nil && n > page.Pages {
+			page.Pages = n
+		}
+	}
+
+	commentsData, _ := sitePage["comments"].([]interface{})
+	for _, comm := range commentsData {
+		commentMap, ok := comm.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		c := ljComment{ID: jsonInt(commentMap["dtalkid"])}
+		if c.ID == 0 {
+			c.ID = jsonInt(commentMap["thread"])
+		}
+		if c.ID == 0 {
+			continue
+		}
+		c.Parent = jsonInt(commentMap["parent"])
+		if c.Parent == 0 {
+			c.Parent = jsonInt(commentMap["above"])
+		}
+		c.Author, _ = commentMap["dname"].(string)
+		c.Ctime, _ = commentMap["ctime"].(string)
+		c.CtimeTS = jsonInt(commentMap["ctime_ts"])
+		c.ThreadURL, _ = commentMap["thread_url"].(string)
+		if article, ok := commentMap["article"].(string); ok {
+			c.Article = &article
+		}
+		// Старые страницы не передают loaded; тогда загруженным считается комментарий с текстом.
+		if v, ok := commentMap["loaded"]; ok {
+			c.Loaded = jsonInt(v) != 0
+		} else {
+			c.Loaded = c.Article != nil
+		}
+		c.Deleted = jsonInt(commentMap["deleted"]) != 0
+		page.Comments = append(page.Comments, c)
+	}
+	return page, nil
+}
+
+// jsonInt читает число, которое LiveJournal отдает то числом, то строкой
+// (в JSON страниц и в ответах XML-RPC).
+func jsonInt(v interface{}) int64 {
+	switch n := v.(type) {
+	case float64:
+		return int64(n)
+	case int64:
+		return n
+	case string:
+		i, _ := strconv.ParseInt(n, 10, 64)
+		return i
+	case bool:
+		if n {
+			return 1
+		}
+	}
+	return 0
+}
+
+// commentCollector собирает комментарии со всех страниц без повторов.
+type commentCollector struct {
+	byID     map[int64]int // dtalkid -> индекс в comments
+	comments []ljComment
+}
+
+// add добавляет комментарии страницы. Свернутый комментарий, уже известный
+// по другой странице, заменяется загруженной версией.
+func (c *commentCollector) add(comments []ljComment) {
+	for _, comment := range comments {
+		if i, ok := c.byID[comment.ID]; ok {
+			if !c.comments[i].Loaded && comment.Loaded {
+				c.comments[i] = comment
+			}
+			continue
+		}
+		c.byID[comment.ID] = len(c.comments)
+		c.comments = append(c.comments, comment)
+	}
+}
+
+// fetchPostComments загружает все страницы обсуждения поста и раскрывает
+// свернутые ветки. Возвращает комментарии и число, заявленное на странице.
+func fetchPostComments(postURL string, client *http.Client) ([]ljComment, int, error) {
+	commentsURL := postURL + "?view=comments"
+	log.Printf("       -> Загрузка комментариев со страницы: %s", commentsURL)
+	body, err := fetchHTML(commentsURL, client)
+	if err != nil {
+		return nil, 0, err
+	}
+	collector := &commentCollector{byID: make(map[int64]int)}
+	first, err := parseCommentPage(body)
+	if err != nil {
+		// Комментариев нет или страница другого формата - пост все равно импортируется.
+		return nil, 0, nil
+	}
+	collector.add(first.Comments)
+
+	for n := 2; n <= first.Pages; n++ {
+		pageURL := fmt.Sprintf("%s?page=%d", postURL, n)
+		log.Printf("       -> Загрузка страницы комментариев %d из %d: %s", n, first.Pages, pageURL)
+		body, err := fetchHTML(pageURL, client)
+		if err != nil {
+			log.Printf("       ! Ошибка загрузки %s: %v", pageURL, err)
+			continue
+		}
+		page, err := parseCommentPage(body)
+		if err != nil {
+			log.Printf("       ! %s: %v", pageURL, err)
+			continue
+		}
+		collector.add(page.Comments)
+	}
+
+	expandCollapsedThreads(collector, client)
+	return collector.comments, first.ReplyCount, nil
+}
+
+// expandCollapsedThreads загружает thread_url каждого свернутого комментария.
+// Раскрытая ветка может содержать новые свернутые ветки, поэтому обход
+// повторяется, пока находятся незагруженные комментарии.
+func expandCollapsedThreads(collector *commentCollector, client *http.Client) {
+	visited := make(map[string]bool)
+	for i := 0; i < len(collector.comments); i++ {
+		comment := collector.comments[i]
+		if comment.Loaded || comment.Deleted || comment.ThreadURL == "" {
+			continue
+		}
+		threadURL := cleanThreadURL(comment.ThreadURL)
+		if visited[threadURL] {
+			continue
+		}
+		visited[threadURL] = true
+		body, err := fetchHTML(threadURL, client)
+		if err != nil {
+			log.Printf("       ! Ошибка раскрытия ветки %s: %v", threadURL, err)
+			continue
+		}
+		page, err := parseCommentPage(body)
+		if err != nil {
+			log.Printf("       ! %s: %v", threadURL, err)
+			continue
+		}
+		collector.add(page.Comments)
+	}
+}
+
+// cleanThreadURL убирает якорь из ссылки на ветку, оставляя ?thread=N.
+func cleanThreadURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.Fragment = ""
+	return u.String()
+}
+
+// logCommentCount сообщает, сколько комментариев заявлено и сколько получено.
+func logCommentCount(postTitle string, claimed, captured int) {
+	switch {
+	case claimed == 0:
+		log.Printf("       Комментариев получено: %d (заявленное число неизвестно).", captured)
+	case captured < claimed:
+		log.Printf("       ! Пост '%s': заявлено комментариев %d, получено %d.", postTitle, claimed, captured)
+	default:
+		log.Printf("       Комментариев заявлено %d, получено %d.", claimed, captured)
+	}
+}
+
+// buildCommentTiddlers создает тиддлеры комментариев с заголовками <пост>-comment-<id>.
+func buildCommentTiddlers(comments []ljComment, postTitle string) []*tiddlywiki.Tiddler {
+	known := make(map[int64]bool, len(comments))
+	for _, comment := range comments {
+		known[comment.ID] = true
+	}
+
+	var tiddlers []*tiddlywiki.Tiddler
+	for _, comment := range comments {
+		parentTitle := postTitle
+		if comment.Parent != 0 {
+			parentTitle = fmt.Sprintf("%s-comment-%d", postTitle, comment.Parent)
+			if !known[comment.Parent] {
+				log.Printf("       ! Родитель комментария %d (%d) не найден, комментарий привязан к посту.", comment.ID, comment.Parent)
+				parentTitle = postTitle
+			}
+		}
+
+		articleText := "''Комментарий скрыт или удален.'' //(article: null)//"
+		if comment.Article != nil {
+			articleText = convertLJMarkup(*comment.Article, comment.ThreadURL)
+		}
+
+		// Автор, дата и ссылка хранятся в полях - их показывает шаблон обсуждения.
+		tiddler := tiddlywiki.NewTiddler(fmt.Sprintf("%s-comment-%d", postTitle, comment.ID), articleText, fmt.Sprintf("[[%s]]", parentTitle))
+		tiddler.Fields[tiddlywiki.FieldImportType] = tiddlywiki.ImportTypeComment
+		tiddler.Fields[tiddlywiki.FieldParent] = parentTitle
+		tiddler.Fields[tiddlywiki.FieldThreadRoot] = postTitle
+		if comment.Author != "" {
+			tiddler.Fields[tiddlywiki.FieldAuthor] = comment.Author
+			tiddler.Fields[tiddlywiki.FieldCommentAuthor] = comment.Author
+		}
+		if comment.CtimeTS > 0 {
+			commentTime := time.Unix(comment.CtimeTS, 0).UTC().Format(tiddlywiki.TiddlyTimeFormat)
+			tiddler.Created = commentTime
+			tiddler.Modified = commentTime
+			tiddler.Fields[tiddlywiki.FieldCommentDate] = commentTime
+		} else if comment.Ctime != "" {
+			tiddler.Fields["comment-date-text"] = comment.Ctime
+		}
+		if comment.ThreadURL != "" {
+			tiddler.Fields[tiddlywiki.FieldSourceURL] = comment.ThreadURL
+		}
+		tiddlers = append(tiddlers, tiddler)
+	}
+	return tiddlers
+}
@@ -3,13 +3,14 @@ package livejournal
 import (
 	"bytes"
 	"encoding/base64"
-	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
+	"path"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -23,7 +24,17 @@ type LivejournalPost struct {
 	URL         string
 	Description string
 	Body        string
+	Author      string
 	Tags        []string
+
+	Published    time.Time // дата публикации; нулевая, если на странице ее нет
+	Updated      time.Time
+	Mood         string
+	Music        string
+	Location     string
+	Security     string // SecurityPublic, SecurityFriends, SecurityPrivate, SecurityCustom
+	CommentCount int    // число комментариев по данным страницы
+	Userpic      string // адрес юзерпика записи
 }
 
 // =============================================================================
@@ -56,13 +67,27 @@ func ConvertBlogForMonth(blogURL string, year int, month time.Month) ([]*tiddlyw
 
 // ConvertFromURL - главный диспетчер. Анализирует URL и запускает нужную логику.
 func ConvertFromURL(pageURL string) ([]*tiddlywiki.Tiddler, error) {
-	client := &http.Client{Timeout: 30 * time.Second}
+	return ConvertFromURLWithOptions(pageURL, Options{})
+}
+
+// ConvertFromURLWithOptions - то же с авторизацией: куки подставляются во все
+// запросы, а с Protocol журнал читается через XML-RPC вместо страниц.
+// Адрес может вести на журнал, сообщество, страницу тега, архив или пост;
+// From и To ограничивают импорт записями за период.
+func ConvertFromURLWithOptions(pageURL string, opts Options) ([]*tiddlywiki.Tiddler, error) {
+	client, err := newHTTPClient(pageURL, opts)
+	if err != nil { return nil, err }
 	
 	// Определяем тип URL с помощью регулярных выражений
 	isPost, _ := regexp.MatchString(`/\d+\.html$`, pageURL)
 	isYear, _ := regexp.MatchString(`/\d{4}/?$`, pageURL)
 	isMonth, _ := regexp.MatchString(`/\d{4}/\d{2}/?$`, pageURL)
 	isDay, _ := regexp.MatchString(`/\d{4}/\d{2}/\d{2}/?$`, pageURL)
+	isTag := tagFromURL(pageURL) != ""
+	dates := opts.dateRange()
+	if !dates.empty() {
+		log.Printf("Импортируются записи за период: %s", dates)
+	}
 
 	// Создаем системные тиддлеры один раз в самом начале.
 	allTiddlers, _, err := createSystemTiddlers(pageURL, client)
@@ -71,68 +96,81 @@ func ConvertFromURL(pageURL string) ([]*tiddlywiki.Tiddler, error) {
 		allTiddlers = make([]*tiddlywiki.Tiddler, 0)
 	}
 
-	if isPost {
+	if opts.Protocol {
+		protocolTiddlers, err := convertViaProtocol(pageURL, opts, client)
+		if err != nil { return nil, err }
+		allTiddlers = append(allTiddlers, protocolTiddlers...)
+
+	} else if isTag {
+		log.Printf("Обнаружен URL тега. Обходятся все страницы тега: %s", pageURL)
+		allTiddlers = append(allTiddlers, crawlTag(pageURL, dates, client)...)
+
+	} else if isPost {
 		log.Printf("Обнаружен URL поста. Конвертируется один пост: %s", pageURL)
-		postTiddlers, err := convertSinglePost(pageURL, client)
+		// Явно указанный пост импортируется независимо от периода.
+		postTiddlers, err := convertSinglePost(pageURL, postFilter{}, client)
 		if err != nil { return nil, err }
 		allTiddlers = append(allTiddlers, postTiddlers...)
 
 	} else if isDay || isMonth {
 		log.Printf("Обнаружен URL архива за месяц/день. Сканируется одна страница: %s", pageURL)
-		archiveTiddlers, err := processArchivePage(pageURL, client)
+		archiveTiddlers, err := processArchivePage(pageURL, dates, client)
 		if err != nil { return nil, err }
 		allTiddlers = append(allTiddlers, archiveTiddlers...)
 
 	} else if isYear {
-		log.Printf("Обнаружен URL архива за год. Запускается цикл по месяцам для: %s", pageURL)
+		log.Printf("Обнаружен URL архива за год. Обходятся месяцы с записями по календарю: %s", pageURL)
 		u, _ := url.Parse(pageURL)
-		baseURL := strings.TrimSuffix(u.String(), "/")
-		
-		for month := 1; month <= 12; month++ {
-			monthlyURL := fmt.Sprintf("%s/%02d/", baseURL, month)
-			log.Printf("-> Обрабатывается месяц: %s", monthlyURL)
-			archiveTiddlers, err := processArchivePage(monthlyURL, client)
-			if err != nil { 
-				log.Printf("   ! Ошибка обработки месяца %s (возможно, его не существует): %v", monthlyURL, err)
-				continue
-			}
-			allTiddlers = append(allTiddlers, archiveTiddlers...)
-		}
-	} else {
-		// Если это не пост, не год, не месяц и не день - считаем, что это весь блог.
-		// Используем ВАШУ НАДЕЖНУЮ ЛОГИКУ ПОЛНОГО ОБХОДА.
-		log.Printf("Обнаружен URL блога. Запускается полный обход архивов: %s", pageURL)
-		u, _ := url.Parse(pageURL)
-		baseURL := fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+		baseURL := journalBase(pageURL)
+		year, _ := strconv.Atoi(path.Base(strings.TrimSuffix(u.Path, "/")))
 
-		startYear, _ := getBlogStartYear(baseURL, client) // Ваша функция-заглушка
-		currentYear := time.Now().Year()
-
-		for year := startYear; year <= currentYear; year++ {
-			log.Printf("==> Обрабатывается год: %d", year)
-			for month := 1; month <= 12; month++ {
-				monthlyURL := fmt.Sprintf("%s/%d/%02d/", baseURL, year, month)
-				log.Printf("-> Обрабатывается месяц: %s", monthlyURL)
-				archiveTiddlers, err := processArchivePage(monthlyURL, client)
-				if err != nil {
-					log.Printf("   ! Ошибка обработки месяца %s (возможно, его не существует): %v", monthlyURL, err)
-					continue
-				}
-				allTiddlers = append(allTiddlers, archiveTiddlers...)
-			}
-		}
+		calendar, err := discoverCalendar(baseURL, dates.years([]int{year}), client)
+		if err != nil { return nil, err }
+		allTiddlers = append(allTiddlers, crawlCalendarOrMonths(baseURL, dates.years([]int{year}), calendar, dates, client)...)
+	} else {
+		// Если это не пост, не год, не месяц и не день - считаем, что это весь блог
+		// (журнал пользователя или сообщество).
+		baseURL := journalBase(pageURL)
+		log.Printf("Обнаружен URL блога. Запускается обход архивов по календарю: %s", baseURL)
+
+		years, err := discoverYears(baseURL, client)
+		if err != nil { return nil, fmt.Errorf("не удалось определить годы с записями: %w", err) }
+		years = dates.years(years)
+		log.Printf("Годы для обхода: %v", years)
+		calendar, err := discoverCalendar(baseURL, years, client)
+		if err != nil { return nil, err }
+		allTiddlers = append(allTiddlers, crawlCalendarOrMonths(baseURL, years, calendar, dates, client)...)
 	}
 
 	log.Printf("Конвертация завершена. Всего создано тиддлеров: %d", len(allTiddlers))
 	return allTiddlers, nil
 }
 
+// indexedURL и indexedTiddlers связывают результат воркера с позицией поста
+// на странице архива, чтобы порядок тиддлеров не зависел от скорости загрузки.
+type indexedURL struct {
+	index int
+	url   string
+}
+
+type indexedTiddlers struct {
+	index    int
+	tiddlers []*tiddlywiki.Tiddler
+}
+
 // processArchivePage - рабочая лошадка для месячных/дневных архивов.
 // Сканирует ОДНУ страницу, находит посты и запускает их параллельную обработку.
-func processArchivePage(pageURL string, client *http.Client) ([]*tiddlywiki.Tiddler, error) {
+func processArchivePage(pageURL string, dates dateRange, client *http.Client) ([]*tiddlywiki.Tiddler, error) {
+	postURLs, err := collectPostURLs(pageURL, client)
+	if err != nil { return nil, err }
+	return convertPosts(postURLs, postFilter{Dates: dates}, client), nil
+}
+
+// collectPostURLs возвращает ссылки на посты со страницы архива в порядке их появления.
+func collectPostURLs(pageURL string, client *http.Client) ([]string, error) {
 	req, err := http.NewRequest("GET", pageURL, nil)
 	if err != nil { return nil, err }
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
+	req.Header.Set("User-Agent", userAgent)
 
 	resp, err := client.Do(req)
 	if err != nil { return nil, err }
@@ -145,20 +183,36 @@ func processArchivePage(pageURL string, client *http.Client) ([]*tiddlywiki.Tidd
 		return nil, fmt.Errorf("статус %d", resp.StatusCode)
 	}
 
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil { return nil, err }
+	return archivePostURLs(resp.Body, pageURL)
+}
 
+// archivePostURLs извлекает ссылки на посты из загруженной страницы.
+// Ссылки на другие журналы того же хоста (сообщества на community.livejournal.com) отбрасываются.
+func archivePostURLs(body io.Reader, pageURL string) ([]string, error) {
 	baseURL, _ := url.Parse(pageURL)
-	postURLs := make(chan string, 100)
+	journal, _ := url.Parse(journalBase(pageURL))
+	var postURLs []string
+	err := streamPostsFromArchiveGreedy(body, baseURL, func(postURL string) {
+		if inJournal(journal, postURL) {
+			postURLs = append(postURLs, postURL)
+		}
+	})
+	return postURLs, err
+}
+
+// convertPosts параллельно конвертирует посты, сохраняя порядок ссылок.
+// Посты, не прошедшие filter, пропускаются.
+func convertPosts(urls []string, filter postFilter, client *http.Client) []*tiddlywiki.Tiddler {
+	postURLs := make(chan indexedURL, 100)
 	go func() {
 		defer close(postURLs)
-		streamPostsFromArchiveGreedy(bytes.NewReader(bodyBytes), baseURL, func(postURL string) {
-			postURLs <- postURL
-		})
+		for index, postURL := range urls {
+			postURLs <- indexedURL{index: index, url: postURL}
+		}
 	}()
 
 	var wg sync.WaitGroup
-	tiddlerChan := make(chan []*tiddlywiki.Tiddler, 10)
+	tiddlerChan := make(chan indexedTiddlers, 10)
 	workerLimit := 10
 	guard := make(chan struct{}, workerLimit)
 
@@ -172,15 +226,15 @@ func processArchivePage(pageURL string, client *http.Client) ([]*tiddlywiki.Tidd
 		for postURL := range postURLs {
 			wg.Add(1)
 			guard <- struct{}{}
-			go func(pURL string) {
+			go func(p indexedURL) {
 				defer wg.Done()
 				defer func() { <-guard }()
-				tiddlers, err := convertSinglePost(pURL, client)
+				tiddlers, err := convertSinglePost(p.url, filter, client)
 				if err != nil {
-					log.Printf("! Ошибка конвертации поста %s: %v", pURL, err)
+					log.Printf("! Ошибка конвертации поста %s: %v", p.url, err)
 					return
 				}
-				tiddlerChan <- tiddlers
+				tiddlerChan <- indexedTiddlers{index: p.index, tiddlers: tiddlers}
 			}(postURL)
 		}
 
@@ -194,13 +248,23 @@ func processArchivePage(pageURL string, client *http.Client) ([]*tiddlywiki.Tidd
 
 	// ШАГ 4: Главный поток НЕ ЖДЕТ. Он НЕМЕДЛЕННО начинает принимать результаты.
 	// Этот цикл работает параллельно с диспетчером и воркерами.
+	// Результаты приходят в порядке завершения, поэтому собираем их по индексу
+	// и выдаем в порядке ссылок на странице архива.
+	results := make(map[int][]*tiddlywiki.Tiddler)
+	maxIndex := -1
+	for r := range tiddlerChan {
+		results[r.index] = r.tiddlers
+		if r.index > maxIndex {
+			maxIndex = r.index
+		}
+	}
 	var allTiddlers []*tiddlywiki.Tiddler
-	for tiddlers := range tiddlerChan {
-		allTiddlers = append(allTiddlers, tiddlers...)
+	for i := 0; i <= maxIndex; i++ {
+		allTiddlers = append(allTiddlers, results[i]...)
 	}
 	// =========================================================================
 
-	return allTiddlers, nil
+	return allTiddlers
 }
 
 // =============================================================================
@@ -208,7 +272,8 @@ func processArchivePage(pageURL string, client *http.Client) ([]*tiddlywiki.Tidd
 // =============================================================================
 
 // convertSinglePost загружает, парсит один пост и ИЗВЛЕКАЕТ ДЛЯ НЕГО ВСЕ КОММЕНТАРИИ.
-func convertSinglePost(pageURL string, client *http.Client) ([]*tiddlywiki.Tiddler, error) {
+// Пост, не прошедший filter (вне периода, без нужного тега), пропускается до загрузки комментариев.
+func convertSinglePost(pageURL string, filter postFilter, client *http.Client) ([]*tiddlywiki.Tiddler, error) {
 	log.Printf("    -> Начата обработка поста: %s", pageURL)
 
 	// =========================================================================
@@ -231,51 +296,25 @@ func convertSinglePost(pageURL string, client *http.Client) ([]*tiddlywiki.Tiddl
 	// Парсим информацию о самом посте (заголовок, тело, теги)
 	post, err := parsePostPage(postBodyBytes)
 	if err != nil { return nil, err }
+	if !filter.accepts(post) {
+		log.Printf("    <- Пост '%s' (%s) не подходит под условия импорта, пропущен.", post.Title, post.Published.Format("2006-01-02"))
+		return nil, nil
+	}
 
-	// --- ШАГ 2: Загружаем страницу комментариев, чтобы извлечь ВСЕ КОММЕНТАРИИ ---
-	commentsURL := pageURL + "?view=comments"
-	log.Printf("       -> Загрузка комментариев со страницы: %s", commentsURL)
-	
-	commentsReq, err := http.NewRequest("GET", commentsURL, nil)
-	if err != nil { return nil, err }
-	commentsReq.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-
-	commentsResp, err := client.Do(commentsReq)
-	if err != nil { return nil, err }
-	defer commentsResp.Body.Close()
-	if commentsResp.StatusCode != http.StatusOK { return nil, fmt.Errorf("статус %d при запросе комментариев", commentsResp.StatusCode) }
-
-	commentsBodyBytes, err := io.ReadAll(commentsResp.Body)
-	if err != nil { return nil, err }
+	// --- ШАГ 2: Загружаем ВСЕ страницы комментариев и раскрываем свернутые ветки ---
+	comments, claimedComments, err := fetchPostComments(pageURL, client)
+	if err != nil { return nil, fmt.Errorf("ошибка загрузки комментариев: %w", err) }
 
 	// --- ШАГ 3: Собираем все вместе ---
-
-	if post.URL != "" {
-		post.Body += fmt.Sprintf("\n\n---\n\n''Оригинал поста:'' <a href=\"%s\" target=\"_blank\">%s</a>", post.URL, post.URL)
-	}
-	post.Body += fmt.Sprintf("\n\n---\n\n<<list-links \"[tag[%s]]\">>", post.Title)
-	
-	var tagsBuilder strings.Builder
-	for _, tag := range post.Tags {
-		if strings.Contains(tag, " ") {
-			tagsBuilder.WriteString(fmt.Sprintf("[[%s]] ", tag))
-		} else {
-			tagsBuilder.WriteString(tag)
-			tagsBuilder.WriteString(" ")
-		}
+	if post.CommentCount == 0 {
+		post.CommentCount = claimedComments
 	}
-	tagsString := strings.TrimSpace(tagsBuilder.String())
-
-	postTiddler := tiddlywiki.NewTiddler(post.Title, post.Body, tagsString)
-	postTiddler.Fields["url"] = post.URL
-	
+	postTiddler := newPostTiddler(post)
 	allTiddlers := []*tiddlywiki.Tiddler{postTiddler}
 
-	// Передаем HTML со страницы комментариев в наш парсер
-	commentTiddlers := parseCommentsFromRenderedHTML(commentsBodyBytes, post.Title)
-	if commentTiddlers != nil {
-		allTiddlers = append(allTiddlers, commentTiddlers...)
-	}
+	logCommentCount(post.Title, post.CommentCount, len(comments))
+	commentTiddlers := buildCommentTiddlers(comments, post.Title)
+	allTiddlers = append(allTiddlers, commentTiddlers...)
 
 	log.Printf("    <- Пост '%s' завершен. Всего тиддлеров: %d (1 пост + %d коммент.)", post.Title, len(allTiddlers), len(commentTiddlers))
 	return allTiddlers, nil
@@ -427,74 +466,13 @@ func createSystemTiddlers(baseURL string, client *http.Client) ([]*tiddlywiki.Ti
 	return allTiddlers, finalTitle, nil
 }
 
+// parseCommentsFromRenderedHTML разбирает одну уже загруженную страницу обсуждения
+// (без дозагрузки страниц и свернутых веток).
 func parseCommentsFromRenderedHTML(htmlBody []byte, postTitle string) []*tiddlywiki.Tiddler {
-	re := regexp.MustCompile(`Site\.page\s*=\s*({.*?});`)
-	allMatches := re.FindAllSubmatch(htmlBody, -1)
-	if len(allMatches) == 0 { return nil }
-
-	var largestJSON []byte
-	for _, match := range allMatches {
-		if len(match) > 1 { if len(match[1]) > len(largestJSON) { largestJSON = match[1] } }
-	}
-	if largestJSON == nil { return nil }
-
-	var sitePage map[string]interface{}
-	if err := json.Unmarshal(largestJSON, &sitePage); err != nil { return nil }
-
-	commentsData, ok := sitePage["comments"].([]interface{})
-	if !ok { return nil }
-	log.Printf("   -> Массив 'comments' успешно извлечен. Всего объектов: %d.", len(commentsData))
-
-	hierarchyMap := make(map[float64]float64)
-	isParentMap := make(map[float64]bool)
-	for _, comm := range commentsData {
-		commentMap, _ := comm.(map[string]interface{})
-		var cID, pID float64
-		if id, ok := commentMap["thread"].(float64); ok { cID = id } else if id, ok := commentMap["dtalkid"].(float64); ok { cID = id }
-		if cID == 0 { continue }
-		
-		if parentID, ok := commentMap["parent"].(float64); ok { pID = parentID } else if parentID, ok := commentMap["above"].(float64); ok { pID = parentID }
-		if pID != 0 {
-			hierarchyMap[cID] = pID
-			isParentMap[pID] = true
-		}
-	}
-
-	var tiddlers []*tiddlywiki.Tiddler
-	for _, comm := range commentsData {
-		commentMap, _ := comm.(map[string]interface{})
-		var commentID float64
-		if id, ok := commentMap["thread"].(float64); ok { commentID = id } else if id, ok := commentMap["dtalkid"].(float64); ok { commentID = id }
-		if commentID == 0 { continue }
-		
-		parentID := hierarchyMap[commentID]
-		parentTitle := postTitle
-		if pID, ok := hierarchyMap[commentID]; ok { parentTitle = fmt.Sprintf("%s-comment-%.0f", postTitle, pID) }
-		
-		newTiddlerTitle := fmt.Sprintf("%s-comment-%.0f", postTitle, commentID)
-		
-		var articleText string
-		if article, exists := commentMap["article"]; exists && article != nil { articleText, _ = article.(string) } else { articleText = "''Комментарий скрыт или удален.'' //(article: null)//" }
-		
-		author, _ := commentMap["dname"].(string)
-		datetime, _ := commentMap["ctime"].(string)
-		commentURL, _ := commentMap["thread_url"].(string)
-
-		var tiddlerTextBuilder strings.Builder
-		tiddlerTextBuilder.WriteString(fmt.Sprintf("''Автор:'' %s\n", author))
-		tiddlerTextBuilder.WriteString(fmt.Sprintf("''Дата:'' %s\n", datetime))
-		if commentURL != "" { tiddlerTextBuilder.WriteString(fmt.Sprintf("''Ссылка:'' <a href=\"%s\" target=\"_blank\">%s</a>\n", commentURL, commentURL)) }
-		tiddlerTextBuilder.WriteString("\n---\n\n")
-		tiddlerTextBuilder.WriteString(articleText)
-
-		if isParentMap[commentID] { tiddlerTextBuilder.WriteString(fmt.Sprintf("\n\n---\n\n<<list-links \"[tag[%s]]\">>", newTiddlerTitle)) }
-		
-		var tag string
-		if parentID == 0 { tag = fmt.Sprintf("[[%s]]", postTitle) } else { tag = fmt.Sprintf("[[%s]]", parentTitle) }
-		
-		tiddler := tiddlywiki.NewTiddler(newTiddlerTitle, tiddlerTextBuilder.String(), tag)
-		tiddlers = append(tiddlers, tiddler)
-	}
+	page, err := parseCommentPage(htmlBody)
+	if err != nil { return nil }
+	log.Printf("   -> Массив 'comments' успешно извлечен. Всего объектов: %d.", len(page.Comments))
+	tiddlers := buildCommentTiddlers(page.Comments, postTitle)
 	log.Printf("   -> Обработка завершена. Всего создано %d тиддлеров-комментариев.", len(tiddlers))
 	return tiddlers
 }
@@ -513,6 +491,7 @@ func parsePostPage(htmlBody []byte) (*LivejournalPost, error) {
 			case "og:url": if post.URL == "" { post.URL = content }
 			case "og:description": if post.Description == "" { post.Description = content }
 			case "article:tag": if content != "" { post.Tags = append(post.Tags, content) }
+			case "article:author": if post.Author == "" { post.Author = content }
 			}
 		}
 		if bodyNode == nil && n.Type == html.ElementNode && n.Data == "div" {
@@ -525,11 +504,13 @@ func parsePostPage(htmlBody []byte) (*LivejournalPost, error) {
 		if bodyNode == nil { for c := n.FirstChild; c != nil; c = c.NextSibling { traverse(c) } }
 	}
 	traverse(doc)
+	parseEntryMetadata(doc, htmlBody, post)
 	if post.Title == "" {
 		if titleNode := findNode(doc, "title"); titleNode != nil { post.Title = getTitleText(titleNode) }
 	}
 	if post.Title == "" { return nil, fmt.Errorf("не удалось найти заголовок поста") }
 	if bodyNode != nil {
+		transformLJMarkup(bodyNode, newMarkupContext(post.URL))
 		bodyHTML, err := renderInnerNode(bodyNode)
 		if err != nil { return nil, fmt.Errorf("не удалось отрендерить тело поста: %w", err) }
 		post.Body = bodyHTML
@@ -539,10 +520,6 @@ func parsePostPage(htmlBody []byte) (*LivejournalPost, error) {
 	return post, nil
 }
 
-func getBlogStartYear(baseURL string, client *http.Client) (int, error) {
-	return 1999, nil
-}
-
 func getAttr(n *html.Node, key string) string { for _, attr := range n.Attr { if attr.Key == key { return attr.Val } }; return "" }
 func findNode(n *html.Node, tagName string) *html.Node { if n.Type == html.ElementNode && n.Data == tagName { return n }; for c := n.FirstChild; c != nil; c = c.NextSibling { if result := findNode(c, tagName); result != nil { return result } }; return nil }
 func getTitleText(n *html.Node) string { if n.FirstChild != nil && n.FirstChild.Type == html.TextNode { return strings.TrimSuffix(n.FirstChild.Data, " — ЖЖ") }; return "" }
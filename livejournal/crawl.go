@@ -0,0 +1,234 @@
+package livejournal
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"tiddlywiki-converter/tiddlywiki"
+)
+
+// =============================================================================
+// ОБХОД ПО ТЕГУ, СООБЩЕСТВА И ПЕРИОД
+// =============================================================================
+
+// dateRange - период импорта: From включительно, To не включительно.
+// Нулевая граница означает отсутствие ограничения.
+type dateRange struct {
+	From time.Time
+	To   time.Time
+}
+
+func (r dateRange) empty() bool {
+	return r.From.IsZero() && r.To.IsZero()
+}
+
+// contains проверяет дату записи. Запись с неизвестной датой не отбрасывается.
+func (r dateRange) contains(t time.Time) bool {
+	if t.IsZero() {
+		return true
+	}
+	return (r.From.IsZero() || !t.Before(r.From)) && (r.To.IsZero() || t.Before(r.To))
+}
+
+// overlaps проверяет, пересекается ли период [start, end) с диапазоном.
+func (r dateRange) overlaps(start, end time.Time) bool {
+	return (r.From.IsZero() || end.After(r.From)) && (r.To.IsZero() || start.Before(r.To))
+}
+
+// covers проверяет, входит ли период [start, end) в диапазон целиком.
+func (r dateRange) covers(start, end time.Time) bool {
+	return (r.From.IsZero() || !start.Before(r.From)) && (r.To.IsZero() || !end.After(r.To))
+}
+
+// years оставляет годы, пересекающиеся с периодом.
+func (r dateRange) years(years []int) []int {
+	var result []int
+	for _, year := range years {
+		start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+		if r.overlaps(start, start.AddDate(1, 0, 0)) {
+			result = append(result, year)
+		}
+	}
+	return result
+}
+
+func (r dateRange) String() string {
+	from, to := "...", "..."
+	if !r.From.IsZero() {
+		from = r.From.Format("2006-01-02")
+	}
+	if !r.To.IsZero() {
+		// To не включается в период, показывается последний день.
+		to = r.To.AddDate(0, 0, -1).Format("2006-01-02")
+	}
+	return from + " - " + to
+}
+
+// parseDateBound разбирает границу периода: 2006, 2006-01 или 2006-01-02.
+// Для верхней границы возвращается начало следующего года, месяца или дня,
+// поэтому --to 2006-01 включает весь январь.
+func parseDateBound(s string, upper bool) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, f := range []struct {
+		layout string
+		years  int
+		months int
+		days   int
+	}{
+		{"2006-01-02", 0, 0, 1},
+		{"2006-01", 0, 1, 0},
+		{"2006", 1, 0, 0},
+	} {
+		if t, err := time.Parse(f.layout, s); err == nil {
+			if upper {
+				t = t.AddDate(f.years, f.months, f.days)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("некорректная дата %q, ожидается ГГГГ, ГГГГ-ММ или ГГГГ-ММ-ДД", s)
+}
+
+// journalBase возвращает корень журнала без завершающей косой черты.
+// Обычный журнал и сообщество на поддомене - https://name.livejournal.com,
+// сообщество по пути - https://www.livejournal.com/community/name
+// или https://community.livejournal.com/name.
+func journalBase(pageURL string) string {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return strings.TrimSuffix(pageURL, "/")
+	}
+	root := fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	switch {
+	case len(parts) >= 2 && (parts[0] == "community" || parts[0] == "users" || parts[0] == "~"):
+		return root + "/" + parts[0] + "/" + parts[1]
+	case (strings.HasPrefix(u.Host, "community.") || strings.HasPrefix(u.Host, "users.")) && parts[0] != "":
+		return root + "/" + parts[0]
+	}
+	return root
+}
+
+// inJournal проверяет, что ссылка ведет в тот же журнал: на общем хосте
+// (community.livejournal.com, www.livejournal.com) живут разные журналы.
+func inJournal(base *url.URL, link string) bool {
+	u, err := url.Parse(link)
+	if err != nil || u.Host != base.Host {
+		return false
+	}
+	return base.Path == "" || u.Path == base.Path || strings.HasPrefix(u.Path, base.Path+"/")
+}
+
+var tagPathPattern = regexp.MustCompile(`/tag/([^/?#]+)/?$`)
+
+// tagFromURL возвращает имя тега для адреса страницы тега или пустую строку.
+func tagFromURL(pageURL string) string {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return ""
+	}
+	m := tagPathPattern.FindStringSubmatch(u.EscapedPath())
+	if m == nil {
+		return ""
+	}
+	tag, err := url.PathUnescape(strings.ReplaceAll(m[1], "+", " "))
+	if err != nil {
+		return m[1]
+	}
+	return tag
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(strings.TrimSpace(t), tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// postFilter отбирает посты после загрузки страницы, до загрузки комментариев:
+// по периоду и, для страницы тега, по самому тегу - на странице тега есть
+// и чужие ссылки (популярное, боковая колонка).
+type postFilter struct {
+	Dates dateRange
+	Tag   string
+}
+
+func (f postFilter) accepts(post *LivejournalPost) bool {
+	return f.Dates.contains(post.Published) && (f.Tag == "" || hasTag(post.Tags, f.Tag))
+}
+
+// crawlTag обходит страницу тега /tag/<имя>. Записи на ней выводятся
+// порциями, следующая порция - ?skip=N, где N берется из ссылки на
+// предыдущие записи; обход заканчивается, когда такой ссылки нет.
+func crawlTag(tagURL string, dates dateRange, client *http.Client) []*tiddlywiki.Tiddler {
+	tagURL = strings.TrimSuffix(cleanURL(tagURL), "/")
+	tagPage, err := url.Parse(tagURL)
+	if err != nil {
+		log.Printf("   ! Некорректный адрес тега %s: %v", tagURL, err)
+		return nil
+	}
+	seen := make(map[string]bool)
+	var postURLs []string
+	for skip := 0; ; {
+		pageURL := tagURL
+		if skip > 0 {
+			pageURL = fmt.Sprintf("%s?skip=%d", tagURL, skip)
+		}
+		log.Printf("-> Обрабатывается страница тега: %s", pageURL)
+		body, err := fetchHTML(pageURL, client)
+		if err != nil {
+			log.Printf("   ! Ошибка обработки %s: %v", pageURL, err)
+			break
+		}
+		found, err := archivePostURLs(bytes.NewReader(body), pageURL)
+		if err != nil {
+			log.Printf("   ! Ошибка обработки %s: %v", pageURL, err)
+			break
+		}
+		for _, u := range found {
+			if !seen[u] {
+				seen[u] = true
+				postURLs = append(postURLs, u)
+			}
+		}
+		next := nextTagSkip(body, tagPage, skip)
+		if len(found) == 0 || next <= skip {
+			break
+		}
+		skip = next
+	}
+	log.Printf("   Ссылок на записи со страниц тега: %d", len(postURLs))
+	return convertPosts(postURLs, postFilter{Dates: dates, Tag: tagFromURL(tagURL)}, client)
+}
+
+// nextTagSkip ищет ссылку на следующую порцию той же страницы тега:
+// наименьший skip больше текущего, то есть текущий skip плюс размер страницы.
+func nextTagSkip(body []byte, tagPage *url.URL, skip int) int {
+	next := 0
+	journalAnchors(body, tagPage, func(path string, a *html.Node) {
+		if strings.Trim(path, "/") != "" {
+			return
+		}
+		u, err := tagPage.Parse(getAttr(a, "href"))
+		if err != nil {
+			return
+		}
+		if n, err := strconv.Atoi(u.Query().Get("skip")); err == nil && n > skip && (next == 0 || n < next) {
+			next = n
+		}
+	})
+	return next
+}
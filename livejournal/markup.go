@@ -0,0 +1,454 @@
+package livejournal
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+
+	nethtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// =============================================================================
+// РАЗМЕТКА LIVEJOURNAL
+// =============================================================================
+//
+// Текст записи содержит конструкции, которые вне ЖЖ не работают:
+//   - <lj user="..."> (на странице - span.ljuser с иконкой) -> ссылка на журнал;
+//   - <lj-cut> (на странице - якоря cutidN ... cutidN-end) -> раскрывающийся $reveal;
+//   - <lj-embed> (на странице - iframe l.lj-toys.com) -> ссылка на видео у провайдера;
+//   - опросы <lj-poll> -> статическая таблица вариантов и результатов.
+// Разметка встречается как в исходном виде (экспорт, XML-RPC), так и в
+// отрисованном, поэтому обрабатываются оба варианта.
+
+// markupContext - сведения о записи, нужные преобразованию.
+type markupContext struct {
+	PostURL string // используется в именах состояний $reveal
+	Domain  string // домен сервиса: livejournal.com, dreamwidth.org
+	cuts    int
+}
+
+func newMarkupContext(postURL string) *markupContext {
+	ctx := &markupContext{PostURL: postURL, Domain: "livejournal.com"}
+	if u, err := url.Parse(postURL); err == nil && u.Hostname() != "" {
+		// user.livejournal.com -> livejournal.com; www.dreamwidth.org -> dreamwidth.org
+		parts := strings.Split(u.Hostname(), ".")
+		if len(parts) >= 2 {
+			ctx.Domain = strings.Join(parts[len(parts)-2:], ".")
+		}
+	}
+	return ctx
+}
+
+// convertLJMarkup преобразует разметку ЖЖ во фрагменте HTML.
+func convertLJMarkup(htmlText, postURL string) string {
+	if !strings.Contains(htmlText, "lj") && !strings.Contains(htmlText, "poll") &&
+		!strings.Contains(htmlText, "<iframe") && !strings.Contains(htmlText, "<object") {
+		return htmlText
+	}
+	body := &nethtml.Node{Type: nethtml.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := nethtml.ParseFragment(strings.NewReader(htmlText), body)
+	if err != nil {
+		return htmlText
+	}
+	for _, n := range nodes {
+		body.AppendChild(n)
+	}
+	transformLJMarkup(body, newMarkupContext(postURL))
+	rendered, err := renderInnerNode(body)
+	if err != nil {
+		return htmlText
+	}
+	return rendered
+}
+
+// transformLJMarkup преобразует разметку ЖЖ в поддереве n.
+func transformLJMarkup(n *nethtml.Node, ctx *markupContext) {
+	hoistSelfClosing(n)
+	wrapRenderedCuts(n, ctx)
+	transformNode(n, ctx)
+}
+
+func transformNode(n *nethtml.Node, ctx *markupContext) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == nethtml.ElementNode {
+			if replacement := replaceElement(c, ctx); replacement != nil {
+				n.InsertBefore(replacement, c)
+				n.RemoveChild(c)
+				c = next
+				continue
+			}
+			transformNode(c, ctx)
+		}
+		c = next
+	}
+}
+
+// replaceElement возвращает замену элемента или nil, если он остается как есть.
+func replaceElement(n *nethtml.Node, ctx *markupContext) *nethtml.Node {
+	switch {
+	case n.Data == "lj" && (getAttr(n, "user") != "" || getAttr(n, "comm") != ""):
+		name := getAttr(n, "user")
+		if name == "" {
+			name = getAttr(n, "comm")
+		}
+		return userLink(name, ctx)
+	case n.Data == "span" && ljUserName(n) != "":
+		return userLink(ljUserName(n), ctx)
+	case n.Data == "lj-cut":
+		transformNode(n, ctx)
+		return cutReveal(getAttr(n, "text"), detachChildren(n), ctx)
+	case n.Data == "lj-embed":
+		return rawNode(fmt.Sprintf(`<span class="lj-embed">Встроенное содержимое (lj-embed %s) недоступно вне ЖЖ</span>`, html.EscapeString(getAttr(n, "id"))))
+	case n.Data == "iframe" || n.Data == "embed":
+		if link := embedLink(getAttr(n, "src")); link != "" {
+			return rawNode(link)
+		}
+	case n.Data == "object":
+		if link := embedLink(objectSource(n)); link != "" {
+			return rawNode(link)
+		}
+	case isPoll(n):
+		return rawNode(pollTable(n))
+	}
+	return nil
+}
+
+// --- ПОЛЬЗОВАТЕЛИ ---
+
+// ljUserName возвращает имя из отрисованного span.ljuser.
+func ljUserName(n *nethtml.Node) string {
+	if name := getAttr(n, "lj:user"); name != "" {
+		return name
+	}
+	if name := getAttr(n, "data-ljuser"); name != "" {
+		return name
+	}
+	if strings.Contains(" "+getAttr(n, "class")+" ", " ljuser ") {
+		return strings.TrimSpace(textContent(n))
+	}
+	return ""
+}
+
+// userLink - ссылка на журнал пользователя. В поддомене подчеркивания заменяются дефисами.
+func userLink(name string, ctx *markupContext) *nethtml.Node {
+	name = strings.TrimSpace(name)
+	host := strings.ReplaceAll(strings.ToLower(name), "_", "-")
+	href := fmt.Sprintf("https://%s.%s/", host, ctx.Domain)
+	return rawNode(fmt.Sprintf(`<a class="lj-user" href="%s">%s</a>`, html.EscapeString(href), html.EscapeString(name)))
+}
+
+// --- LJ-CUT ---
+
+var cutAnchor = regexp.MustCompile(`^cutid(\d+)$`)
+
+// wrapRenderedCuts заворачивает текст между якорями cutidN и cutidN-end
+// (так ЖЖ отрисовывает lj-cut на странице записи) в $reveal.
+// Если закрывающий якорь не найден на том же уровне, под кат уходит
+// все до конца родительского элемента.
+func wrapRenderedCuts(n *nethtml.Node, ctx *markupContext) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != nethtml.ElementNode {
+			continue
+		}
+		m := cutAnchor.FindStringSubmatch(getAttr(c, "name"))
+		if c.Data != "a" || m == nil {
+			wrapRenderedCuts(c, ctx)
+			continue
+		}
+		var content []*nethtml.Node
+		for s := c.NextSibling; s != nil; {
+			next := s.NextSibling
+			if s.Type == nethtml.ElementNode && s.Data == "a" && getAttr(s, "name") == "cutid"+m[1]+"-end" {
+				n.RemoveChild(s)
+				break
+			}
+			n.RemoveChild(s)
+			content = append(content, s)
+			s = next
+		}
+		if len(content) == 0 {
+			continue
+		}
+		wrapper := &nethtml.Node{Type: nethtml.ElementNode, Data: "div"}
+		for _, s := range content {
+			wrapper.AppendChild(s)
+		}
+		wrapRenderedCuts(wrapper, ctx)
+		transformNode(wrapper, ctx)
+		n.InsertBefore(cutReveal("", detachChildren(wrapper), ctx), c.NextSibling)
+	}
+}
+
+// cutReveal собирает раскрывающийся блок: кнопка с текстом ката
+// и содержимое, видимое после нажатия.
+func cutReveal(text string, content []*nethtml.Node, ctx *markupContext) *nethtml.Node {
+	ctx.cuts++
+	if strings.TrimSpace(text) == "" {
+		text = "Читать дальше"
+	}
+	state := html.EscapeString(fmt.Sprintf("$:/state/lj-cut/%s/%d", ctx.PostURL, ctx.cuts))
+	text = html.EscapeString(text)
+
+	var inner bytes.Buffer
+	for _, c := range content {
+		nethtml.Render(&inner, c)
+	}
+	return rawNode(fmt.Sprintf(`<$reveal type="nomatch" state="%[1]s" text="open"><$button class="tc-btn-invisible lj-cut" set="%[1]s" setTo="open">( %[2]s )</$button></$reveal><$reveal type="match" state="%[1]s" text="open"><$button class="tc-btn-invisible lj-cut" set="%[1]s" setTo="closed">( Свернуть )</$button>
+
+%[3]s
+
+</$reveal>`, state, text, inner.String()))
+}
+
+// --- ВСТРАИВАНИЯ ---
+
+// embedLink превращает адрес встроенного плеера в ссылку на страницу у провайдера.
+// Плеер ЖЖ (l.lj-toys.com) передает провайдера и идентификатор в параметрах source и vid.
+func embedLink(src string) string {
+	src = strings.TrimSpace(src)
+	if src == "" {
+		return ""
+	}
+	if strings.HasPrefix(src, "//") {
+		src = "https:" + src
+	}
+	u, err := url.Parse(src)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	var provider, page string
+	switch {
+	case strings.HasSuffix(host, "lj-toys.com"):
+		provider, page = providerPage(u.Query().Get("source"), u.Query().Get("vid"))
+		if page == "" {
+			return `<span class="lj-embed">Встроенное содержимое ЖЖ недоступно</span>`
+		}
+	case host == "youtube.com" || host == "youtube-nocookie.com" || host == "m.youtube.com":
+		// /embed/ID и старый flash-плеер /v/ID
+		parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(parts) == 2 && (parts[0] == "embed" || parts[0] == "v") {
+			provider, page = providerPage("youtube", parts[1])
+		}
+	case host == "player.vimeo.com":
+		provider, page = providerPage("vimeo", strings.TrimPrefix(u.Path, "/video/"))
+	case host == "rutube.ru":
+		provider, page = providerPage("rutube", strings.TrimPrefix(strings.TrimPrefix(u.Path, "/play/embed/"), "/video/embed/"))
+	}
+	if page == "" {
+		return fmt.Sprintf(`<a class="lj-embed" href="%s">Встроенное содержимое: %s</a>`, html.EscapeString(src), html.EscapeString(host))
+	}
+	return fmt.Sprintf(`<a class="lj-embed" href="%s">Видео: %s</a>`, html.EscapeString(page), html.EscapeString(provider))
+}
+
+// providerPage возвращает название провайдера и страницу видео.
+func providerPage(source, id string) (string, string) {
+	id = strings.Trim(id, "/")
+	if id == "" {
+		return "", ""
+	}
+	switch strings.ToLower(source) {
+	case "youtube":
+		return "YouTube", "https://www.youtube.com/watch?v=" + url.QueryEscape(id)
+	case "vimeo":
+		return "Vimeo", "https://vimeo.com/" + url.PathEscape(id)
+	case "rutube":
+		return "Rutube", "https://rutube.ru/video/" + url.PathEscape(id) + "/"
+	case "dailymotion":
+		return "Dailymotion", "https://www.dailymotion.com/video/" + url.PathEscape(id)
+	}
+	return "", ""
+}
+
+// objectSource возвращает адрес ролика из старого flash-встраивания <object>.
+func objectSource(n *nethtml.Node) string {
+	if data := getAttr(n, "data"); data != "" {
+		return data
+	}
+	var src string
+	var walk func(*nethtml.Node)
+	walk = func(c *nethtml.Node) {
+		if src != "" {
+			return
+		}
+		if c.Type == nethtml.ElementNode {
+			if c.Data == "param" && strings.EqualFold(getAttr(c, "name"), "movie") {
+				src = getAttr(c, "value")
+			} else if c.Data == "embed" {
+				src = getAttr(c, "src")
+			}
+		}
+		for cc := c.FirstChild; cc != nil; cc = cc.NextSibling {
+			walk(cc)
+		}
+	}
+	walk(n)
+	return src
+}
+
+// --- ОПРОСЫ ---
+
+var (
+	pollIDPattern    = regexp.MustCompile(`^poll[-_]?(\d+)$`)
+	pollCountPattern = regexp.MustCompile(`(\d+)\s*\(\s*(\d+(?:[.,]\d+)?%)\s*\)`)
+)
+
+// isPoll распознает опрос: исходный <lj-poll> или отрисованный блок
+// с классом poll (b-poll, ljpoll) или id вида poll12345.
+func isPoll(n *nethtml.Node) bool {
+	if n.Data == "lj-poll" {
+		return true
+	}
+	if n.Data != "div" && n.Data != "form" {
+		return false
+	}
+	class := " " + getAttr(n, "class") + " "
+	return strings.Contains(class, " b-poll ") || strings.Contains(class, " ljpoll ") || pollIDPattern.MatchString(getAttr(n, "id"))
+}
+
+type pollQuestion struct {
+	Text    string
+	Answers [][2]string // вариант, результат
+}
+
+// pollTable выводит опрос статической таблицей. Для исходного <lj-poll>
+// результатов нет, выводятся только вопросы и варианты ответов.
+func pollTable(n *nethtml.Node) string {
+	name := getAttr(n, "name")
+	var questions []pollQuestion
+	if n.Data == "lj-poll" {
+		for q := n.FirstChild; q != nil; q = q.NextSibling {
+			if q.Type != nethtml.ElementNode || q.Data != "lj-pq" {
+				continue
+			}
+			question := pollQuestion{}
+			for c := q.FirstChild; c != nil; c = c.NextSibling {
+				if c.Type == nethtml.ElementNode && c.Data == "lj-pi" {
+					question.Answers = append(question.Answers, [2]string{strings.TrimSpace(textContent(c)), ""})
+				} else {
+					question.Text += textContent(c)
+				}
+			}
+			question.Text = strings.TrimSpace(question.Text)
+			questions = append(questions, question)
+		}
+	} else {
+		questions = renderedPollQuestions(n)
+	}
+
+	var b strings.Builder
+	b.WriteString(`<table class="lj-poll">`)
+	caption := "Опрос"
+	if name != "" {
+		caption += ": " + name
+	}
+	if m := pollIDPattern.FindStringSubmatch(getAttr(n, "id")); m != nil {
+		caption += fmt.Sprintf(" (#%s)", m[1])
+	}
+	fmt.Fprintf(&b, "<caption>%s</caption>", html.EscapeString(caption))
+	for _, q := range questions {
+		if q.Text != "" {
+			fmt.Fprintf(&b, `<tr><th colspan="2">%s</th></tr>`, html.EscapeString(q.Text))
+		}
+		for _, a := range q.Answers {
+			fmt.Fprintf(&b, "<tr><td>%s</td><td>%s</td></tr>", html.EscapeString(a[0]), html.EscapeString(a[1]))
+		}
+	}
+	if len(questions) == 0 {
+		fmt.Fprintf(&b, `<tr><td colspan="2">%s</td></tr>`, html.EscapeString(collapseSpaces(textContent(n))))
+	}
+	b.WriteString("</table>")
+	return b.String()
+}
+
+// renderedPollQuestions разбирает отрисованный опрос. Вопросы - элементы
+// с классом *question*, варианты - элементы с классом *answer* или *item*
+// либо строки таблицы; результат - текст вида "12 (34.5%)".
+func renderedPollQuestions(n *nethtml.Node) []pollQuestion {
+	var questions []pollQuestion
+	var walk func(*nethtml.Node)
+	walk = func(c *nethtml.Node) {
+		if c.Type == nethtml.ElementNode {
+			class := getAttr(c, "class")
+			switch {
+			case strings.Contains(class, "question"):
+				questions = append(questions, pollQuestion{Text: collapseSpaces(textContent(c))})
+				return
+			case strings.Contains(class, "answer") || strings.Contains(class, "item") || c.Data == "tr":
+				text := collapseSpaces(textContent(c))
+				if text == "" {
+					return
+				}
+				if len(questions) == 0 {
+					questions = append(questions, pollQuestion{})
+				}
+				answer := [2]string{text, ""}
+				if loc := pollCountPattern.FindStringIndex(text); loc != nil {
+					answer = [2]string{strings.TrimSpace(text[:loc[0]] + text[loc[1]:]), text[loc[0]:loc[1]]}
+				}
+				q := &questions[len(questions)-1]
+				q.Answers = append(q.Answers, answer)
+				return
+			}
+		}
+		for cc := c.FirstChild; cc != nil; cc = cc.NextSibling {
+			walk(cc)
+		}
+	}
+	walk(n)
+	return questions
+}
+
+// --- ВСПОМОГАТЕЛЬНЫЕ ---
+
+// hoistSelfClosing выносит содержимое из <lj user="..." /> и <lj-embed ... />:
+// парсер HTML не знает этих тегов и считает следующий текст их содержимым.
+func hoistSelfClosing(n *nethtml.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == nethtml.ElementNode && (c.Data == "lj" || c.Data == "lj-embed") {
+			// Вынесенные узлы становятся следующими соседями и обрабатываются дальше в этом же цикле.
+			after := c
+			for _, child := range detachChildren(c) {
+				n.InsertBefore(child, after.NextSibling)
+				after = child
+			}
+			continue
+		}
+		hoistSelfClosing(c)
+	}
+}
+
+func detachChildren(n *nethtml.Node) []*nethtml.Node {
+	var children []*nethtml.Node
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		n.RemoveChild(c)
+		children = append(children, c)
+		c = next
+	}
+	return children
+}
+
+func rawNode(s string) *nethtml.Node {
+	return &nethtml.Node{Type: nethtml.RawNode, Data: s}
+}
+
+func textContent(n *nethtml.Node) string {
+	if n.Type == nethtml.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(textContent(c))
+	}
+	return b.String()
+}
+
+func collapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,233 @@
+package livejournal
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"tiddlywiki-converter/tags"
+	"tiddlywiki-converter/tiddlywiki"
+)
+
+// =============================================================================
+// МЕТАДАННЫЕ ЗАПИСИ
+// =============================================================================
+//
+// Кроме OpenGraph страница записи содержит дату публикации, «текущие»
+// (настроение, музыка, место), уровень доступа, число комментариев и юзерпик.
+// Разметка зависит от стиля журнала, поэтому каждое значение ищется
+// в нескольких известных вариантах.
+
+// Уровни доступа записи.
+const (
+	SecurityPublic  = "public"
+	SecurityFriends = "friends"
+	SecurityPrivate = "private"
+	SecurityCustom  = "custom"
+)
+
+var (
+	entryTimeLayouts = []string{
+		time.RFC3339,
+		"2006-01-02T15:04:05",
+		"2006-01-02 15:04:05",
+		"2006-01-02 15:04",
+		"January 2 2006, 15:04",
+		"January 2nd, 2006, 15:04",
+	}
+	securityJSONPattern  = regexp.MustCompile(`"security"\s*:\s*"(\w+)"`)
+	allowmaskPattern     = regexp.MustCompile(`"allowmask"\s*:\s*"?(\d+)`)
+	replyCountPattern    = regexp.MustCompile(`"replycount"\s*:\s*"?(\d+)`)
+	entryPublishedJSON   = regexp.MustCompile(`"eventtime"\s*:\s*"([^"]+)"`)
+	currentsLabelPattern = regexp.MustCompile(`^[^:]{1,40}:\s*`)
+)
+
+// parseEntryTime разбирает дату записи в одном из форматов ЖЖ.
+// Время без часового пояса - местное время журнала, оно сохраняется как есть.
+func parseEntryTime(s string) (time.Time, bool) {
+	s = collapseSpaces(s)
+	for _, layout := range entryTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseEntryMetadata дополняет post метаданными со страницы записи.
+func parseEntryMetadata(doc *html.Node, htmlBody []byte, post *LivejournalPost) {
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			class := getAttr(n, "class")
+			switch {
+			case n.Data == "meta":
+				content := getAttr(n, "content")
+				switch getAttr(n, "property") {
+				case "article:published_time":
+					if t, ok := parseEntryTime(content); ok && post.Published.IsZero() {
+						post.Published = t
+					}
+				case "article:modified_time":
+					if t, ok := parseEntryTime(content); ok && post.Updated.IsZero() {
+						post.Updated = t
+					}
+				}
+			case n.Data == "time" || n.Data == "abbr":
+				value := getAttr(n, "datetime")
+				if value == "" {
+					value = getAttr(n, "title")
+				}
+				if value == "" {
+					value = textContent(n)
+				}
+				t, ok := parseEntryTime(value)
+				switch {
+				case !ok:
+				case strings.Contains(class, "published") && post.Published.IsZero():
+					post.Published = t
+				case strings.Contains(class, "updated") && post.Updated.IsZero():
+					post.Updated = t
+				}
+			case hasCurrent(class, "mood"):
+				setCurrent(&post.Mood, n)
+			case hasCurrent(class, "music"):
+				setCurrent(&post.Music, n)
+			case hasCurrent(class, "location"):
+				setCurrent(&post.Location, n)
+			case n.Data == "img" && post.Userpic == "" && (strings.Contains(class, "userpic") || strings.Contains(getAttr(n.Parent, "class"), "userpic")):
+				post.Userpic = getAttr(n, "src")
+			case n.Data == "img" || n.Data == "span":
+				if security := securityFromIcon(class + " " + getAttr(n, "src") + " " + getAttr(n, "alt")); security != "" && post.Security == "" {
+					post.Security = security
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	if post.Published.IsZero() {
+		if m := entryPublishedJSON.FindSubmatch(htmlBody); m != nil {
+			post.Published, _ = parseEntryTime(string(m[1]))
+		}
+	}
+	// Данные Site.page надежнее иконок стиля.
+	if m := securityJSONPattern.FindSubmatch(htmlBody); m != nil {
+		post.Security = securityFromJSON(string(m[1]), allowmaskPattern.FindSubmatch(htmlBody))
+	}
+	if post.Security == "" {
+		post.Security = SecurityPublic
+	}
+	if m := replyCountPattern.FindSubmatch(htmlBody); m != nil {
+		post.CommentCount, _ = strconv.Atoi(string(m[1]))
+	}
+}
+
+// hasCurrent проверяет класс блока «текущего»: b-singlepost-currents-item-mood,
+// current-mood, currentmood и т.п.
+func hasCurrent(class, name string) bool {
+	class = strings.ToLower(class)
+	return strings.Contains(class, "currents-item-"+name) || strings.Contains(class, "current-"+name) ||
+		strings.Contains(class, "current"+name)
+}
+
+// setCurrent сохраняет значение «текущего» без подписи «Настроение:».
+func setCurrent(dst *string, n *html.Node) {
+	if *dst != "" {
+		return
+	}
+	*dst = currentsLabelPattern.ReplaceAllString(collapseSpaces(textContent(n)), "")
+}
+
+// securityFromIcon определяет уровень доступа по иконке замка.
+func securityFromIcon(s string) string {
+	s = strings.ToLower(s)
+	switch {
+	case strings.Contains(s, "posticon-private") || strings.Contains(s, "icon_private") || strings.Contains(s, "[private post]"):
+		return SecurityPrivate
+	case strings.Contains(s, "posticon-custom") || strings.Contains(s, "icon_groups") || strings.Contains(s, "[custom friends-only post]"):
+		return SecurityCustom
+	case strings.Contains(s, "posticon-friends") || strings.Contains(s, "posticon-protected") ||
+		strings.Contains(s, "icon_protected") || strings.Contains(s, "[friends-only post]") || strings.Contains(s, "[protected post]"):
+		return SecurityFriends
+	}
+	return ""
+}
+
+// securityFromJSON переводит значения API ЖЖ: usemask с маской 1 - только
+// для друзей, с другой маской - для выбранных групп.
+func securityFromJSON(security string, allowmask [][]byte) string {
+	switch security {
+	case "private":
+		return SecurityPrivate
+	case "usemask":
+		if allowmask != nil && string(allowmask[1]) != "1" {
+			return SecurityCustom
+		}
+		return SecurityFriends
+	}
+	return SecurityPublic
+}
+
+// postTitles следит за заголовками записей при импорте всего журнала.
+// Запись с уже занятой темой получает к заголовку свой номер (ditemid):
+// иначе ее тиддлер перезаписал бы предыдущий, а комментарии обеих записей
+// оказались бы под одной.
+type postTitles map[string]bool
+
+func (used postTitles) claim(post *LivejournalPost, ditemid int64) {
+	title := post.Title
+	if used[title] {
+		title = fmt.Sprintf("%s (%d)", post.Title, ditemid)
+	}
+	for n := 2; used[title]; n++ {
+		title = fmt.Sprintf("%s (%d-%d)", post.Title, ditemid, n)
+	}
+	used[title] = true
+	post.Title = title
+}
+
+// newPostTiddler создает тиддлер записи. Используется всеми источниками
+// (страницы журнала, XML-RPC, архивы), чтобы поля записей совпадали.
+func newPostTiddler(post *LivejournalPost) *tiddlywiki.Tiddler {
+	body := post.Body
+	if post.URL != "" {
+		body += fmt.Sprintf("\n\n---\n\n''Оригинал поста:'' <a href=\"%s\" target=\"_blank\">%s</a>", post.URL, post.URL)
+	}
+
+	postTiddler := tiddlywiki.NewTiddler(post.Title, body, tiddlywiki.StringifyList(tags.NormalizeList(post.Tags)))
+	postTiddler.Fields["url"] = post.URL
+	postTiddler.Fields[tiddlywiki.FieldSourceURL] = post.URL
+	postTiddler.Fields[tiddlywiki.FieldImportType] = tiddlywiki.ImportTypePost
+	if post.Author != "" {
+		postTiddler.Fields[tiddlywiki.FieldAuthor] = post.Author
+	}
+	if !post.Published.IsZero() {
+		postTiddler.Created = post.Published.UTC().Format(tiddlywiki.TiddlyTimeFormat)
+		postTiddler.Modified = postTiddler.Created
+		if post.Updated.After(post.Published) {
+			postTiddler.Modified = post.Updated.UTC().Format(tiddlywiki.TiddlyTimeFormat)
+		}
+	}
+	for field, value := range map[string]string{
+		"mood":     post.Mood,
+		"music":    post.Music,
+		"location": post.Location,
+		"security": post.Security,
+		"userpic":  post.Userpic,
+	} {
+		if value != "" {
+			postTiddler.Fields[field] = value
+		}
+	}
+	if post.CommentCount > 0 {
+		postTiddler.Fields["comment-count"] = strconv.Itoa(post.CommentCount)
+	}
+	return postTiddler
+}
@@ -0,0 +1,321 @@
+package livejournal
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"tiddlywiki-converter/tiddlywiki"
+)
+
+// =============================================================================
+// ИМПОРТ ЧЕРЕЗ ПРОТОКОЛ XML-RPC
+// =============================================================================
+//
+// Список записей берется методом syncitems, каждая запись - getevents
+// с selecttype=one, комментарии - getcomments. Каждый вызов авторизуется
+// отдельным одноразовым вызовом getchallenge: пароль по сети не передается.
+// Dreamwidth не поддерживает getcomments - тогда записи импортируются
+// без комментариев.
+
+// protocolClient - сеанс работы с сервером протокола.
+type protocolClient struct {
+	http     *http.Client
+	endpoint string
+	username string
+	password string
+	journal  string // журнал или сообщество, если он не совпадает с логином
+}
+
+// call выполняет метод с авторизацией challenge-response:
+// auth_response = md5(challenge + md5(password)).
+func (c *protocolClient) call(method string, params map[string]interface{}) (map[string]interface{}, error) {
+	challenge, err := xmlrpcCall(c.http, c.endpoint, "LJ.XMLRPC.getchallenge", map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	ch := rpcString(challenge["challenge"])
+	passwordHash := md5.Sum([]byte(c.password))
+	response := md5.Sum([]byte(ch + hex.EncodeToString(passwordHash[:])))
+
+	params["username"] = c.username
+	params["auth_method"] = "challenge"
+	params["auth_challenge"] = ch
+	params["auth_response"] = hex.EncodeToString(response[:])
+	params["ver"] = 1
+	if c.journal != "" && !strings.EqualFold(c.journal, c.username) {
+		params["usejournal"] = c.journal
+	}
+	return xmlrpcCall(c.http, c.endpoint, "LJ.XMLRPC."+method, params)
+}
+
+// journalFromURL возвращает имя журнала по адресу: user.livejournal.com -> user,
+// www.livejournal.com/users/user/ и /community/name/ -> user, name,
+// community.livejournal.com/name/ -> name.
+func journalFromURL(pageURL string) string {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return ""
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) >= 2 && (parts[0] == "users" || parts[0] == "community" || parts[0] == "~") {
+		return parts[1]
+	}
+	if (strings.HasPrefix(u.Host, "community.") || strings.HasPrefix(u.Host, "users.")) && parts[0] != "" {
+		return parts[0]
+	}
+	labels := strings.Split(u.Hostname(), ".")
+	if len(labels) >= 3 && labels[0] != "www" {
+		return strings.ReplaceAll(labels[0], "-", "_")
+	}
+	return ""
+}
+
+var postItemPattern = regexp.MustCompile(`/(\d+)\.html$`)
+
+// convertViaProtocol импортирует журнал через XML-RPC. Если адрес ведет
+// на одну запись, импортируется только она; для страницы тега - записи с этим
+// тегом. Записи вне периода opts.From - opts.To пропускаются.
+func convertViaProtocol(pageURL string, opts Options, client *http.Client) ([]*tiddlywiki.Tiddler, error) {
+	if opts.Username == "" || opts.Password == "" {
+		return nil, fmt.Errorf("для протокола LiveJournal нужны логин и пароль (LJ_USERNAME и LJ_PASSWORD)")
+	}
+	c := &protocolClient{
+		http:     client,
+		endpoint: opts.endpoint(),
+		username: opts.Username,
+		password: opts.Password,
+		journal:  journalFromURL(pageURL),
+	}
+	log.Printf("Импорт через протокол %s, журнал: %s", c.endpoint, firstNonEmpty(c.journal, c.username))
+
+	var itemIDs []int64
+	filter := postFilter{Dates: opts.dateRange(), Tag: tagFromURL(pageURL)}
+	if m := postItemPattern.FindStringSubmatch(pageURL); m != nil {
+		ditemid, _ := strconv.ParseInt(m[1], 10, 64)
+		itemIDs = []int64{ditemid / 256}
+		filter = postFilter{}
+	} else {
+		var err error
+		if itemIDs, err = c.syncItems(); err != nil {
+			return nil, err
+		}
+		log.Printf("Записей в журнале: %d", len(itemIDs))
+	}
+
+	var allTiddlers []*tiddlywiki.Tiddler
+	titles := make(postTitles)
+	commentsSupported := true
+	for _, itemID := range itemIDs {
+		post, ditemid, err := c.getEvent(itemID)
+		if err != nil {
+			log.Printf("! Ошибка загрузки записи %d: %v", itemID, err)
+			continue
+		}
+		if post == nil || !filter.accepts(post) {
+			continue
+		}
+		var comments []ljComment
+		if commentsSupported && post.CommentCount > 0 {
+			comments, err = c.getComments(ditemid, post.URL)
+			if fault, ok := err.(*xmlrpcFault); ok && strings.Contains(strings.ToLower(fault.Text), "unknown method") {
+				log.Printf("! Сервер не поддерживает getcomments, комментарии не импортируются.")
+				commentsSupported = false
+			} else if err != nil {
+				log.Printf("! Ошибка загрузки комментариев записи %s: %v", post.URL, err)
+			}
+			logCommentCount(post.Title, post.CommentCount, len(comments))
+		}
+		titles.claim(post, ditemid)
+		allTiddlers = append(allTiddlers, newPostTiddler(post))
+		allTiddlers = append(allTiddlers, buildCommentTiddlers(comments, post.Title)...)
+	}
+	return allTiddlers, nil
+}
+
+// syncItems возвращает номера всех записей журнала. Сервер отдает список
+// частями; следующая часть запрашивается от времени последнего элемента.
+func (c *protocolClient) syncItems() ([]int64, error) {
+	var itemIDs []int64
+	seen := make(map[int64]bool)
+	lastSync := ""
+	for {
+		params := map[string]interface{}{}
+		if lastSync != "" {
+			params["lastsync"] = lastSync
+		}
+		result, err := c.call("syncitems", params)
+		if err != nil {
+			return nil, err
+		}
+		items, _ := result["syncitems"].([]interface{})
+		if len(items) == 0 {
+			break
+		}
+		progressed := false
+		for _, raw := range items {
+			item, _ := raw.(map[string]interface{})
+			name := rpcString(item["item"]) // L-123 - запись, C-456 - комментарий
+			if t := rpcString(item["time"]); t > lastSync {
+				lastSync = t
+				progressed = true
+			}
+			if !strings.HasPrefix(name, "L-") {
+				continue
+			}
+			id, err := strconv.ParseInt(strings.TrimPrefix(name, "L-"), 10, 64)
+			if err == nil && !seen[id] {
+				seen[id] = true
+				itemIDs = append(itemIDs, id)
+			}
+		}
+		if !progressed || jsonInt(result["count"]) >= jsonInt(result["total"]) {
+			break
+		}
+	}
+	return itemIDs, nil
+}
+
+// getEvent загружает запись. Для удаленной записи возвращает nil без ошибки.
+func (c *protocolClient) getEvent(itemID int64) (*LivejournalPost, int64, error) {
+	result, err := c.call("getevents", map[string]interface{}{
+		"selecttype":  "one",
+		"itemid":      itemID,
+		"lineendings": "unix",
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	events, _ := result["events"].([]interface{})
+	if len(events) == 0 {
+		return nil, 0, nil
+	}
+	event, _ := events[0].(map[string]interface{})
+	ditemid := jsonInt(event["itemid"])*256 + jsonInt(event["anum"])
+	return postFromEvent(event, ditemid), ditemid, nil
+}
+
+// postFromEvent собирает запись из события протокола (getevents, ljdump).
+func postFromEvent(event map[string]interface{}, ditemid int64) *LivejournalPost {
+	props, _ := event["props"].(map[string]interface{})
+	post := &LivejournalPost{
+		Title:    strings.TrimSpace(rpcString(event["subject"])),
+		URL:      rpcString(event["url"]),
+		Tags:     make([]string, 0),
+		Mood:     rpcString(props["current_mood"]),
+		Music:    rpcString(props["current_music"]),
+		Location: rpcString(props["current_location"]),
+		Security: securityFromJSON(rpcString(event["security"]), nil),
+	}
+	if post.Security == SecurityFriends && jsonInt(event["allowmask"]) > 1 {
+		post.Security = SecurityCustom
+	}
+	if post.Title == "" {
+		post.Title = fmt.Sprintf("Запись %d", ditemid)
+	}
+	if poster := rpcString(event["poster"]); poster != "" {
+		post.Author = poster
+	}
+	for _, tag := range strings.Split(rpcString(props["taglist"]), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			post.Tags = append(post.Tags, tag)
+		}
+	}
+	post.Published, _ = parseEntryTime(rpcString(event["eventtime"]))
+	if ts := jsonInt(props["revtime"]); ts > 0 {
+		post.Updated = time.Unix(ts, 0).UTC()
+	}
+	post.CommentCount = int(jsonInt(event["reply_count"]))
+
+	// В исходном тексте переводы строк - это абзацы, если запись не помечена
+	// как уже отформатированная.
+	text := rpcString(event["event"])
+	if jsonInt(props["opt_preformatted"]) == 0 {
+		text = strings.ReplaceAll(text, "\n", "<br>\n")
+	}
+	post.Body = convertLJMarkup(text, post.URL)
+	return post
+}
+
+// getComments загружает все страницы комментариев записи.
+// Ответы вложены в children, дерево разворачивается в плоский список.
+func (c *protocolClient) getComments(ditemid int64, postURL string) ([]ljComment, error) {
+	collector := &commentCollector{byID: make(map[int64]int)}
+	for page := int64(1); ; page++ {
+		params := map[string]interface{}{
+			"ditemid":         ditemid,
+			"page":            page,
+			"expand_strategy": "expand_all",
+		}
+		if c.journal != "" {
+			params["journal"] = c.journal
+		} else {
+			params["journal"] = c.username
+		}
+		result, err := c.call("getcomments", params)
+		if err != nil {
+			return collector.comments, err
+		}
+		items, _ := result["comments"].([]interface{})
+		collector.add(flattenProtocolComments(items, 0, postURL))
+		if page >= jsonInt(result["pages"]) {
+			break
+		}
+	}
+	return collector.comments, nil
+}
+
+func flattenProtocolComments(items []interface{}, parent int64, postURL string) []ljComment {
+	var comments []ljComment
+	for _, raw := range items {
+		item, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		id := jsonInt(item["dtalkid"])
+		if id == 0 {
+			continue
+		}
+		comment := ljComment{
+			ID:      id,
+			Parent:  parent,
+			Author:  rpcString(item["postername"]),
+			CtimeTS: jsonInt(item["datepostunix"]),
+			Loaded:  true,
+			Deleted: rpcString(item["state"]) == "D",
+		}
+		if p := jsonInt(item["parentdtalkid"]); p != 0 {
+			comment.Parent = p
+		}
+		if postURL != "" {
+			comment.ThreadURL = fmt.Sprintf("%s?thread=%d#t%d", postURL, id, id)
+		}
+		if !comment.Deleted {
+			body := rpcString(item["body"])
+			if subject := rpcString(item["subject"]); subject != "" {
+				body = "<b>" + subject + "</b><br>\n" + body
+			}
+			comment.Article = &body
+		}
+		comments = append(comments, comment)
+		children, _ := item["children"].([]interface{})
+		comments = append(comments, flattenProtocolComments(children, id, postURL)...)
+	}
+	return comments
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,266 @@
+package livejournal
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"tiddlywiki-converter/tiddlywiki"
+)
+
+const (
+	testUser     = "user"
+	testPassword = "secret"
+)
+
+// protocolStub - локальная замена сервера протокола ЖЖ: выдает одноразовые
+// challenge, проверяет auth_response и отвечает на syncitems, getevents и
+// getcomments. С noComments ведет себя как Dreamwidth: getcomments неизвестен.
+type protocolStub struct {
+	t          *testing.T
+	noComments bool
+
+	mu         sync.Mutex
+	challenges map[string]bool
+	calls      map[string]int
+	lastSyncs  []string
+}
+
+func newProtocolStub(t *testing.T, noComments bool) *protocolStub {
+	return &protocolStub{t: t, noComments: noComments, challenges: make(map[string]bool), calls: make(map[string]int)}
+}
+
+func (s *protocolStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var call struct {
+		Method string        `xml:"methodName"`
+		Params []xmlrpcValue `xml:"params>param>value"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&call); err != nil {
+		s.t.Errorf("некорректный запрос: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	params := map[string]interface{}{}
+	if len(call.Params) > 0 {
+		params, _ = call.Params[0].decode().(map[string]interface{})
+	}
+	method := strings.TrimPrefix(call.Method, "LJ.XMLRPC.")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls[method]++
+
+	if method == "getchallenge" {
+		ch := fmt.Sprintf("c%d", len(s.challenges)+1)
+		s.challenges[ch] = true
+		writeResult(w, map[string]interface{}{"challenge": ch, "auth_scheme": "c0", "expire_time": int64(0)})
+		return
+	}
+
+	ch := rpcString(params["auth_challenge"])
+	passwordHash := md5.Sum([]byte(testPassword))
+	expected := md5.Sum([]byte(ch + hex.EncodeToString(passwordHash[:])))
+	if !s.challenges[ch] || rpcString(params["auth_response"]) != hex.EncodeToString(expected[:]) || rpcString(params["username"]) != testUser {
+		writeFault(w, 101, "Invalid password")
+		return
+	}
+	delete(s.challenges, ch) // challenge одноразовый
+	if _, ok := params["usejournal"]; ok {
+		s.t.Errorf("%s: usejournal передан для собственного журнала", method)
+	}
+
+	switch method {
+	case "syncitems":
+		lastSync := rpcString(params["lastsync"])
+		s.lastSyncs = append(s.lastSyncs, lastSync)
+		if lastSync == "" {
+			writeResult(w, map[string]interface{}{"count": int64(3), "total": int64(4), "syncitems": []interface{}{
+				syncItem("L-1", "2004-01-01 10:00:00"),
+				syncItem("C-5", "2004-01-01 11:00:00"),
+				syncItem("L-2", "2004-01-02 10:00:00"),
+			}})
+			return
+		}
+		writeResult(w, map[string]interface{}{"count": int64(1), "total": int64(1), "syncitems": []interface{}{
+			syncItem("L-3", "2004-01-03 10:00:00"),
+		}})
+	case "getevents":
+		itemID := jsonInt(params["itemid"])
+		if rpcString(params["selecttype"]) != "one" {
+			s.t.Errorf("getevents: selecttype = %q", rpcString(params["selecttype"]))
+		}
+		if itemID == 2 {
+			writeResult(w, map[string]interface{}{"events": []interface{}{}}) // удаленная запись
+			return
+		}
+		replies := int64(0)
+		if itemID == 1 {
+			replies = 3
+		}
+		writeResult(w, map[string]interface{}{"events": []interface{}{map[string]interface{}{
+			"itemid":      itemID,
+			"anum":        int64(7),
+			"subject":     "Запись 1", // у записи 3 та же тема, что у записи 1
+			"event":       "строка 1\nстрока 2",
+			"eventtime":   fmt.Sprintf("2004-01-0%d 10:00:00", itemID),
+			"url":         fmt.Sprintf("https://user.livejournal.com/%d.html", itemID*256+7),
+			"reply_count": replies,
+			"props":       map[string]interface{}{"taglist": "a, b", "current_mood": "happy"},
+		}}})
+	case "getcomments":
+		if s.noComments {
+			writeFault(w, 300, "Unknown method (LJ.XMLRPC.getcomments)")
+			return
+		}
+		if jsonInt(params["ditemid"]) != 1*256+7 || rpcString(params["journal"]) != testUser {
+			s.t.Errorf("getcomments: ditemid=%v journal=%v", params["ditemid"], params["journal"])
+		}
+		if jsonInt(params["page"]) == 1 {
+			writeResult(w, map[string]interface{}{"pages": int64(2), "comments": []interface{}{map[string]interface{}{
+				"dtalkid": int64(263), "postername": "friend", "datepostunix": int64(1073000000), "body": "первый",
+				"children": []interface{}{map[string]interface{}{
+					"dtalkid": int64(519), "parentdtalkid": int64(263), "postername": testUser, "body": "ответ",
+				}},
+			}}})
+			return
+		}
+		writeResult(w, map[string]interface{}{"pages": int64(2), "comments": []interface{}{map[string]interface{}{
+			"dtalkid": int64(775), "state": "D",
+		}}})
+	default:
+		writeFault(w, 300, "Unknown method")
+	}
+}
+
+func syncItem(item, time string) map[string]interface{} {
+	return map[string]interface{}{"item": item, "action": "create", "time": time}
+}
+
+func writeResult(w http.ResponseWriter, result map[string]interface{}) {
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0"?><methodResponse><params><param>`)
+	writeXMLRPCValue(&b, result)
+	b.WriteString(`</param></params></methodResponse>`)
+	w.Write(b.Bytes())
+}
+
+func writeFault(w http.ResponseWriter, code int64, text string) {
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0"?><methodResponse><fault>`)
+	writeXMLRPCValue(&b, map[string]interface{}{"faultCode": code, "faultString": text})
+	b.WriteString(`</fault></methodResponse>`)
+	w.Write(b.Bytes())
+}
+
+func runProtocolImport(t *testing.T, stub *protocolStub, password string) ([]*tiddlywiki.Tiddler, error) {
+	srv := httptest.NewServer(stub)
+	t.Cleanup(srv.Close)
+	opts := Options{Username: testUser, Password: password, Protocol: true, Host: srv.URL}
+	return convertViaProtocol("https://user.livejournal.com/", opts, srv.Client())
+}
+
+func byTitle(tiddlers []*tiddlywiki.Tiddler) map[string]*tiddlywiki.Tiddler {
+	m := make(map[string]*tiddlywiki.Tiddler, len(tiddlers))
+	for _, t := range tiddlers {
+		m[t.Title] = t
+	}
+	return m
+}
+
+func TestConvertViaProtocol(t *testing.T) {
+	stub := newProtocolStub(t, false)
+	tiddlers, err := runProtocolImport(t, stub, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(stub.lastSyncs, "|"); got != "|2004-01-02 10:00:00" {
+		t.Errorf("syncitems: lastsync = %q, ожидается продолжение с времени последнего элемента", got)
+	}
+	if stub.calls["getevents"] != 3 {
+		t.Errorf("getevents вызван %d раз, ожидается 3 (C-5 - комментарий, не запись)", stub.calls["getevents"])
+	}
+	// getcomments только для записи с комментариями, по разу на страницу.
+	if stub.calls["getcomments"] != 2 {
+		t.Errorf("getcomments вызван %d раз, ожидается 2", stub.calls["getcomments"])
+	}
+	if stub.calls["getchallenge"] != stub.calls["syncitems"]+stub.calls["getevents"]+stub.calls["getcomments"] {
+		t.Errorf("каждый вызов должен получать свой challenge: %v", stub.calls)
+	}
+
+	m := byTitle(tiddlers)
+	post := m["Запись 1"]
+	if post == nil {
+		t.Fatalf("запись 1 не импортирована, есть: %v", titles(tiddlers))
+	}
+	if m["Запись 1 (519)"] != nil {
+		t.Error("удаленная запись 2 не должна импортироваться")
+	}
+	// Запись 3 с той же темой получает свой заголовок, а не перезаписывает запись 1.
+	if dup := m["Запись 1 (775)"]; dup == nil || dup.Fields["url"] != "https://user.livejournal.com/775.html" {
+		t.Errorf("запись 3 со второй порции syncitems: %+v, есть: %v", dup, titles(tiddlers))
+	}
+	if !strings.Contains(post.Text, "строка 1<br") {
+		t.Errorf("переводы строк не превращены в <br>: %q", post.Text)
+	}
+	if post.Fields["url"] != "https://user.livejournal.com/263.html" || post.Fields["mood"] != "happy" {
+		t.Errorf("поля записи: %v", post.Fields)
+	}
+
+	reply := m["Запись 1-comment-519"]
+	if reply == nil {
+		t.Fatalf("вложенный комментарий не импортирован, есть: %v", titles(tiddlers))
+	}
+	if reply.Fields[tiddlywiki.FieldParent] != "Запись 1-comment-263" || reply.Fields[tiddlywiki.FieldThreadRoot] != "Запись 1" {
+		t.Errorf("ответ привязан неверно: %v", reply.Fields)
+	}
+	if top := m["Запись 1-comment-263"]; top == nil || top.Fields[tiddlywiki.FieldParent] != "Запись 1" || top.Fields[tiddlywiki.FieldCommentAuthor] != "friend" {
+		t.Errorf("комментарий верхнего уровня: %+v", top)
+	}
+	if deleted := m["Запись 1-comment-775"]; deleted == nil || !strings.Contains(deleted.Text, "удален") {
+		t.Errorf("удаленный комментарий со второй страницы: %+v", deleted)
+	}
+}
+
+func TestConvertViaProtocolWithoutGetComments(t *testing.T) {
+	stub := newProtocolStub(t, true)
+	tiddlers, err := runProtocolImport(t, stub, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stub.calls["getcomments"] != 1 {
+		t.Errorf("после ошибки unknown method getcomments больше не вызывается, вызовов: %d", stub.calls["getcomments"])
+	}
+	m := byTitle(tiddlers)
+	if m["Запись 1"] == nil || m["Запись 1 (775)"] == nil {
+		t.Errorf("записи должны импортироваться без комментариев, есть: %v", titles(tiddlers))
+	}
+	for _, tiddler := range tiddlers {
+		if tiddler.Fields[tiddlywiki.FieldImportType] == tiddlywiki.ImportTypeComment {
+			t.Errorf("неожиданный комментарий %q", tiddler.Title)
+		}
+	}
+}
+
+func TestConvertViaProtocolWrongPassword(t *testing.T) {
+	_, err := runProtocolImport(t, newProtocolStub(t, false), "wrong")
+	fault, ok := err.(*xmlrpcFault)
+	if !ok || fault.Code != 101 {
+		t.Fatalf("ожидается ошибка сервера 101, получено: %v", err)
+	}
+}
+
+func titles(tiddlers []*tiddlywiki.Tiddler) []string {
+	var result []string
+	for _, t := range tiddlers {
+		result = append(result, t.Title)
+	}
+	return result
+}
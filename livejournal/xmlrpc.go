@@ -0,0 +1,204 @@
+package livejournal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// =============================================================================
+// МИНИМАЛЬНЫЙ КЛИЕНТ XML-RPC
+// =============================================================================
+//
+// Протокол ЖЖ использует только строки, числа, логические значения,
+// массивы и структуры. Тексты с не-ASCII символами сервер отдает в base64,
+// они раскодируются в строки.
+
+// xmlrpcFault - ошибка, возвращенная сервером.
+type xmlrpcFault struct {
+	Code   int64
+	Method string
+	Text   string
+}
+
+func (f *xmlrpcFault) Error() string {
+	return fmt.Sprintf("%s: ошибка сервера %d: %s", f.Method, f.Code, f.Text)
+}
+
+// xmlrpcCall вызывает метод с одним параметром-структурой, как принято в протоколе ЖЖ.
+func xmlrpcCall(client *http.Client, endpoint, method string, params map[string]interface{}) (map[string]interface{}, error) {
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0" encoding="UTF-8"?><methodCall><methodName>`)
+	xml.EscapeText(&body, []byte(method))
+	body.WriteString(`</methodName><params><param>`)
+	writeXMLRPCValue(&body, params)
+	body.WriteString(`</param></params></methodCall>`)
+
+	req, err := http.NewRequest("POST", endpoint, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: статус %d", method, resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Params []xmlrpcValue `xml:"params>param>value"`
+		Fault  *xmlrpcValue  `xml:"fault>value"`
+	}
+	if err := xml.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("%s: ошибка разбора ответа: %w", method, err)
+	}
+	if response.Fault != nil {
+		fault, _ := response.Fault.decode().(map[string]interface{})
+		return nil, &xmlrpcFault{Code: jsonInt(fault["faultCode"]), Method: method, Text: rpcString(fault["faultString"])}
+	}
+	if len(response.Params) == 0 {
+		return nil, fmt.Errorf("%s: пустой ответ сервера", method)
+	}
+	result, ok := response.Params[0].decode().(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: ответ сервера не является структурой", method)
+	}
+	return result, nil
+}
+
+// writeXMLRPCValue кодирует значение. Ключи структур сортируются,
+// чтобы запросы были воспроизводимыми.
+func writeXMLRPCValue(b *bytes.Buffer, v interface{}) {
+	b.WriteString("<value>")
+	switch v := v.(type) {
+	case string:
+		b.WriteString("<string>")
+		xml.EscapeText(b, []byte(v))
+		b.WriteString("</string>")
+	case int:
+		fmt.Fprintf(b, "<int>%d</int>", v)
+	case int64:
+		fmt.Fprintf(b, "<int>%d</int>", v)
+	case bool:
+		if v {
+			b.WriteString("<boolean>1</boolean>")
+		} else {
+			b.WriteString("<boolean>0</boolean>")
+		}
+	case []interface{}:
+		b.WriteString("<array><data>")
+		for _, item := range v {
+			writeXMLRPCValue(b, item)
+		}
+		b.WriteString("</data></array>")
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		b.WriteString("<struct>")
+		for _, key := range keys {
+			b.WriteString("<member><name>")
+			xml.EscapeText(b, []byte(key))
+			b.WriteString("</name>")
+			writeXMLRPCValue(b, v[key])
+			b.WriteString("</member>")
+		}
+		b.WriteString("</struct>")
+	default:
+		panic(fmt.Sprintf("xmlrpc: неподдерживаемый тип %T", v))
+	}
+	b.WriteString("</value>")
+}
+
+// xmlrpcValue - значение XML-RPC в разобранном виде.
+type xmlrpcValue struct {
+	String   *string `xml:"string"`
+	Int      *string `xml:"int"`
+	I4       *string `xml:"i4"`
+	Boolean  *string `xml:"boolean"`
+	Double   *string `xml:"double"`
+	Base64   *string `xml:"base64"`
+	DateTime *string `xml:"dateTime.iso8601"`
+	Struct   *struct {
+		Members []struct {
+			Name  string      `xml:"name"`
+			Value xmlrpcValue `xml:"value"`
+		} `xml:"member"`
+	} `xml:"struct"`
+	Array *struct {
+		Values []xmlrpcValue `xml:"data>value"`
+	} `xml:"array"`
+	Text string `xml:",chardata"` // значение без типа - строка
+}
+
+// decode превращает значение в string, int64, float64, bool,
+// []interface{} или map[string]interface{}.
+func (v xmlrpcValue) decode() interface{} {
+	switch {
+	case v.String != nil:
+		return *v.String
+	case v.Int != nil:
+		n, _ := strconv.ParseInt(strings.TrimSpace(*v.Int), 10, 64)
+		return n
+	case v.I4 != nil:
+		n, _ := strconv.ParseInt(strings.TrimSpace(*v.I4), 10, 64)
+		return n
+	case v.Boolean != nil:
+		return strings.TrimSpace(*v.Boolean) == "1"
+	case v.Double != nil:
+		f, _ := strconv.ParseFloat(strings.TrimSpace(*v.Double), 64)
+		return f
+	case v.Base64 != nil:
+		data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(*v.Base64), ""))
+		if err != nil {
+			return *v.Base64
+		}
+		return string(data)
+	case v.DateTime != nil:
+		return strings.TrimSpace(*v.DateTime)
+	case v.Struct != nil:
+		m := make(map[string]interface{}, len(v.Struct.Members))
+		for _, member := range v.Struct.Members {
+			m[member.Name] = member.Value.decode()
+		}
+		return m
+	case v.Array != nil:
+		items := make([]interface{}, 0, len(v.Array.Values))
+		for _, item := range v.Array.Values {
+			items = append(items, item.decode())
+		}
+		return items
+	}
+	return v.Text
+}
+
+// rpcString приводит значение ответа к строке: числа ЖЖ иногда отдает строками и наоборот.
+func rpcString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
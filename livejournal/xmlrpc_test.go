@@ -0,0 +1,39 @@
+package livejournal
+
+import (
+	"encoding/xml"
+	"reflect"
+	"testing"
+)
+
+func TestXMLRPCValueDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		xml  string
+		want interface{}
+	}{
+		{"строка", `<value><string>abc</string></value>`, "abc"},
+		{"без типа", `<value>abc</value>`, "abc"},
+		{"int", `<value><int> 42 </int></value>`, int64(42)},
+		{"i4", `<value><i4>-1</i4></value>`, int64(-1)},
+		{"boolean", `<value><boolean>1</boolean></value>`, true},
+		// Тексты с не-ASCII символами сервер отдает в base64, с переносами строк.
+		{"base64", "<value><base64>0J/RgNC4\n0LLQtdGC</base64></value>", "Привет"},
+		{"некорректный base64", `<value><base64>не base64</base64></value>`, "не base64"},
+		{"массив", `<value><array><data><value><int>1</int></value><value><string>x</string></value></data></array></value>`,
+			[]interface{}{int64(1), "x"}},
+		{"структура", `<value><struct><member><name>subject</name><value><base64>0KLQtdC80LA=</base64></value></member></struct></value>`,
+			map[string]interface{}{"subject": "Тема"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v xmlrpcValue
+			if err := xml.Unmarshal([]byte(tt.xml), &v); err != nil {
+				t.Fatal(err)
+			}
+			if got := v.decode(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decode() = %#v, ожидается %#v", got, tt.want)
+			}
+		})
+	}
+}
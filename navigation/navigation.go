@@ -0,0 +1,231 @@
+// Package navigation строит навигацию поверх результата любого конвертера:
+// архив по годам и месяцам, облако тегов, страницы авторов, вкладку
+// в боковой панели и стартовую страницу.
+package navigation
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"tiddlywiki-converter/tiddlywiki"
+)
+
+// Заголовки создаваемых тиддлеров.
+const (
+	LandingTitle     = "Главная"
+	ArchiveTitle     = "Архив"
+	TagIndexTitle    = "Теги"
+	AuthorIndexTitle = "Авторы"
+	SidebarTitle     = "$:/converter/navigation/sidebar"
+)
+
+var monthNames = [...]string{
+	"Январь", "Февраль", "Март", "Апрель", "Май", "Июнь",
+	"Июль", "Август", "Сентябрь", "Октябрь", "Ноябрь", "Декабрь",
+}
+
+// post - минимальные сведения о посте, нужные для навигации.
+type post struct {
+	title   string
+	created time.Time
+	author  string
+	tags    []string
+}
+
+// Generate создает навигационные тиддлеры для постов из списка.
+// Посты определяются по полю import-type, даты - по полю created.
+// Если постов нет, возвращается nil.
+func Generate(tiddlers []*tiddlywiki.Tiddler) []*tiddlywiki.Tiddler {
+	var posts []post
+	comments := 0
+	for _, t := range tiddlers {
+		switch t.Fields[tiddlywiki.FieldImportType] {
+		case tiddlywiki.ImportTypePost:
+			created, _ := time.Parse(tiddlywiki.TiddlyTimeFormat, t.Created)
+			posts = append(posts, post{
+				title:   t.Title,
+				created: created,
+				author:  t.Fields[tiddlywiki.FieldAuthor],
+				tags:    tiddlywiki.ParseList(t.Tags),
+			})
+		case tiddlywiki.ImportTypeComment:
+			comments++
+		}
+	}
+	if len(posts) == 0 {
+		return nil
+	}
+	sort.SliceStable(posts, func(i, j int) bool {
+		if !posts[i].created.Equal(posts[j].created) {
+			return posts[i].created.Before(posts[j].created)
+		}
+		return posts[i].title < posts[j].title
+	})
+
+	var result []*tiddlywiki.Tiddler
+	result = append(result, archiveTiddlers(posts)...)
+	result = append(result, tagIndexTiddler(posts))
+	authors := authorTiddlers(posts)
+	result = append(result, authors...)
+	result = append(result, landingTiddler(len(posts), comments, len(authors) > 0), sidebarTiddler())
+	result = append(result, tiddlywiki.NewTiddler("$:/DefaultTiddlers", "[["+LandingTitle+"]]", ""))
+	// Пометка позволяет отличить навигацию от контента, например при разбиении
+	// вики на части, где навигация строится заново для каждой части.
+	for _, t := range result {
+		t.Fields[tiddlywiki.FieldImportType] = tiddlywiki.ImportTypeNavigation
+	}
+	return result
+}
+
+// archiveTiddlers строит дерево "Архив" -> "Архив/2020" -> "Архив/2020-05".
+// Годы и месяцы связаны тегами, поэтому архив работает и с макросом toc.
+func archiveTiddlers(posts []post) []*tiddlywiki.Tiddler {
+	type month struct {
+		key   string
+		date  time.Time
+		posts []string
+	}
+	var years []string
+	months := make(map[string][]*month)
+	for _, p := range posts {
+		if p.created.IsZero() {
+			continue
+		}
+		year := fmt.Sprintf("%s/%d", ArchiveTitle, p.created.Year())
+		key := fmt.Sprintf("%s/%d-%02d", ArchiveTitle, p.created.Year(), int(p.created.Month()))
+		list := months[year]
+		if list == nil {
+			years = append(years, year)
+		}
+		if len(list) == 0 || list[len(list)-1].key != key {
+			list = append(list, &month{key: key, date: p.created})
+			months[year] = list
+		}
+		list[len(list)-1].posts = append(list[len(list)-1].posts, p.title)
+	}
+
+	var result []*tiddlywiki.Tiddler
+	archive := tiddlywiki.NewTiddler(ArchiveTitle, "<<toc-expandable \""+ArchiveTitle+"\">>", "")
+	archive.Fields["list"] = tiddlywiki.StringifyList(years)
+	result = append(result, archive)
+
+	for _, year := range years {
+		var monthTitles []string
+		count := 0
+		for _, m := range months[year] {
+			monthTitles = append(monthTitles, m.key)
+			count += len(m.posts)
+		}
+		yearTiddler := tiddlywiki.NewTiddler(year,
+			fmt.Sprintf("Постов за год: %d\n\n<<list-links filter:\"[tag<currentTiddler>]\">>", count),
+			tiddlywiki.StringifyList([]string{ArchiveTitle}))
+		yearTiddler.Fields["caption"] = strings.TrimPrefix(year, ArchiveTitle+"/")
+		yearTiddler.Fields["list"] = tiddlywiki.StringifyList(monthTitles)
+		result = append(result, yearTiddler)
+
+		for _, m := range months[year] {
+			monthTiddler := tiddlywiki.NewTiddler(m.key,
+				"<<list-links filter:\"[list<currentTiddler>]\">>",
+				tiddlywiki.StringifyList([]string{year}))
+			monthTiddler.Fields["caption"] = fmt.Sprintf("%s %d (%d)", monthNames[m.date.Month()-1], m.date.Year(), len(m.posts))
+			monthTiddler.Fields["list"] = tiddlywiki.StringifyList(m.posts)
+			result = append(result, monthTiddler)
+		}
+	}
+	return result
+}
+
+// tagIndexTiddler строит облако тегов: размер шрифта зависит от числа постов с тегом.
+func tagIndexTiddler(posts []post) *tiddlywiki.Tiddler {
+	counts := make(map[string]int)
+	for _, p := range posts {
+		for _, tag := range p.tags {
+			counts[tag]++
+		}
+	}
+	tags := make([]string, 0, len(counts))
+	maxCount := 1
+	for tag, n := range counts {
+		tags = append(tags, tag)
+		if n > maxCount {
+			maxCount = n
+		}
+	}
+	sort.Strings(tags)
+
+	var b strings.Builder
+	if len(tags) == 0 {
+		b.WriteString("Теги не найдены.")
+	}
+	for _, tag := range tags {
+		// Логарифмическая шкала от 0.8em до 2em, чтобы частые теги не вытесняли остальные.
+		size := 0.8 + 1.2*math.Log(float64(counts[tag]))/math.Log(float64(maxCount)+1)
+		b.WriteString(fmt.Sprintf("<span style=\"font-size:%.2fem\"><<tag \"\"\"%s\"\"\">></span> <sup>%d</sup>\n", size, tag, counts[tag]))
+	}
+	return tiddlywiki.NewTiddler(TagIndexTitle, b.String(), "")
+}
+
+// authorTiddlers создает индекс авторов и страницу со списком постов каждого автора.
+func authorTiddlers(posts []post) []*tiddlywiki.Tiddler {
+	byAuthor := make(map[string][]string)
+	var authors []string
+	for _, p := range posts {
+		if p.author == "" {
+			continue
+		}
+		if _, ok := byAuthor[p.author]; !ok {
+			authors = append(authors, p.author)
+		}
+		byAuthor[p.author] = append(byAuthor[p.author], p.title)
+	}
+	if len(authors) == 0 {
+		return nil
+	}
+	sort.Strings(authors)
+
+	var pages []string
+	var result []*tiddlywiki.Tiddler
+	for _, author := range authors {
+		title := "Автор: " + author
+		pages = append(pages, title)
+		page := tiddlywiki.NewTiddler(title,
+			fmt.Sprintf("Постов: %d\n\n<<list-links filter:\"[list<currentTiddler>]\">>", len(byAuthor[author])),
+			tiddlywiki.StringifyList([]string{AuthorIndexTitle}))
+		page.Fields["caption"] = author
+		page.Fields["list"] = tiddlywiki.StringifyList(byAuthor[author])
+		result = append(result, page)
+	}
+	index := tiddlywiki.NewTiddler(AuthorIndexTitle, "<<list-links filter:\"[tag<currentTiddler>]\">>", "")
+	index.Fields["list"] = tiddlywiki.StringifyList(pages)
+	return append([]*tiddlywiki.Tiddler{index}, result...)
+}
+
+func landingTiddler(posts, comments int, hasAuthors bool) *tiddlywiki.Tiddler {
+	var b strings.Builder
+	b.WriteString("!! {{$:/SiteTitle}}\n\n{{$:/SiteSubtitle}}\n\n")
+	b.WriteString(fmt.Sprintf("Постов: %d, комментариев: %d.\n\n", posts, comments))
+	b.WriteString(fmt.Sprintf("* [[%s]]\n* [[%s]]\n", ArchiveTitle, TagIndexTitle))
+	if hasAuthors {
+		b.WriteString(fmt.Sprintf("* [[%s]]\n", AuthorIndexTitle))
+	}
+	b.WriteString("\n!! Последние посты\n\n")
+	b.WriteString(fmt.Sprintf("<<list-links filter:\"[field:%s[%s]!sort[created]limit[10]]\">>\n",
+		tiddlywiki.FieldImportType, tiddlywiki.ImportTypePost))
+	return tiddlywiki.NewTiddler(LandingTitle, b.String(), "")
+}
+
+// sidebarTiddler - вкладка боковой панели со всеми постами в хронологическом порядке.
+func sidebarTiddler() *tiddlywiki.Tiddler {
+	text := fmt.Sprintf(`<div class="tc-sidebar-lists">
+<$list filter="[field:%s[%s]sort[created]]">
+<div><$view field="created" format="date" template="YYYY-0MM-0DD"/> <$link/></div>
+</$list>
+</div>
+`, tiddlywiki.FieldImportType, tiddlywiki.ImportTypePost)
+	sidebar := tiddlywiki.NewTiddler(SidebarTitle, text, "$:/tags/SideBar")
+	sidebar.Fields["caption"] = "Посты"
+	return sidebar
+}
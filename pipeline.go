@@ -0,0 +1,123 @@
+package tiddlywiki_converter
+
+import (
+	"fmt"
+	"log"
+
+	"tiddlywiki-converter/navigation"
+	"tiddlywiki-converter/sanitize"
+	"tiddlywiki-converter/tiddlywiki"
+)
+
+// postProcess применяет к результату любого конвертера общие шаги обработки.
+// Порядок шагов важен: очистка HTML идет первой, чтобы последующие шаги
+// работали уже с безопасным содержимым.
+func postProcess(config map[string]string, tiddlers []*tiddlywiki.Tiddler) ([]*tiddlywiki.Tiddler, error) {
+	platform := config["platform"]
+
+	sanitizeConfig, err := sanitize.ConfigFromMap(config)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка настройки очистки HTML: %w", err)
+	}
+	report := sanitizeConfig.PolicyFor(platform).Apply(tiddlers)
+	report.LogSummary(platform)
+	if report.Total() > 0 {
+		tiddlers = append(tiddlers, tiddlywiki.NewTiddler(sanitize.ReportTitle, report.Text(), ""))
+	}
+
+	if hasComments(tiddlers) {
+		tiddlers = tiddlywiki.Merge(tiddlers, tiddlywiki.CommentThreadTiddlers())
+	}
+
+	if config["navigation"] == "true" {
+		navTiddlers := navigation.Generate(tiddlers)
+		log.Printf("Навигация: создано %d тиддлеров.", len(navTiddlers))
+		tiddlers = tiddlywiki.Merge(tiddlers, navTiddlers)
+	}
+
+	if config["deterministic"] == "true" {
+		tiddlywiki.StabilizeTimestamps(tiddlers)
+		tiddlywiki.SortByTitle(tiddlers)
+	}
+
+	return tiddlers, nil
+}
+
+// hasComments проверяет, есть ли среди тиддлеров комментарии, которым нужен шаблон обсуждения.
+func hasComments(tiddlers []*tiddlywiki.Tiddler) bool {
+	for _, t := range tiddlers {
+		if t.Fields[tiddlywiki.FieldParent] != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// streamPipeline - те же шаги постобработки для потокового импорта: каждый
+// тиддлер очищается и сразу записывается. Для навигации в памяти остаются
+// только заголовки, даты, теги и авторы постов, без текста.
+type streamPipeline struct {
+	config   map[string]string
+	policy   *sanitize.Policy
+	report   *sanitize.Report
+	out      *tiddlywiki.HTMLWriter
+	comments bool
+	outline  []*tiddlywiki.Tiddler
+}
+
+func newStreamPipeline(config map[string]string, out *tiddlywiki.HTMLWriter) (*streamPipeline, error) {
+	sanitizeConfig, err := sanitize.ConfigFromMap(config)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка настройки очистки HTML: %w", err)
+	}
+	return &streamPipeline{
+		config: config,
+		policy: sanitizeConfig.PolicyFor(config["platform"]),
+		report: sanitize.NewReport(),
+		out:    out,
+	}, nil
+}
+
+func (p *streamPipeline) add(t *tiddlywiki.Tiddler) error {
+	p.policy.ApplyTiddler(t, p.report)
+	if t.Fields[tiddlywiki.FieldParent] != "" {
+		p.comments = true
+	}
+	if p.config["navigation"] == "true" {
+		switch importType := t.Fields[tiddlywiki.FieldImportType]; importType {
+		case tiddlywiki.ImportTypePost, tiddlywiki.ImportTypeComment:
+			stub := tiddlywiki.NewTiddler(t.Title, "", t.Tags)
+			stub.Created = t.Created
+			stub.Fields[tiddlywiki.FieldImportType] = importType
+			stub.Fields[tiddlywiki.FieldAuthor] = t.Fields[tiddlywiki.FieldAuthor]
+			p.outline = append(p.outline, stub)
+		}
+	}
+	return p.out.Write(t)
+}
+
+// finish дописывает отчет об очистке, шаблоны обсуждений и навигацию,
+// которым нужен весь импорт, и закрывает файл.
+func (p *streamPipeline) finish() error {
+	platform := p.config["platform"]
+	p.report.LogSummary(platform)
+	var extra []*tiddlywiki.Tiddler
+	if p.report.Total() > 0 {
+		extra = append(extra, tiddlywiki.NewTiddler(sanitize.ReportTitle, p.report.Text(), ""))
+	}
+	if p.comments {
+		extra = append(extra, tiddlywiki.CommentThreadTiddlers()...)
+	}
+	if p.config["navigation"] == "true" {
+		navTiddlers := navigation.Generate(p.outline)
+		log.Printf("Навигация: создано %d тиддлеров.", len(navTiddlers))
+		extra = append(extra, navTiddlers...)
+	}
+	for _, t := range extra {
+		if err := p.out.Write(t); err != nil {
+			p.out.Close()
+			return err
+		}
+	}
+	return p.out.Close()
+}
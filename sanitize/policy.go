@@ -0,0 +1,230 @@
+package sanitize
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Mode задает уровень строгости очистки HTML.
+type Mode string
+
+const (
+	// ModeOff отключает очистку: контент попадает в тиддлеры как есть.
+	ModeOff Mode = "off"
+	// ModeStrict оставляет только базовое форматирование: никаких встраиваний и inline-стилей.
+	ModeStrict Mode = "strict"
+	// ModeEmbeds работает как strict, но сохраняет iframe и медиа известных провайдеров
+	// (YouTube, Vimeo и т.д.) и атрибут style.
+	ModeEmbeds Mode = "embeds"
+)
+
+// DefaultMode - режим, который используется, если в конфигурации ничего не указано.
+const DefaultMode = ModeEmbeds
+
+// knownEmbedHosts - провайдеры, чьи iframe сохраняются в режиме embeds.
+// Поддомены разрешены автоматически (www.youtube.com подходит под youtube.com).
+var knownEmbedHosts = []string{
+	"youtube.com",
+	"youtube-nocookie.com",
+	"player.vimeo.com",
+	"vk.com",
+	"vkvideo.ru",
+	"rutube.ru",
+	"coub.com",
+	"w.soundcloud.com",
+	"open.spotify.com",
+	"bandcamp.com",
+	"dailymotion.com",
+	"music.yandex.ru",
+}
+
+// Policy описывает, что именно разрешено в одном источнике.
+type Policy struct {
+	Mode       Mode
+	EmbedHosts []string
+}
+
+// Config - настройки очистки для всего импорта: режим по умолчанию,
+// переопределения для отдельных источников (платформ) и дополнительные провайдеры.
+type Config struct {
+	Default         Mode
+	Overrides       map[string]Mode
+	ExtraEmbedHosts []string
+}
+
+// ParseMode разбирает строковое значение режима. Пустая строка означает режим по умолчанию.
+func ParseMode(s string) (Mode, error) {
+	switch Mode(strings.ToLower(strings.TrimSpace(s))) {
+	case "":
+		return DefaultMode, nil
+	case ModeOff:
+		return ModeOff, nil
+	case ModeStrict:
+		return ModeStrict, nil
+	case ModeEmbeds:
+		return ModeEmbeds, nil
+	}
+	return "", fmt.Errorf("неизвестный режим очистки HTML: %q (допустимо: off, strict, embeds)", s)
+}
+
+// ParseOverrides разбирает строку вида "wikipedia:off,livejournal:strict".
+func ParseOverrides(s string) (map[string]Mode, error) {
+	overrides := make(map[string]Mode)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		source, modeStr, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("некорректное переопределение очистки %q, ожидается 'источник:режим'", part)
+		}
+		mode, err := ParseMode(modeStr)
+		if err != nil {
+			return nil, err
+		}
+		overrides[strings.ToLower(strings.TrimSpace(source))] = mode
+	}
+	return overrides, nil
+}
+
+// ConfigFromMap собирает Config из общей карты конфигурации конвертера
+// (ключи sanitize, sanitize_overrides, sanitize_embed_hosts).
+func ConfigFromMap(config map[string]string) (Config, error) {
+	mode, err := ParseMode(config["sanitize"])
+	if err != nil {
+		return Config{}, err
+	}
+	overrides, err := ParseOverrides(config["sanitize_overrides"])
+	if err != nil {
+		return Config{}, err
+	}
+	var hosts []string
+	for _, h := range strings.Split(config["sanitize_embed_hosts"], ",") {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	return Config{Default: mode, Overrides: overrides, ExtraEmbedHosts: hosts}, nil
+}
+
+// PolicyFor возвращает политику для конкретного источника с учетом переопределений.
+func (c Config) PolicyFor(source string) *Policy {
+	mode := c.Default
+	if mode == "" {
+		mode = DefaultMode
+	}
+	if m, ok := c.Overrides[strings.ToLower(source)]; ok {
+		mode = m
+	}
+	hosts := append(append([]string{}, knownEmbedHosts...), c.ExtraEmbedHosts...)
+	return &Policy{Mode: mode, EmbedHosts: hosts}
+}
+
+// allowedTags - элементы, которые сохраняются во всех режимах, кроме off.
+var allowedTags = map[string]bool{
+	"a": true, "abbr": true, "b": true, "big": true, "blockquote": true, "br": true,
+	"caption": true, "center": true, "cite": true, "code": true, "col": true, "colgroup": true,
+	"dd": true, "del": true, "details": true, "dfn": true, "div": true, "dl": true, "dt": true,
+	"em": true, "figcaption": true, "figure": true, "font": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "hr": true,
+	"i": true, "img": true, "ins": true, "kbd": true, "li": true, "mark": true,
+	"ol": true, "p": true, "pre": true, "q": true, "s": true, "samp": true, "small": true,
+	"span": true, "strike": true, "strong": true, "sub": true, "summary": true, "sup": true,
+	"table": true, "tbody": true, "td": true, "tfoot": true, "th": true, "thead": true,
+	"time": true, "tr": true, "tt": true, "u": true, "ul": true, "var": true, "wbr": true,
+}
+
+// embedTags разрешены только в режиме embeds.
+var embedTags = map[string]bool{
+	"iframe": true, "video": true, "audio": true, "source": true, "track": true,
+}
+
+// droppedWithContent - элементы, которые удаляются вместе со всем содержимым.
+// Остальные неизвестные элементы "разворачиваются": тег удаляется, текст остается.
+var droppedWithContent = map[string]bool{
+	"script": true, "style": true, "iframe": true, "frame": true, "frameset": true,
+	"object": true, "applet": true, "embed": true, "noscript": true, "noembed": true,
+	"template": true, "svg": true, "math": true, "textarea": true, "select": true,
+	"button": true, "link": true, "meta": true, "base": true, "title": true, "head": true,
+	"video": true, "audio": true, "xmp": true, "plaintext": true, "input": true,
+}
+
+// allowedAttrs - атрибуты, допустимые на любом разрешенном элементе.
+var allowedAttrs = map[string]bool{
+	"title": true, "class": true, "id": true, "dir": true, "lang": true, "align": true,
+	"width": true, "height": true, "colspan": true, "rowspan": true, "alt": true,
+	"target": true, "rel": true, "datetime": true, "start": true, "type": true,
+	"border": true, "cellpadding": true, "cellspacing": true, "valign": true,
+	"color": true, "face": true, "size": true, "name": true, "open": true, "reversed": true,
+}
+
+// allowedWidgets - виджеты TiddlyWiki, которые выводят сами конвертеры
+// (раскрывающиеся блоки ЖЖ, галереи WordPress), и их допустимые атрибуты.
+// Остальные виджеты разворачиваются: тег удаляется, содержимое остается.
+var allowedWidgets = map[string]map[string]bool{
+	"reveal": {"type": true, "state": true, "text": true, "default": true, "class": true, "tag": true, "retain": true, "animate": true},
+	"button": {"class": true, "set": true, "setTo": true, "tooltip": true, "aria-label": true, "tag": true},
+	"list":   {"filter": true, "variable": true, "template": true, "counter": true},
+	"image":  {"source": true, "width": true, "height": true, "alt": true, "tooltip": true, "class": true, "loading": true},
+	"view":   {"tiddler": true, "field": true, "format": true, "template": true},
+}
+
+// urlAttrs - атрибуты, содержащие ссылки, которые проверяются на схему.
+var urlAttrs = map[string]bool{
+	"href": true, "src": true, "cite": true, "poster": true,
+}
+
+// embedAttrs - дополнительные атрибуты встраиваемых элементов в режиме embeds.
+var embedAttrs = map[string]bool{
+	"allowfullscreen": true, "frameborder": true, "allow": true, "loading": true,
+	"controls": true, "preload": true, "loop": true, "muted": true, "kind": true,
+	"srclang": true, "label": true, "scrolling": true,
+}
+
+// safeURL проверяет, что ссылка не содержит исполняемой схемы (javascript:, vbscript: ...).
+// data: допускается только для изображений в img src.
+func safeURL(tag, attr, raw string) bool {
+	v := strings.ToLower(strings.TrimSpace(raw))
+	// Браузеры игнорируют управляющие символы и пробелы внутри схемы.
+	v = strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, v)
+	if strings.HasPrefix(v, "data:image/") && tag == "img" && attr == "src" {
+		return true
+	}
+	u, err := url.Parse(v)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "", "http", "https", "mailto", "ftp":
+		return true
+	}
+	return false
+}
+
+// embedAllowed проверяет, что источник встраивания принадлежит известному провайдеру.
+func (p *Policy) embedAllowed(src string) bool {
+	u, err := url.Parse(strings.TrimSpace(src))
+	if err != nil {
+		return false
+	}
+	if u.Scheme == "" && strings.HasPrefix(src, "//") {
+		u.Scheme = "https"
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range p.EmbedHosts {
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
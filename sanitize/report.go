@@ -0,0 +1,74 @@
+package sanitize
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// ReportTitle - заголовок системного тиддлера с отчетом об очистке.
+const ReportTitle = "$:/converter/sanitize-report"
+
+// Report накапливает статистику того, что было удалено при очистке.
+type Report struct {
+	Tiddlers int            // сколько тиддлеров было изменено
+	Removed  map[string]int // что удалено -> сколько раз
+	Sources  map[string]int // заголовок тиддлера -> число удалений
+}
+
+// NewReport создает пустой отчет.
+func NewReport() *Report {
+	return &Report{Removed: make(map[string]int), Sources: make(map[string]int)}
+}
+
+// Total возвращает общее число удаленных элементов и атрибутов.
+func (r *Report) Total() int {
+	total := 0
+	for _, n := range r.Removed {
+		total += n
+	}
+	return total
+}
+
+func (r *Report) add(what string) {
+	if r != nil {
+		r.Removed[what]++
+	}
+}
+
+// Text формирует отчет в виде вики-текста для системного тиддлера.
+func (r *Report) Text() string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("Очищено тиддлеров: %d, удалено элементов и атрибутов: %d.\n\n", r.Tiddlers, r.Total()))
+	b.WriteString("|!Удалено |!Количество |\n")
+	for _, key := range sortedKeys(r.Removed) {
+		b.WriteString(fmt.Sprintf("|`%s` |%d |\n", key, r.Removed[key]))
+	}
+	b.WriteString("\n!! Тиддлеры\n\n")
+	for _, title := range sortedKeys(r.Sources) {
+		b.WriteString(fmt.Sprintf("* [[%s]] — %d\n", title, r.Sources[title]))
+	}
+	return b.String()
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// LogSummary выводит краткую сводку отчета в лог.
+func (r *Report) LogSummary(source string) {
+	if r.Total() == 0 {
+		log.Printf("Очистка HTML (%s): опасного содержимого не найдено.", source)
+		return
+	}
+	log.Printf("Очистка HTML (%s): изменено тиддлеров: %d, удалено: %d.", source, r.Tiddlers, r.Total())
+	for _, key := range sortedKeys(r.Removed) {
+		log.Printf("   - %s: %d", key, r.Removed[key])
+	}
+}
@@ -0,0 +1,408 @@
+// Package sanitize очищает сторонний HTML перед тем, как он попадет в тиддлеры:
+// удаляет скрипты, обработчики событий, опасные ссылки и встраивания
+// по настраиваемому белому списку.
+package sanitize
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+	"tiddlywiki-converter/tiddlywiki"
+)
+
+// Apply очищает текст всех контентных тиддлеров по политике и возвращает отчет.
+// Системные тиддлеры ($:/...) и тиддлеры с нетекстовым типом не затрагиваются.
+func (p *Policy) Apply(tiddlers []*tiddlywiki.Tiddler) *Report {
+	report := NewReport()
+	for _, t := range tiddlers {
+		p.ApplyTiddler(t, report)
+	}
+	return report
+}
+
+// ApplyTiddler очищает один тиддлер и добавляет результат в report.
+// Нужен потоковому импорту, где тиддлеры не собираются в список.
+func (p *Policy) ApplyTiddler(t *tiddlywiki.Tiddler, report *Report) {
+	if p.Mode == ModeOff || strings.HasPrefix(t.Title, "$:/") || !isTextType(t.Fields["type"]) {
+		return
+	}
+	before := report.Total()
+	t.Text = p.Sanitize(t.Text, report)
+	if removed := report.Total() - before; removed > 0 {
+		report.Tiddlers++
+		report.Sources[t.Title] = removed
+	}
+}
+
+func isTextType(contentType string) bool {
+	switch contentType {
+	case "", "text/html", "text/vnd.tiddlywiki":
+		return true
+	}
+	return false
+}
+
+// Sanitize очищает один фрагмент HTML/вики-текста. Вызовы макросов (<<...>>)
+// передаются без изменений, так как токенизатор HTML принял бы их за теги;
+// виджеты (<$...>) проверяются по отдельному белому списку.
+// Блоки кода ``` тоже не затрагиваются: их содержимое выводится как текст.
+func (p *Policy) Sanitize(input string, report *Report) string {
+	if p.Mode == ModeOff || !strings.Contains(input, "<") {
+		return input
+	}
+	s := &sanitizer{policy: p, report: report}
+	for len(input) > 0 {
+		start, end := fencedBlock(input)
+		if start == -1 {
+			s.feedMarkup(input)
+			break
+		}
+		s.feedMarkup(input[:start])
+		s.write(input[start:end])
+		input = input[end:]
+	}
+	return s.out.String()
+}
+
+// fencedBlock ищет первый блок кода ```...```: открывающая и закрывающая
+// строки начинаются с трех обратных кавычек. Незакрытый блок не считается кодом.
+func fencedBlock(input string) (int, int) {
+	offset := 0
+	for {
+		start := strings.Index(input[offset:], "```")
+		if start == -1 {
+			return -1, -1
+		}
+		start += offset
+		if start > 0 && input[start-1] != '\n' {
+			offset = start + 3
+			continue
+		}
+		bodyStart := strings.IndexByte(input[start:], '\n')
+		if bodyStart == -1 {
+			return -1, -1
+		}
+		closing := strings.Index(input[start+bodyStart:], "\n```")
+		if closing == -1 {
+			return -1, -1
+		}
+		end := start + bodyStart + closing + len("\n```")
+		if nl := strings.IndexByte(input[end:], '\n'); nl != -1 {
+			end += nl
+		} else {
+			end = len(input)
+		}
+		return start, end
+	}
+}
+
+var (
+	// macroCallPattern - вызов макроса: имя и параметры без разметки. Внутри
+	// параметров допускаются только ссылки на переменные фильтров (<currentTiddler>).
+	macroCallPattern = regexp.MustCompile(`^<<[^\s<>"']+(?:\s(?:[^<>]|<[A-Za-z][\w-]*>)*)?>>`)
+	macroVarPattern  = regexp.MustCompile(`<([A-Za-z][\w-]*)>`)
+
+	widgetAttrValue    = `"[^"]*"|'[^']*'|<<[^<>]*>>|\{\{\{[^}]*\}\}\}|\{\{[^}]*\}\}|[^\s"'<>/=]+`
+	widgetOpenPattern  = regexp.MustCompile(`^<\$([\w.-]+)((?:\s+[\w.$:-]+(?:\s*=\s*(?:` + widgetAttrValue + `))?)*)\s*(/?)>`)
+	widgetClosePattern = regexp.MustCompile(`^</\$([\w.-]+)\s*>`)
+	widgetAttrPattern  = regexp.MustCompile(`([\w.$:-]+)(?:\s*=\s*(` + widgetAttrValue + `))?`)
+)
+
+// feedMarkup разбирает текст вне блоков кода: вызовы макросов и виджеты
+// обрабатываются отдельно, все остальное проходит через токенизатор HTML.
+func (s *sanitizer) feedMarkup(input string) {
+	for len(input) > 0 {
+		start := nextWikiMarkup(input)
+		if start == -1 {
+			s.feedHTML(input)
+			break
+		}
+		s.feedHTML(input[:start])
+		input = input[start+s.wikiMarkup(input[start:]):]
+	}
+}
+
+// nextWikiMarkup возвращает позицию первого вызова макроса или тега виджета.
+func nextWikiMarkup(input string) int {
+	for offset := 0; ; {
+		i := strings.IndexByte(input[offset:], '<')
+		if i == -1 {
+			return -1
+		}
+		i += offset
+		rest := input[i:]
+		if strings.HasPrefix(rest, "<$") || strings.HasPrefix(rest, "</$") {
+			return i
+		}
+		if m := macroCallPattern.FindString(rest); m != "" && macroSafe(m) {
+			return i
+		}
+		offset = i + 1
+	}
+}
+
+// macroSafe отбрасывает вызовы, в параметрах которых спрятан опасный элемент (<script>).
+func macroSafe(call string) bool {
+	for _, m := range macroVarPattern.FindAllStringSubmatch(call[2:], -1) {
+		if droppedWithContent[strings.ToLower(m[1])] {
+			return false
+		}
+	}
+	return true
+}
+
+// wikiMarkup обрабатывает макрос или тег виджета в начале input и возвращает
+// длину обработанного фрагмента.
+func (s *sanitizer) wikiMarkup(input string) int {
+	if m := macroCallPattern.FindString(input); m != "" && macroSafe(m) {
+		s.write(m)
+		return len(m)
+	}
+	if m := widgetClosePattern.FindStringSubmatch(input); m != nil {
+		if allowedWidgets[m[1]] != nil {
+			s.write(m[0])
+		}
+		return len(m[0])
+	}
+	m := widgetOpenPattern.FindStringSubmatch(input)
+	if m == nil {
+		// Не разобранный тег виджета выводится как текст.
+		s.report.add("<$ (некорректный виджет)")
+		s.write("&lt;")
+		return 1
+	}
+	allowed := allowedWidgets[m[1]]
+	if allowed == nil {
+		s.report.add("<$" + m[1] + "> (развернут)")
+		return len(m[0])
+	}
+	var b strings.Builder
+	b.WriteString("<$" + m[1])
+	for _, attr := range widgetAttrPattern.FindAllStringSubmatch(m[2], -1) {
+		if s.widgetAttrAllowed(m[1], allowed, attr[1], attr[2]) {
+			b.WriteString(" " + attr[0])
+		}
+	}
+	if m[3] != "" {
+		b.WriteString("/")
+	}
+	b.WriteString(">")
+	s.write(b.String())
+	return len(m[0])
+}
+
+// widgetAttrAllowed проверяет атрибут виджета. Кнопкам разрешено менять
+// только тиддлеры состояния, ссылки в изображениях проверяются как в img.
+func (s *sanitizer) widgetAttrAllowed(widget string, allowed map[string]bool, key, value string) bool {
+	literal := strings.Trim(value, `"'`)
+	switch {
+	case !allowed[key]:
+	case widget == "button" && key == "set" && !strings.HasPrefix(literal, "$:/state/"):
+	case widget == "image" && key == "source" && !strings.HasPrefix(value, "<<") && !safeURL("img", "src", literal):
+	default:
+		return true
+	}
+	s.report.add("атрибут " + key + " виджета $" + widget)
+	return false
+}
+
+// sanitizer хранит состояние между фрагментами одного текста.
+type sanitizer struct {
+	policy *Policy
+	report *Report
+	out    strings.Builder
+
+	// skipTag и skipDepth описывают элемент, который удаляется вместе с содержимым.
+	skipTag   string
+	skipDepth int
+}
+
+func (s *sanitizer) write(raw string) {
+	if s.skipDepth == 0 {
+		s.out.WriteString(raw)
+	}
+}
+
+func (s *sanitizer) feedHTML(fragment string) {
+	z := xhtml.NewTokenizer(strings.NewReader(fragment))
+	for {
+		tt := z.Next()
+		if tt == xhtml.ErrorToken {
+			// Незакрытый тег в конце фрагмента (например, атрибут, разрезанный
+			// макросом) выводится как текст, чтобы вики не собрала его обратно.
+			s.write(strings.ReplaceAll(string(z.Raw()), "<", "&lt;"))
+			return
+		}
+		raw := string(z.Raw())
+		if s.skipDepth > 0 {
+			s.trackSkipped(tt, z.Token())
+			continue
+		}
+		switch tt {
+		case xhtml.TextToken, xhtml.CommentToken:
+			s.out.WriteString(raw)
+		case xhtml.DoctypeToken:
+			// Объявления DOCTYPE внутри тиддлера бессмысленны.
+		case xhtml.StartTagToken, xhtml.SelfClosingTagToken:
+			s.startTag(tt, z.Token(), raw)
+		case xhtml.EndTagToken:
+			tok := z.Token()
+			if s.tagAllowed(tok.Data) {
+				s.out.WriteString(raw)
+			}
+		}
+	}
+}
+
+// trackSkipped следит за вложенностью удаляемого элемента.
+func (s *sanitizer) trackSkipped(tt xhtml.TokenType, tok xhtml.Token) {
+	if tok.Data != s.skipTag {
+		return
+	}
+	switch tt {
+	case xhtml.StartTagToken:
+		s.skipDepth++
+	case xhtml.EndTagToken:
+		s.skipDepth--
+	}
+}
+
+func (s *sanitizer) tagAllowed(name string) bool {
+	if allowedTags[name] {
+		return true
+	}
+	return s.policy.Mode == ModeEmbeds && embedTags[name]
+}
+
+func (s *sanitizer) startTag(tt xhtml.TokenType, tok xhtml.Token, raw string) {
+	name := tok.Data
+	if name == "iframe" && s.policy.Mode == ModeEmbeds {
+		src := attrValue(tok, "src")
+		if !s.policy.embedAllowed(src) {
+			s.report.add(fmt.Sprintf("<iframe> %s", hostOf(src)))
+			s.skip(tt, name)
+			return
+		}
+	} else if !s.tagAllowed(name) {
+		if droppedWithContent[name] {
+			s.report.add("<" + name + ">")
+			s.skip(tt, name)
+		} else {
+			// Неизвестный, но безобидный элемент: разворачиваем, сохраняя содержимое.
+			s.report.add("<" + name + "> (развернут)")
+		}
+		return
+	}
+
+	kept := tok.Attr[:0:0]
+	for _, attr := range tok.Attr {
+		if s.attrAllowed(name, attr) {
+			kept = append(kept, attr)
+		}
+	}
+	if len(kept) == len(tok.Attr) {
+		s.out.WriteString(raw)
+		return
+	}
+	s.out.WriteString(renderTag(name, kept, tt == xhtml.SelfClosingTagToken))
+}
+
+func (s *sanitizer) skip(tt xhtml.TokenType, name string) {
+	if tt == xhtml.StartTagToken && !voidElements[name] {
+		s.skipTag = name
+		s.skipDepth = 1
+	}
+}
+
+func (s *sanitizer) attrAllowed(tag string, attr xhtml.Attribute) bool {
+	key := strings.ToLower(attr.Key)
+	switch {
+	case allowedAttrs[key]:
+		// Список проверяется первым: open у <details> тоже начинается с "on".
+		return true
+	case strings.HasPrefix(key, "on"):
+		s.report.add("атрибут " + key)
+		return false
+	case urlAttrs[key]:
+		if !safeURL(tag, key, attr.Val) {
+			s.report.add(fmt.Sprintf("ссылка %s:", schemeOf(attr.Val)))
+			return false
+		}
+		return true
+	case key == "srcset":
+		for _, candidate := range strings.Split(attr.Val, ",") {
+			fields := strings.Fields(candidate)
+			if len(fields) > 0 && !safeURL(tag, "src", fields[0]) {
+				s.report.add("атрибут srcset")
+				return false
+			}
+		}
+		return true
+	case key == "style":
+		if s.policy.Mode == ModeEmbeds {
+			return true
+		}
+		s.report.add("атрибут style")
+		return false
+	case strings.HasPrefix(key, "data-"), strings.HasPrefix(key, "aria-"):
+		return true
+	case s.policy.Mode == ModeEmbeds && embedAttrs[key]:
+		return true
+	}
+	s.report.add("атрибут " + key)
+	return false
+}
+
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true,
+	"img": true, "input": true, "link": true, "meta": true, "source": true,
+	"track": true, "wbr": true,
+}
+
+func renderTag(name string, attrs []xhtml.Attribute, selfClosing bool) string {
+	var b strings.Builder
+	b.WriteString("<" + name)
+	for _, attr := range attrs {
+		b.WriteString(" " + attr.Key)
+		if attr.Val != "" {
+			b.WriteString(`="` + html.EscapeString(attr.Val) + `"`)
+		}
+	}
+	if selfClosing {
+		b.WriteString("/")
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+func attrValue(tok xhtml.Token, key string) string {
+	for _, attr := range tok.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+func hostOf(src string) string {
+	src = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(src), "https://"), "http://")
+	src = strings.TrimPrefix(src, "//")
+	if i := strings.IndexAny(src, "/?#"); i != -1 {
+		src = src[:i]
+	}
+	if src == "" {
+		return "(без src)"
+	}
+	return src
+}
+
+func schemeOf(v string) string {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if i := strings.Index(v, ":"); i != -1 {
+		return v[:i]
+	}
+	return v
+}
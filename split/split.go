@@ -0,0 +1,372 @@
+// Package split разбивает результат конвертации на несколько вики-файлов:
+// по годам, по размеру или по тегам. Каждая часть получает свой
+// $:/SiteSubtitle и тиддлер-оглавление со ссылками на соседние файлы.
+package split
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"tiddlywiki-converter/navigation"
+	"tiddlywiki-converter/tiddlywiki"
+)
+
+// Policy - способ разбиения.
+type Policy string
+
+const (
+	ByYear Policy = "year"
+	BySize Policy = "size"
+	ByTag  Policy = "tag"
+)
+
+// IndexTitle - заголовок тиддлера со ссылками на все части.
+const IndexTitle = "Части архива"
+
+// Options задает политику разбиения и ограничения для BySize.
+type Options struct {
+	Policy      Policy
+	MaxBytes    int64
+	MaxTiddlers int
+}
+
+// Part - одна будущая вики.
+type Part struct {
+	Name     string // суффикс имени файла
+	Label    string // подпись для подзаголовка и оглавления
+	Path     string // путь к файлу части
+	Tiddlers []*tiddlywiki.Tiddler
+}
+
+// OptionsFromMap читает ключи split, split_max_mb и split_max_tiddlers.
+// Если разбиение не запрошено, возвращает nil.
+func OptionsFromMap(config map[string]string) (*Options, error) {
+	policy := Policy(strings.ToLower(strings.TrimSpace(config["split"])))
+	if policy == "" {
+		return nil, nil
+	}
+	opts := &Options{Policy: policy}
+	switch policy {
+	case ByYear, ByTag:
+	case BySize:
+		if v := config["split_max_mb"]; v != "" {
+			mb, err := strconv.ParseFloat(v, 64)
+			if err != nil || mb <= 0 {
+				return nil, fmt.Errorf("некорректное значение split_max_mb: %q", v)
+			}
+			opts.MaxBytes = int64(mb * 1024 * 1024)
+		}
+		if v := config["split_max_tiddlers"]; v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("некорректное значение split_max_tiddlers: %q", v)
+			}
+			opts.MaxTiddlers = n
+		}
+		if opts.MaxBytes == 0 && opts.MaxTiddlers == 0 {
+			return nil, fmt.Errorf("для разбиения по размеру укажите split_max_mb или split_max_tiddlers")
+		}
+	default:
+		return nil, fmt.Errorf("неизвестный способ разбиения: %q (допустимо: year, size, tag)", policy)
+	}
+	return opts, nil
+}
+
+// unit - неделимая единица разбиения: пост вместе со всеми его комментариями.
+type unit struct {
+	root     *tiddlywiki.Tiddler
+	created  time.Time
+	tiddlers []*tiddlywiki.Tiddler
+	size     int64
+}
+
+// Split распределяет тиддлеры по частям. Системные тиддлеры ($:/...), рубрики,
+// метки, авторы и серии попадают в каждую часть, комментарии всегда остаются
+// в одной части со своим постом.
+// Навигация, если она была создана, строится заново для каждой части.
+// Файлы частей располагаются рядом с outputPath: "blog_import.html"
+// превращается в "blog_import_2015.html" и т.д.
+func Split(tiddlers []*tiddlywiki.Tiddler, opts Options, outputPath string) []Part {
+	var shared []*tiddlywiki.Tiddler
+	var units []*unit
+	byTitle := make(map[string]*unit)
+	hadNavigation := false
+
+	for _, t := range tiddlers {
+		switch {
+		case t.Fields[tiddlywiki.FieldImportType] == tiddlywiki.ImportTypeNavigation:
+			hadNavigation = true
+		case strings.HasPrefix(t.Title, "$:/"), isReference(t):
+			shared = append(shared, t)
+		case t.Fields[tiddlywiki.FieldThreadRoot] == "":
+			created, _ := time.Parse(tiddlywiki.TiddlyTimeFormat, t.Created)
+			u := &unit{root: t, created: created}
+			units = append(units, u)
+			byTitle[t.Title] = u
+		}
+	}
+	// Комментарии обрабатываются вторым проходом: пост может идти после них.
+	for _, t := range tiddlers {
+		root := t.Fields[tiddlywiki.FieldThreadRoot]
+		if root == "" || t.Fields[tiddlywiki.FieldImportType] == tiddlywiki.ImportTypeNavigation {
+			continue
+		}
+		if u, ok := byTitle[root]; ok {
+			u.tiddlers = append(u.tiddlers, t)
+			continue
+		}
+		// Пост не найден - комментарий становится самостоятельной единицей.
+		created, _ := time.Parse(tiddlywiki.TiddlyTimeFormat, t.Created)
+		units = append(units, &unit{root: t, created: created})
+	}
+	for _, u := range units {
+		u.tiddlers = append([]*tiddlywiki.Tiddler{u.root}, u.tiddlers...)
+		for _, t := range u.tiddlers {
+			u.size += tiddlerSize(t)
+		}
+	}
+
+	var parts []Part
+	switch opts.Policy {
+	case ByYear:
+		parts = splitByYear(units)
+	case ByTag:
+		parts = splitByTag(units)
+	case BySize:
+		var sharedSize int64
+		for _, t := range shared {
+			sharedSize += tiddlerSize(t)
+		}
+		parts = splitBySize(units, opts, sharedSize, len(shared))
+	}
+
+	counts := make([]int, len(parts))
+	for i := range parts {
+		parts[i].Path = filepath.Join(filepath.Dir(outputPath), fileName(outputPath, parts[i].Name))
+		counts[i] = len(parts[i].Tiddlers)
+	}
+	for i := range parts {
+		parts[i].Tiddlers = finishPart(parts, counts, i, shared, hadNavigation)
+	}
+	return parts
+}
+
+// isReference отличает справочные тиддлеры (рубрики, метки, авторы, серии):
+// своей даты у них нет, created - время импорта, поэтому по году их не разложить.
+// На них ссылаются посты из всех частей.
+func isReference(t *tiddlywiki.Tiddler) bool {
+	switch t.Fields[tiddlywiki.FieldImportType] {
+	case tiddlywiki.ImportTypeAuthor, tiddlywiki.ImportTypeSeries:
+		return true
+	}
+	return t.Fields["wp-taxonomy"] != ""
+}
+
+func splitByYear(units []*unit) []Part {
+	groups := make(map[string][]*unit)
+	for _, u := range units {
+		key := "misc"
+		if !u.created.IsZero() {
+			key = strconv.Itoa(u.created.Year())
+		}
+		groups[key] = append(groups[key], u)
+	}
+	keys := sortedKeys(groups)
+	parts := make([]Part, 0, len(keys))
+	for _, key := range keys {
+		label := key
+		if key == "misc" {
+			label = "без даты"
+		}
+		parts = append(parts, Part{Name: key, Label: label, Tiddlers: flatten(groups[key])})
+	}
+	return parts
+}
+
+// splitByTag создает по вики на каждый тег. Пост с несколькими тегами
+// попадает во все соответствующие вики, пост без тегов - в отдельную часть.
+// Разные теги могут дать одно имя файла ("a/b" и "a b"), тогда к имени
+// добавляется номер, чтобы части не перезаписывали друг друга.
+func splitByTag(units []*unit) []Part {
+	groups := make(map[string][]*unit)
+	for _, u := range units {
+		tags := tiddlywiki.ParseList(u.root.Tags)
+		if len(tags) == 0 {
+			groups[""] = append(groups[""], u)
+		}
+		for _, tag := range tags {
+			groups[tag] = append(groups[tag], u)
+		}
+	}
+	keys := sortedKeys(groups)
+	parts := make([]Part, 0, len(keys))
+	used := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		name, label := fileSafe(key), "тег: "+key
+		if key == "" {
+			name, label = "untagged", "без тегов"
+		}
+		parts = append(parts, Part{Name: uniqueName("tag-"+name, used), Label: label, Tiddlers: flatten(groups[key])})
+	}
+	return parts
+}
+
+// uniqueName добавляет к имени номер (-2, -3 ...), если оно уже занято.
+// Имена сравниваются без учета регистра: так их сравнивает файловая система
+// Windows и macOS.
+func uniqueName(name string, used map[string]bool) string {
+	candidate := name
+	for n := 2; used[strings.ToLower(candidate)]; n++ {
+		candidate = fmt.Sprintf("%s-%d", name, n)
+	}
+	used[strings.ToLower(candidate)] = true
+	return candidate
+}
+
+// splitBySize заполняет части по порядку, не превышая лимиты. Единица, которая
+// сама по себе больше лимита, получает отдельную часть.
+func splitBySize(units []*unit, opts Options, sharedSize int64, sharedCount int) []Part {
+	sort.SliceStable(units, func(i, j int) bool { return units[i].created.Before(units[j].created) })
+
+	var groups [][]*unit
+	var current []*unit
+	var size int64
+	count := 0
+	for _, u := range units {
+		overBytes := opts.MaxBytes > 0 && sharedSize+size+u.size > opts.MaxBytes
+		overCount := opts.MaxTiddlers > 0 && sharedCount+count+len(u.tiddlers) > opts.MaxTiddlers
+		if len(current) > 0 && (overBytes || overCount) {
+			groups = append(groups, current)
+			current, size, count = nil, 0, 0
+		}
+		current = append(current, u)
+		size += u.size
+		count += len(u.tiddlers)
+	}
+	if len(current) > 0 {
+		groups = append(groups, current)
+	}
+
+	parts := make([]Part, 0, len(groups))
+	for i, g := range groups {
+		parts = append(parts, Part{
+			Name:     fmt.Sprintf("part-%02d", i+1),
+			Label:    fmt.Sprintf("часть %d из %d", i+1, len(groups)),
+			Tiddlers: flatten(g),
+		})
+	}
+	return parts
+}
+
+// finishPart добавляет к части общие тиддлеры, собственный подзаголовок,
+// оглавление со ссылками на соседние файлы и, при необходимости, навигацию.
+func finishPart(parts []Part, counts []int, i int, shared []*tiddlywiki.Tiddler, hadNavigation bool) []*tiddlywiki.Tiddler {
+	part := parts[i]
+	result := append([]*tiddlywiki.Tiddler{}, part.Tiddlers...)
+
+	subtitle := part.Label
+	defaultTiddlers := ""
+	for _, t := range shared {
+		switch t.Title {
+		case "$:/SiteSubtitle":
+			if t.Text != "" {
+				subtitle = t.Text + " — " + part.Label
+			}
+			continue
+		case "$:/DefaultTiddlers":
+			defaultTiddlers = t.Text
+			continue
+		}
+		result = append(result, t)
+	}
+
+	if hadNavigation {
+		result = tiddlywiki.Merge(result, navigation.Generate(result))
+		for _, t := range result {
+			if t.Title == "$:/DefaultTiddlers" {
+				defaultTiddlers = t.Text
+			}
+		}
+	}
+
+	result = tiddlywiki.Merge(result, []*tiddlywiki.Tiddler{
+		tiddlywiki.NewTiddler("$:/SiteSubtitle", subtitle, ""),
+		tiddlywiki.NewTiddler(IndexTitle, indexText(parts, counts, i), ""),
+		tiddlywiki.NewTiddler("$:/DefaultTiddlers", strings.TrimSpace("[["+IndexTitle+"]] "+defaultTiddlers), ""),
+	})
+	tiddlywiki.StabilizeTimestamps(result)
+	return result
+}
+
+func indexText(parts []Part, counts []int, current int) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("Всего частей: %d. Эта часть: ''%s''.\n\n", len(parts), parts[current].Label))
+	for i, p := range parts {
+		if i == current {
+			b.WriteString(fmt.Sprintf("# ''%s'' (тиддлеров: %d)\n", p.Label, counts[i]))
+			continue
+		}
+		b.WriteString(fmt.Sprintf("# [ext[%s|%s]] (тиддлеров: %d)\n", p.Label, "./"+filepath.Base(p.Path), counts[i]))
+	}
+	return b.String()
+}
+
+// WriteHTML сохраняет каждую часть в свой файл.
+func WriteHTML(parts []Part, templatePath string) error {
+	for _, p := range parts {
+		log.Printf("Запись части '%s': %d тиддлеров -> %s", p.Label, len(p.Tiddlers), p.Path)
+		if err := tiddlywiki.GenerateHTML(p.Tiddlers, templatePath, p.Path); err != nil {
+			return fmt.Errorf("не удалось записать часть '%s': %w", p.Label, err)
+		}
+	}
+	return nil
+}
+
+func fileName(outputPath, partName string) string {
+	base := filepath.Base(outputPath)
+	ext := filepath.Ext(base)
+	return strings.TrimSuffix(base, ext) + "_" + partName + ext
+}
+
+func tiddlerSize(t *tiddlywiki.Tiddler) int64 {
+	data, err := json.Marshal(t.ToJSONMap())
+	if err != nil {
+		return int64(len(t.Text))
+	}
+	return int64(len(data))
+}
+
+func flatten(units []*unit) []*tiddlywiki.Tiddler {
+	var result []*tiddlywiki.Tiddler
+	for _, u := range units {
+		result = append(result, u.tiddlers...)
+	}
+	return result
+}
+
+func sortedKeys(m map[string][]*unit) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// fileSafe превращает тег в безопасный фрагмент имени файла.
+func fileSafe(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|', ' ':
+			return '_'
+		}
+		return r
+	}, s)
+	return s
+}
@@ -0,0 +1,224 @@
+// Package tags приводит теги (метки, рубрики) из любых источников к единому
+// виду: Unicode-совместимый slug, приведение регистра, словарь синонимов,
+// префикс источника и ограничение длины. Конвертеры пропускают через него
+// только теги контента; служебные теги (draft, page, заголовки родителей
+// комментариев) остаются как есть.
+package tags
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Options - правила нормализации. Нулевое значение только убирает лишние
+// пробелы, поэтому без настройки теги импортируются как раньше.
+type Options struct {
+	// Slug заменяет пробелы и знаки препинания дефисом и удаляет прочие символы.
+	// Буквы и цифры любых алфавитов сохраняются.
+	Slug bool
+	// CaseFold приводит теги к нижнему регистру: "Go" и "go" становятся одним тегом.
+	CaseFold bool
+	// Aliases - синонимы: ключ (в нижнем регистре) заменяется значением.
+	Aliases map[string]string
+	// Prefix добавляется к каждому тегу, например "lj/".
+	Prefix string
+	// MaxLength ограничивает длину тега в символах вместе с префиксом; 0 - без ограничения.
+	MaxLength int
+}
+
+// Normalizer применяет Options к тегам.
+type Normalizer struct {
+	opts Options
+}
+
+// New создает нормализатор. Ключи синонимов приводятся к нижнему регистру.
+func New(opts Options) *Normalizer {
+	aliases := make(map[string]string, len(opts.Aliases))
+	for from, to := range opts.Aliases {
+		aliases[aliasKey(from)] = strings.TrimSpace(to)
+	}
+	opts.Aliases = aliases
+	return &Normalizer{opts: opts}
+}
+
+// Normalize возвращает нормализованный тег или пустую строку,
+// если от тега ничего не осталось. Значение синонима считается
+// окончательным видом тега: к нему добавляются только префикс и ограничение длины.
+func (n *Normalizer) Normalize(tag string) string {
+	tag = strings.Join(strings.Fields(tag), " ")
+	if alias, ok := n.opts.Aliases[aliasKey(tag)]; ok {
+		tag = alias
+	} else {
+		if n.opts.CaseFold {
+			tag = strings.ToLower(tag)
+		}
+		if n.opts.Slug {
+			tag = Slug(tag)
+		}
+		// Синоним можно задать и для нормализованной формы: "c-sharp = csharp".
+		if alias, ok := n.opts.Aliases[aliasKey(tag)]; ok {
+			tag = alias
+		}
+	}
+	if tag == "" {
+		return ""
+	}
+	tag = n.opts.Prefix + tag
+	if n.opts.MaxLength > 0 {
+		if runes := []rune(tag); len(runes) > n.opts.MaxLength {
+			tag = strings.TrimRight(string(runes[:n.opts.MaxLength]), " -")
+		}
+	}
+	return tag
+}
+
+// NormalizeList нормализует список, убирая пустые теги и повторы
+// (разные написания часто сводятся к одному тегу).
+func (n *Normalizer) NormalizeList(tags []string) []string {
+	var result []string
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = n.Normalize(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	return result
+}
+
+func aliasKey(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// Slug заменяет пробелы и знаки препинания дефисом, удаляет остальные
+// символы (эмодзи, знаки валют) и схлопывает повторяющиеся дефисы.
+// В отличие от ASCII-варианта, кириллица, CJK и буквы с диакритикой сохраняются.
+func Slug(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range s {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r):
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(r)
+		case unicode.IsSpace(r) || unicode.IsPunct(r):
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// --- ОБЩИЙ НОРМАЛИЗАТОР ---
+
+var defaultNormalizer = New(Options{})
+
+// SetDefault задает нормализатор, которым пользуются конвертеры.
+// Вызывать до начала конвертации.
+func SetDefault(n *Normalizer) {
+	defaultNormalizer = n
+}
+
+// Normalize нормализует тег общим нормализатором.
+func Normalize(tag string) string {
+	return defaultNormalizer.Normalize(tag)
+}
+
+// NormalizeList нормализует список тегов общим нормализатором.
+func NormalizeList(tags []string) []string {
+	return defaultNormalizer.NormalizeList(tags)
+}
+
+// --- НАСТРОЙКА ИЗ КОНФИГУРАЦИИ ---
+
+// OptionsFromMap читает ключи tag_slug, tag_case_fold, tag_aliases (путь
+// к файлу синонимов), tag_prefix и tag_max_length. Префикс задается одной
+// строкой для всех источников или по платформам: "livejournal:lj/,hashnode:hn/".
+func OptionsFromMap(config map[string]string) (Options, error) {
+	opts := Options{
+		Slug:     config["tag_slug"] == "true",
+		CaseFold: config["tag_case_fold"] == "true",
+	}
+	prefix, err := PrefixFor(config["tag_prefix"], config["platform"])
+	if err != nil {
+		return opts, err
+	}
+	opts.Prefix = prefix
+	if s := strings.TrimSpace(config["tag_max_length"]); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return opts, fmt.Errorf("некорректная максимальная длина тега: %q", s)
+		}
+		opts.MaxLength = n
+	}
+	if path := strings.TrimSpace(config["tag_aliases"]); path != "" {
+		aliases, err := LoadAliases(path)
+		if err != nil {
+			return opts, err
+		}
+		opts.Aliases = aliases
+	}
+	return opts, nil
+}
+
+// PrefixFor выбирает префикс для платформы. Значение без двоеточия
+// относится ко всем платформам.
+func PrefixFor(spec, platform string) (string, error) {
+	if !strings.Contains(spec, ":") {
+		return spec, nil
+	}
+	for _, part := range strings.Split(spec, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		name, prefix, ok := strings.Cut(part, ":")
+		if !ok {
+			return "", fmt.Errorf("некорректный префикс тегов %q, ожидается платформа:префикс", part)
+		}
+		if strings.EqualFold(strings.TrimSpace(name), platform) {
+			return prefix, nil
+		}
+	}
+	return "", nil
+}
+
+// LoadAliases читает файл синонимов. Каждая строка: "синоним1, синоним2 = тег".
+// Пустые строки и строки, начинающиеся с #, пропускаются.
+func LoadAliases(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия файла синонимов тегов: %w", err)
+	}
+	defer f.Close()
+
+	aliases := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		from, to, ok := strings.Cut(line, "=")
+		to = strings.TrimSpace(to)
+		if !ok || to == "" {
+			return nil, fmt.Errorf("%s:%d: ожидается \"синоним = тег\"", path, lineNo)
+		}
+		for _, alias := range strings.Split(from, ",") {
+			if alias = strings.TrimSpace(alias); alias != "" {
+				aliases[alias] = to
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка чтения файла синонимов тегов: %w", err)
+	}
+	return aliases, nil
+}
@@ -0,0 +1,77 @@
+package tiddlywiki
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// emptyStoreArea - пустое хранилище тиддлеров в шаблоне, на место которого
+// записывается содержимое вики.
+const emptyStoreArea = `<script id="storeArea" type="application/json">
+[]
+</script>`
+
+// HTMLWriter записывает вики потоково: каждый тиддлер сразу сериализуется
+// в storeArea, поэтому размер импорта не ограничен памятью. Формат файла
+// тот же, что у GenerateHTML. Тиддлеры с одинаковым заголовком не сливаются:
+// при загрузке TiddlyWiki остается последний.
+type HTMLWriter struct {
+	file   *os.File
+	w      *bufio.Writer
+	suffix string
+	count  int
+}
+
+// NewHTMLWriter создает outputPath и записывает в него начало шаблона.
+func NewHTMLWriter(templatePath, outputPath string) (*HTMLWriter, error) {
+	templateBytes, err := os.ReadFile(templatePath)
+	if err != nil {
+		return nil, err
+	}
+	prefix, suffix, ok := strings.Cut(string(templateBytes), emptyStoreArea)
+	if !ok {
+		return nil, fmt.Errorf("не удалось найти блок storeArea в шаблоне %s", templatePath)
+	}
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriterSize(file, 1<<20)
+	w.WriteString(prefix)
+	w.WriteString(`<script id="storeArea" type="application/json">` + "\n[")
+	return &HTMLWriter{file: file, w: w, suffix: "\n]\n</script>" + suffix}, nil
+}
+
+// Write добавляет тиддлер в хранилище.
+func (hw *HTMLWriter) Write(t *Tiddler) error {
+	data, err := json.MarshalIndent(t.ToJSONMap(), "  ", "  ")
+	if err != nil {
+		return fmt.Errorf("тиддлер %q: %w", t.Title, err)
+	}
+	if hw.count > 0 {
+		hw.w.WriteString(",")
+	}
+	hw.count++
+	hw.w.WriteString("\n  ")
+	// Закрывающий тег script не должен преждевременно закрыть блок хранилища.
+	_, err = hw.w.WriteString(strings.ReplaceAll(string(data), "</script>", "<\\/script>"))
+	return err
+}
+
+// Count возвращает число записанных тиддлеров.
+func (hw *HTMLWriter) Count() int {
+	return hw.count
+}
+
+// Close дописывает конец шаблона и закрывает файл.
+func (hw *HTMLWriter) Close() error {
+	hw.w.WriteString(hw.suffix)
+	if err := hw.w.Flush(); err != nil {
+		hw.file.Close()
+		return err
+	}
+	return hw.file.Close()
+}
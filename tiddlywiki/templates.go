@@ -0,0 +1,103 @@
+package tiddlywiki
+
+// Шаблоны отображения комментариев. Конвертеры записывают в комментарии только
+// структурные поля (parent, thread-root, comment-author, comment-date, source-url),
+// а вид обсуждения задают эти тиддлеры. Чтобы изменить оформление, достаточно
+// отредактировать их в вики - повторный импорт не нужен.
+
+const (
+	CommentThreadTemplateTitle = "$:/converter/templates/comment-thread"
+	CommentHeaderTemplateTitle = "$:/converter/templates/comment-header"
+	CommentStylesheetTitle     = "$:/converter/templates/comment-styles"
+)
+
+const commentThreadTemplate = `\whitespace trim
+\procedure converter-comment-thread(root)
+<$list filter="[field:parent<root>field:import-type[comment]sort[comment-date]]" variable="comment">
+<details class="tc-converter-comment" open>
+<summary>
+<span class="tc-converter-comment-author"><$text text={{{ [<comment>get[comment-author]else[аноним]] }}}/></span>
+<span class="tc-converter-comment-date"><$view tiddler=<<comment>> field="comment-date" format="date" template="DD MMM YYYY, 0hh:0mm"/></span>
+<$link to=<<comment>> class="tc-converter-comment-link">#</$link>
+</summary>
+<div class="tc-converter-comment-body"><$transclude tiddler=<<comment>> mode="block"/></div>
+<$transclude $variable="converter-comment-thread" root=<<comment>>/>
+</details>
+</$list>
+\end
+<$let root=<<currentTiddler>>>
+<$list filter="[field:parent<root>field:import-type[comment]limit[1]]" variable="ignore">
+<div class="tc-converter-comments">
+<$list filter="[<root>!field:import-type[comment]]" variable="ignore" emptyMessage="<h4>Ответы</h4>">
+<h3>Комментарии (<$count filter="[field:thread-root<root>field:import-type[comment]]"/>)</h3>
+</$list>
+<$transclude $variable="converter-comment-thread" root=<<root>>/>
+</div>
+</$list>
+</$let>
+`
+
+const commentHeaderTemplate = `\whitespace trim
+<$list filter="[all[current]field:import-type[comment]]">
+<div class="tc-converter-comment-meta">
+<span class="tc-converter-comment-author"><$view field="comment-author"/></span>
+<span class="tc-converter-comment-date"><$view field="comment-date" format="date" template="DD MMM YYYY, 0hh:0mm"/></span>
+<$list filter="[all[current]has[source-url]]">
+<a href={{!!source-url}} target="_blank" rel="noopener noreferrer">оригинал</a>
+</$list>
+<$list filter="[all[current]has[parent]]">
+<span>в ответ на <$link to={{!!parent}}/></span>
+</$list>
+</div>
+</$list>
+`
+
+const commentStylesheet = `\rules only filteredtranscludeinline transcludeinline macrodef macrocallinline
+.tc-converter-comments {
+	margin-top: 1.5em;
+	padding-top: 0.5em;
+	border-top: 1px solid <<colour tiddler-border>>;
+}
+.tc-converter-comment {
+	margin: 0.6em 0 0.6em 0;
+	padding-left: 0.8em;
+	border-left: 3px solid <<colour tiddler-border>>;
+}
+.tc-converter-comment > summary {
+	cursor: pointer;
+	color: <<colour muted-foreground>>;
+}
+.tc-converter-comment-author {
+	font-weight: bold;
+	color: <<colour foreground>>;
+	margin-right: 0.5em;
+}
+.tc-converter-comment-date {
+	margin-right: 0.5em;
+}
+.tc-converter-comment-body {
+	margin: 0.3em 0;
+}
+.tc-converter-comment-meta {
+	font-size: 0.9em;
+	color: <<colour muted-foreground>>;
+	margin-bottom: 0.8em;
+}
+.tc-converter-comment-meta > * {
+	margin-right: 0.7em;
+}
+`
+
+// CommentThreadTiddlers возвращает шаблоны и стили для отображения
+// вложенных сворачиваемых обсуждений под постами.
+func CommentThreadTiddlers() []*Tiddler {
+	thread := NewTiddler(CommentThreadTemplateTitle, commentThreadTemplate, "$:/tags/ViewTemplate")
+	thread.Fields["list-after"] = "$:/core/ui/ViewTemplate/body"
+
+	header := NewTiddler(CommentHeaderTemplateTitle, commentHeaderTemplate, "$:/tags/ViewTemplate")
+	header.Fields["list-before"] = "$:/core/ui/ViewTemplate/body"
+
+	styles := NewTiddler(CommentStylesheetTitle, commentStylesheet, "$:/tags/Stylesheet")
+
+	return []*Tiddler{thread, header, styles}
+}
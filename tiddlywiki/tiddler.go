@@ -1,6 +1,8 @@
 package tiddlywiki
 
 import (
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -20,9 +22,79 @@ type Tiddler struct {
 // tiddlyTimeFormat - это формат времени, который использует TiddlyWiki.
 const TiddlyTimeFormat = "20060102150405000"
 
+// Служебные поля, которыми конвертеры размечают тиддлеры, чтобы общие шаги
+// обработки (навигация, разбиение и т.д.) могли отличить посты от комментариев.
+const (
+	FieldImportType = "import-type"
+	FieldAuthor     = "author"
+	FieldSourceURL  = "source-url"
+
+	// Поля комментариев: по ним шаблон $:/converter/templates/comment-thread
+	// строит дерево обсуждения под любым постом.
+	FieldParent        = "parent"
+	FieldThreadRoot    = "thread-root"
+	FieldCommentAuthor = "comment-author"
+	FieldCommentDate   = "comment-date"
+)
+
+// Значения поля import-type.
+const (
+	ImportTypePost       = "post"
+	ImportTypeComment    = "comment"
+	ImportTypePage       = "page"
+	ImportTypeAttachment = "attachment"
+	ImportTypeAuthor     = "author"
+	ImportTypeNavigation = "navigation"
+	ImportTypeSeries     = "series"
+	// ImportTypeDraft - неопубликованный пост: в архив и ленту навигации не попадает.
+	ImportTypeDraft = "draft"
+)
+
+// clock возвращает время для тиддлеров, у которых нет собственной даты
+// (системные и служебные тиддлеры). В детерминированном режиме оно фиксируется.
+var clock = time.Now
+
+// SetFixedTime заставляет NewTiddler ставить всем новым тиддлерам одно и то же время.
+// Нужно для воспроизводимого результата: два импорта неизменного блога дают
+// побайтно одинаковые файлы. Вызывать до начала конвертации.
+func SetFixedTime(t time.Time) {
+	clock = func() time.Time { return t }
+	fixedStamp = t.UTC().Format(TiddlyTimeFormat)
+}
+
+// fixedStamp - время, выставленное SetFixedTime, в формате TiddlyWiki.
+var fixedStamp string
+
+// StabilizeTimestamps заменяет фиксированное время у служебных тиддлеров
+// на самую позднюю дату среди тиддлеров с собственной датой. Так служебные
+// тиддлеры получают осмысленную, но воспроизводимую дату. Без SetFixedTime
+// функция ничего не делает.
+func StabilizeTimestamps(tiddlers []*Tiddler) {
+	if fixedStamp == "" {
+		return
+	}
+	latest := ""
+	for _, t := range tiddlers {
+		if t.Created != fixedStamp && t.Created > latest {
+			latest = t.Created
+		}
+	}
+	if latest == "" {
+		return
+	}
+	for _, t := range tiddlers {
+		if t.Created == fixedStamp {
+			t.Created = latest
+		}
+		if t.Modified == fixedStamp {
+			t.Modified = latest
+		}
+	}
+}
+
 // NewTiddler теперь возвращает указатель, чтобы было удобнее работать с картой полей
 func NewTiddler(title, text, tags string) *Tiddler {
-	now := time.Now().UTC().Format(TiddlyTimeFormat)
+	now := clock().UTC().Format(TiddlyTimeFormat)
 	return &Tiddler{
 		Title:    title,
 		Text:     text,
@@ -34,7 +106,8 @@ func NewTiddler(title, text, tags string) *Tiddler {
 }
 
 // ToJSONMap преобразует Tiddler в карту для корректной сериализации в JSON,
-// включая пользовательские поля.
+// включая пользовательские поля. encoding/json сериализует ключи карты
+// в отсортированном порядке, так что результат не зависит от порядка полей.
 func (t *Tiddler) ToJSONMap() map[string]interface{} {
 	data := map[string]interface{}{
 		"title":    t.Title,
@@ -50,4 +123,69 @@ func (t *Tiddler) ToJSONMap() map[string]interface{} {
 		data[key] = value
 	}
 	return data
-}
\ No newline at end of file
+}
+
+// StringifyList записывает список заголовков в формате TiddlyWiki
+// (для полей tags и list): заголовки с пробелами оборачиваются в [[...]].
+func StringifyList(titles []string) string {
+	parts := make([]string, 0, len(titles))
+	for _, title := range titles {
+		if title == "" {
+			continue
+		}
+		if strings.ContainsAny(title, " \t\n") || strings.HasPrefix(title, "[[") {
+			parts = append(parts, "[["+title+"]]")
+		} else {
+			parts = append(parts, title)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// ParseList разбирает строку в формате TiddlyWiki (tags, list) в список заголовков.
+func ParseList(s string) []string {
+	var titles []string
+	for {
+		s = strings.TrimLeft(s, " \t\n")
+		if s == "" {
+			return titles
+		}
+		if strings.HasPrefix(s, "[[") {
+			if end := strings.Index(s, "]]"); end != -1 {
+				titles = append(titles, s[2:end])
+				s = s[end+2:]
+				continue
+			}
+		}
+		end := strings.IndexAny(s, " \t\n")
+		if end == -1 {
+			return append(titles, s)
+		}
+		titles = append(titles, s[:end])
+		s = s[end:]
+	}
+}
+
+// Merge добавляет к списку тиддлеры из extra. Тиддлер с уже существующим
+// заголовком заменяет старый на его месте, остальные добавляются в конец.
+func Merge(base, extra []*Tiddler) []*Tiddler {
+	index := make(map[string]int, len(base))
+	for i, t := range base {
+		index[t.Title] = i
+	}
+	for _, t := range extra {
+		if i, ok := index[t.Title]; ok {
+			base[i] = t
+			continue
+		}
+		index[t.Title] = len(base)
+		base = append(base, t)
+	}
+	return base
+}
+
+// SortByTitle упорядочивает тиддлеры по заголовку, чтобы порядок в файле
+// не зависел от порядка загрузки.
+func SortByTitle(tiddlers []*Tiddler) {
+	sort.SliceStable(tiddlers, func(i, j int) bool { return tiddlers[i].Title < tiddlers[j].Title })
+}
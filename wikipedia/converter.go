@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/url"
 	"regexp"
+	"sort"
 	"strings"
 
 	"golang.org/x/net/html"
@@ -638,6 +639,8 @@ func fetchCategories(articleTitle, domain string) ([]string, error) {
 			categories = append(categories, cat.Title)
 		}
 	}
+	// Pages - карта, поэтому сортируем, чтобы порядок не менялся от запуска к запуску.
+	sort.Strings(categories)
 	return categories, nil
 }
 
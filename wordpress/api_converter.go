@@ -1,17 +1,18 @@
 package wordpress
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"html"
-	"io"
 	"log"
 	"net/http"
 	"net/url"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
+	"tiddlywiki-converter/tags"
 	"tiddlywiki-converter/tiddlywiki"
 )
 
@@ -19,135 +20,298 @@ import (
 type WpComSite struct { Name string `json:"name"`; Description string `json:"description"` }
 type WpComPostAuthor struct { Name string `json:"name"` }
 type WpComPostTags map[string]struct { Name string `json:"name"` }
-type WpComPost struct { ID int `json:"ID"`; URL string `json:"URL"`; Date string `json:"date"`; Title string `json:"title"`; Content string `json:"content"`; Author WpComPostAuthor `json:"author"`; Tags WpComPostTags `json:"tags"`; Slug string `json:"slug"` }
+type WpComPost struct { ID int `json:"ID"`; URL string `json:"URL"`; Date string `json:"date"`; Title string `json:"title"`; Content string `json:"content"`; Author WpComPostAuthor `json:"author"`; Tags WpComPostTags `json:"tags"`; Slug string `json:"slug"`; Status string `json:"status"` }
 type WpComCommentAuthor struct { Name string `json:"name"` }
-type WpComComment struct { ID int `json:"ID"`; URL string `json:"URL"`; Author WpComCommentAuthor `json:"author"`; Date string `json:"date"`; Content string `json:"content"`; Parent interface{} `json:"parent"` }
+type WpComComment struct { ID int `json:"ID"`; URL string `json:"URL"`; Author WpComCommentAuthor `json:"author"`; Date string `json:"date"`; Content string `json:"content"`; Parent interface{} `json:"parent"`; Status string `json:"status"` }
 
 type SelfHostedSite struct { Name string `json:"name"`; Description string `json:"description"` }
 type SelfHostedRenderedField struct { Rendered string `json:"rendered"` }
-type SelfHostedEmbeddedData struct { Author []struct { Name string `json:"name"` } `json:"author"`; WpTerm [][]struct { Name string `json:"name"` } `json:"wp:term"` }
-type SelfHostedPost struct { ID int `json:"id"`; Date string `json:"date"`; Title SelfHostedRenderedField `json:"title"`; Content SelfHostedRenderedField `json:"content"`; Embedded SelfHostedEmbeddedData `json:"_embedded"`; Slug string `json:"slug"`; Link string `json:"link"` }
-type SelfHostedComment struct { ID int `json:"id"`; Post int `json:"post"`; Parent int `json:"parent"`; AuthorName string `json:"author_name"`; Date string `json:"date"`; Content SelfHostedRenderedField `json:"content"`; Link string `json:"link"` }
+type SelfHostedEmbeddedData struct { Author []struct { Name string `json:"name"` } `json:"author"`; WpTerm [][]SelfHostedTerm `json:"wp:term"` }
+type SelfHostedPost struct { ID int `json:"id"`; Date string `json:"date"`; Title SelfHostedRenderedField `json:"title"`; Content SelfHostedRenderedField `json:"content"`; Embedded SelfHostedEmbeddedData `json:"_embedded"`; Slug string `json:"slug"`; Link string `json:"link"`; Status string `json:"status"` }
+type SelfHostedComment struct { ID int `json:"id"`; Post int `json:"post"`; Parent int `json:"parent"`; AuthorName string `json:"author_name"`; Date string `json:"date"`; Content SelfHostedRenderedField `json:"content"`; Link string `json:"link"`; Status string `json:"status"` }
 
 var tagStripper = regexp.MustCompile("<[^>]*>")
 func stripHTML(input string) string { return tagStripper.ReplaceAllString(input, "") }
 
+// RESTOptions - настройки импорта через REST API.
+type RESTOptions struct {
+	Credentials Credentials
+	// PostTypes - дополнительные типы записей (product, portfolio ...) для самохостинга.
+	PostTypes []string
+}
+
 func ConvertFromURL(siteURL string) ([]*tiddlywiki.Tiddler, error) {
+	return ConvertFromURLWithOptions(siteURL, RESTOptions{})
+}
+
+// ConvertFromURLWithOptions импортирует сайт через REST API. С учетными данными
+// запрашиваются записи в любом статусе (status=any&context=edit) и все комментарии,
+// включая ожидающие модерации.
+func ConvertFromURLWithOptions(siteURL string, opts RESTOptions) ([]*tiddlywiki.Tiddler, error) {
 	parsedURL, err := url.Parse(siteURL)
 	if err != nil { return nil, fmt.Errorf("некорректный URL: %w", err) }
 	host := parsedURL.Host
 	isWpCom := strings.HasSuffix(host, ".wordpress.com")
+	client := newAPIClient(opts.Credentials, host)
+	if opts.Credentials.Authenticated() { log.Println("REST API: используется авторизованный доступ.") }
 
 	var allTiddlers []*tiddlywiki.Tiddler
 
 	if isWpCom {
-		siteInfo, err := fetchWpComSiteInfo(host)
+		siteInfo, err := fetchWpComSiteInfo(client, host)
 		if err != nil { log.Printf("Предупреждение: не удалось получить информацию о сайте: %v", err) }
 		if siteInfo != nil {
 			allTiddlers = append(allTiddlers, tiddlywiki.NewTiddler("$:/SiteTitle", siteInfo.Name, ""))
 			allTiddlers = append(allTiddlers, tiddlywiki.NewTiddler("$:/SiteSubtitle", siteInfo.Description, ""))
 		}
 		
-		posts, err := fetchAllWpComPosts(host)
+		posts, err := fetchAllWpComPosts(client, host)
 		if err != nil { return nil, err }
-		
-		for _, post := range posts {
-			baseTiddlerTitle := strings.ReplaceAll(html.UnescapeString(post.Title), " ", "_")
-			comments, err := fetchAllWpComCommentsForPost(host, post.ID)
-			if err != nil { log.Printf("Предупреждение: не удалось загрузить комментарии для поста %d: %v", post.ID, err) }
+
+		// Комментарии загружаются параллельно и складываются по индексу поста,
+		// поэтому порядок тиддлеров не зависит от порядка ответов.
+		log.Printf("Загрузка комментариев для %d постов...", len(posts))
+		commentsByPost := make([][]WpComComment, len(posts))
+		forEachConcurrently(len(posts), restWorkers, func(i int) {
+			comments, err := fetchAllWpComCommentsForPost(client, host, posts[i].ID)
+			if err != nil { log.Printf("Предупреждение: не удалось загрузить комментарии для поста %d: %v", posts[i].ID, err); return }
+			commentsByPost[i] = comments
+		})
+
+		for i, post := range posts {
+			baseTiddlerTitle := restTitle(post.Title, post.ID)
+			comments := commentsByPost[i]
 
 			var postTags []string
-			for _, tag := range post.Tags { postTags = append(postTags, fmt.Sprintf("[[%s]]", tag.Name)) }
-			tagsString := strings.Join(postTags, " ")
+			for _, tag := range post.Tags { postTags = append(postTags, tag.Name) }
+			sort.Strings(postTags) // Tags - это карта, порядок обхода случаен
+			tagsString := tiddlywiki.StringifyList(tags.NormalizeList(postTags))
 			created, _ := time.Parse(time.RFC3339, post.Date)
 			tiddlyTime := created.UTC().Format(tiddlywiki.TiddlyTimeFormat)
 			var postBody strings.Builder
-			postBody.WriteString(post.Content)
+			postBody.WriteString(ProcessContent(post.Content, &ContentContext{PostID: post.ID}))
 			postBody.WriteString(fmt.Sprintf("\n\n<p>''Автор: %s''</p>", post.Author.Name))
 			postBody.WriteString(fmt.Sprintf("\n\n---\n\n''Оригинал поста:'' <a href=\"%s\" target=\"_blank\">%s</a>", post.URL, post.URL))
-			if len(comments) > 0 { postBody.WriteString(fmt.Sprintf("\n\n---\n\n<<list-links \"[tag[%s]]\">>", baseTiddlerTitle)) }
 			postTiddler := tiddlywiki.NewTiddler(baseTiddlerTitle, postBody.String(), tagsString)
 			postTiddler.Created = tiddlyTime; postTiddler.Modified = tiddlyTime
+			postTiddler.Fields[tiddlywiki.FieldImportType] = tiddlywiki.ImportTypePost
+			postTiddler.Fields[tiddlywiki.FieldAuthor] = post.Author.Name
+			postTiddler.Fields[tiddlywiki.FieldSourceURL] = post.URL
+			applyPostStatus(postTiddler, post.Status)
 			allTiddlers = append(allTiddlers, postTiddler)
 
-			commentHierarchy := make(map[int]int); isParentMap := make(map[int]bool)
-			for _, comment := range comments { if parentMap, ok := comment.Parent.(map[string]interface{}); ok { if parentID, ok := parentMap["id"].(float64); ok { parentIDInt := int(parentID); if parentIDInt != 0 { commentHierarchy[comment.ID] = parentIDInt; isParentMap[parentIDInt] = true; } } } }
+			commentHierarchy := make(map[int]int)
+			for _, comment := range comments { if parentMap, ok := comment.Parent.(map[string]interface{}); ok { if parentID, ok := parentMap["id"].(float64); ok { parentIDInt := int(parentID); if parentIDInt != 0 { commentHierarchy[comment.ID] = parentIDInt } } } }
 			for _, comment := range comments {
 				parentTiddlerTitle := baseTiddlerTitle
 				if parentID, ok := commentHierarchy[comment.ID]; ok { parentTiddlerTitle = fmt.Sprintf("%s-comment-%d", baseTiddlerTitle, parentID) }
 				commentTiddlerTitle := fmt.Sprintf("%s-comment-%d", baseTiddlerTitle, comment.ID)
-				var commentBody strings.Builder
-				commentBody.WriteString(fmt.Sprintf("''Автор:'' %s\n", comment.Author.Name)); commentBody.WriteString(fmt.Sprintf("''Оригинал:'' <a href=\"%s\" target=\"_blank\">ссылка</a>\n\n---\n\n", comment.URL)); commentBody.WriteString(comment.Content)
-				if isParentMap[comment.ID] { commentBody.WriteString(fmt.Sprintf("\n\n---\n\n<<list-links \"[tag[%s]]\">>", commentTiddlerTitle)) }
 				createdComm, _ := time.Parse(time.RFC3339, comment.Date)
-				tiddlyCommTime := createdComm.UTC().Format(tiddlywiki.TiddlyTimeFormat)
-				commentTiddler := tiddlywiki.NewTiddler(commentTiddlerTitle, commentBody.String(), fmt.Sprintf("[[%s]]", parentTiddlerTitle))
-				commentTiddler.Created = tiddlyCommTime; commentTiddler.Modified = tiddlyCommTime
+				commentTiddler := newCommentTiddler(commentTiddlerTitle, parentTiddlerTitle, baseTiddlerTitle, comment.Author.Name, createdComm, comment.URL, comment.Content)
+				applyCommentStatus(commentTiddler, comment.Status)
 				allTiddlers = append(allTiddlers, commentTiddler)
 			}
 		}
 	} else {
 		// --- ЛОГИКА ДЛЯ САМОХОСТИНГА ---
-		siteInfo, err := fetchSelfHostedSiteInfo(host)
+		siteInfo, err := fetchSelfHostedSiteInfo(client, host)
 		if err != nil { log.Printf("Предупреждение: не удалось получить информацию о сайте: %v", err) }
 		if siteInfo != nil {
 			allTiddlers = append(allTiddlers, tiddlywiki.NewTiddler("$:/SiteTitle", siteInfo.Name, ""))
 			allTiddlers = append(allTiddlers, tiddlywiki.NewTiddler("$:/SiteSubtitle", siteInfo.Description, ""))
 		}
 
-		posts, err := fetchAllSelfHostedPosts(host)
+		categoryTiddlers, err := fetchSelfHostedCategories(client, host)
+		if err != nil { log.Printf("Предупреждение: не удалось загрузить рубрики: %v", err) }
+		allTiddlers = append(allTiddlers, categoryTiddlers...)
+
+		posts, err := fetchAllSelfHostedPosts(client, host)
 		if err != nil { return nil, err }
 		postMap := make(map[int]SelfHostedPost);
 		for _, post := range posts { postMap[post.ID] = post }
 		
-		comments, err := fetchAllSelfHostedComments(host)
+		comments, err := fetchAllSelfHostedComments(client, host)
 		if err != nil { log.Printf("Предупреждение: не удалось загрузить комментарии: %v", err) }
 
-		commentHierarchy := make(map[int]int); isParentMap := make(map[int]bool)
-		for _, comment := range comments { if comment.Parent != 0 { commentHierarchy[comment.ID] = comment.Parent; isParentMap[comment.Parent] = true; } }
+		commentHierarchy := make(map[int]int)
+		for _, comment := range comments { if comment.Parent != 0 { commentHierarchy[comment.ID] = comment.Parent } }
 		
 		for _, post := range posts {
-			cleanTitle := html.UnescapeString(post.Title.Rendered)
-			baseTiddlerTitle := strings.ReplaceAll(cleanTitle, " ", "_")
+			baseTiddlerTitle := restTitle(post.Title.Rendered, post.ID)
 			var postTags []string
-			if len(post.Embedded.WpTerm) > 0 { for _, termList := range post.Embedded.WpTerm { for _, term := range termList { postTags = append(postTags, fmt.Sprintf("[[%s]]", term.Name)) } } }
-			tagsString := strings.Join(postTags, " ")
+			if len(post.Embedded.WpTerm) > 0 { for _, termList := range post.Embedded.WpTerm { for _, term := range termList { postTags = append(postTags, html.UnescapeString(term.Name)) } } }
+			tagsString := tiddlywiki.StringifyList(tags.NormalizeList(postTags))
 			created, _ := time.Parse(time.RFC3339, post.Date)
 			tiddlyTime := created.UTC().Format(tiddlywiki.TiddlyTimeFormat)
 			var postBody strings.Builder
-			postBody.WriteString(html.UnescapeString(post.Content.Rendered))
-			if len(post.Embedded.Author) > 0 { authorName := html.UnescapeString(post.Embedded.Author[0].Name); postBody.WriteString(fmt.Sprintf("\n\n<p>''Автор: %s''</p>", authorName)) }
+			postBody.WriteString(ProcessContent(html.UnescapeString(post.Content.Rendered), &ContentContext{PostID: post.ID}))
+			authorName := ""
+			if len(post.Embedded.Author) > 0 { authorName = html.UnescapeString(post.Embedded.Author[0].Name); postBody.WriteString(fmt.Sprintf("\n\n<p>''Автор: %s''</p>", authorName)) }
 			postBody.WriteString(fmt.Sprintf("\n\n---\n\n''Оригинал поста:'' <a href=\"%s\" target=\"_blank\">%s</a>", post.Link, post.Link))
-			postBody.WriteString(fmt.Sprintf("\n\n---\n\n<<list-links \"[tag[%s]]\">>", baseTiddlerTitle))
 			postTiddler := tiddlywiki.NewTiddler(baseTiddlerTitle, postBody.String(), tagsString)
 			postTiddler.Created = tiddlyTime; postTiddler.Modified = tiddlyTime
+			postTiddler.Fields[tiddlywiki.FieldImportType] = tiddlywiki.ImportTypePost
+			if authorName != "" { postTiddler.Fields[tiddlywiki.FieldAuthor] = authorName }
+			postTiddler.Fields[tiddlywiki.FieldSourceURL] = post.Link
+			termFields(postTiddler, post.Embedded.WpTerm)
+			applyPostStatus(postTiddler, post.Status)
 			allTiddlers = append(allTiddlers, postTiddler)
 		}
 
 		for _, comment := range comments {
 			post, ok := postMap[comment.Post]
 			if !ok { continue }
-			parentPostTitle := strings.ReplaceAll(html.UnescapeString(post.Title.Rendered), " ", "_")
+			parentPostTitle := restTitle(post.Title.Rendered, post.ID)
 			parentTiddlerTitle := parentPostTitle
 			if parentID, ok := commentHierarchy[comment.ID]; ok { parentTiddlerTitle = fmt.Sprintf("%s-comment-%d", parentPostTitle, parentID) }
 			commentTiddlerTitle := fmt.Sprintf("%s-comment-%d", parentPostTitle, comment.ID)
-			var commentBody strings.Builder
-			commentBody.WriteString(fmt.Sprintf("''Автор:'' %s\n", comment.AuthorName)); commentBody.WriteString(fmt.Sprintf("''Оригинал:'' <a href=\"%s\" target=\"_blank\">ссылка</a>\n\n---\n\n", comment.Link)); commentBody.WriteString(html.UnescapeString(comment.Content.Rendered))
-			if isParentMap[comment.ID] { commentBody.WriteString(fmt.Sprintf("\n\n---\n\n<<list-links \"[tag[%s]]\">>", commentTiddlerTitle)) }
 			createdComm, _ := time.Parse(time.RFC3339, comment.Date)
-			tiddlyCommTime := createdComm.UTC().Format(tiddlywiki.TiddlyTimeFormat)
-			commentTiddler := tiddlywiki.NewTiddler(commentTiddlerTitle, commentBody.String(), fmt.Sprintf("[[%s]]", parentTiddlerTitle))
-			commentTiddler.Created = tiddlyCommTime; commentTiddler.Modified = tiddlyCommTime
+			commentTiddler := newCommentTiddler(commentTiddlerTitle, parentTiddlerTitle, parentPostTitle, comment.AuthorName, createdComm, comment.Link, html.UnescapeString(comment.Content.Rendered))
+			applyCommentStatus(commentTiddler, comment.Status)
 			allTiddlers = append(allTiddlers, commentTiddler)
 		}
+
+		pageTiddlers, err := fetchSelfHostedPages(client, host, "pages", tiddlywiki.ImportTypePage)
+		if err != nil { log.Printf("Предупреждение: не удалось загрузить страницы: %v", err) }
+		allTiddlers = append(allTiddlers, pageTiddlers...)
+
+		customTiddlers, err := fetchSelfHostedCustomTypes(client, host, opts.PostTypes)
+		if err != nil { log.Printf("Предупреждение: %v", err) }
+		allTiddlers = append(allTiddlers, customTiddlers...)
+
+		mediaTiddlers, err := fetchSelfHostedMedia(client, host)
+		if err != nil { log.Printf("Предупреждение: не удалось загрузить медиатеку: %v", err) }
+		allTiddlers = append(allTiddlers, mediaTiddlers...)
 	}
 	return allTiddlers, nil
 }
 
+// newCommentTiddler создает тиддлер комментария. Обсуждение строится не ссылками
+// в тексте, а полями parent/thread-root, которые отображает шаблон
+// $:/converter/templates/comment-thread. Тег с заголовком родителя сохраняется,
+// чтобы старые фильтры вида [tag[Пост]] продолжали работать.
+func newCommentTiddler(title, parentTitle, rootTitle, author string, created time.Time, sourceURL, content string) *tiddlywiki.Tiddler {
+	tiddlyTime := created.UTC().Format(tiddlywiki.TiddlyTimeFormat)
+	commentTiddler := tiddlywiki.NewTiddler(title, content, tiddlywiki.StringifyList([]string{parentTitle}))
+	commentTiddler.Created = tiddlyTime
+	commentTiddler.Modified = tiddlyTime
+	commentTiddler.Fields[tiddlywiki.FieldImportType] = tiddlywiki.ImportTypeComment
+	commentTiddler.Fields[tiddlywiki.FieldAuthor] = author
+	commentTiddler.Fields[tiddlywiki.FieldParent] = parentTitle
+	commentTiddler.Fields[tiddlywiki.FieldThreadRoot] = rootTitle
+	commentTiddler.Fields[tiddlywiki.FieldCommentAuthor] = author
+	commentTiddler.Fields[tiddlywiki.FieldCommentDate] = tiddlyTime
+	if sourceURL != "" {
+		commentTiddler.Fields[tiddlywiki.FieldSourceURL] = sourceURL
+	}
+	return commentTiddler
+}
+
+// applyPostStatus помечает неопубликованные записи так же, как импорт из WXR:
+// тегом draft или private и полем wp-status. При анонимном доступе API
+// возвращает только опубликованные записи.
+func applyPostStatus(t *tiddlywiki.Tiddler, status string) {
+	if status == "" {
+		return
+	}
+	t.Fields["wp-status"] = status
+	switch status {
+	case "publish":
+	case "private":
+		t.Tags = strings.TrimSpace(t.Tags + " private")
+	default:
+		t.Tags = strings.TrimSpace(t.Tags + " draft")
+		// Неопубликованные посты не попадают в навигацию.
+		if t.Fields[tiddlywiki.FieldImportType] == tiddlywiki.ImportTypePost {
+			t.Fields[tiddlywiki.FieldImportType] = tiddlywiki.ImportTypeDraft
+		}
+	}
+}
+
+// applyCommentStatus отмечает комментарии, не прошедшие модерацию.
+func applyCommentStatus(t *tiddlywiki.Tiddler, status string) {
+	if status != "" && status != "approved" {
+		t.Fields["wp-comment-status"] = status
+	}
+}
+
 // --- Функции загрузки ---
-func fetchWpComSiteInfo(host string) (*WpComSite, error) { apiURL := fmt.Sprintf("https://public-api.wordpress.com/rest/v1.1/sites/%s", host); resp, err := http.Get(apiURL); if err != nil { return nil, err }; defer resp.Body.Close(); if resp.StatusCode != http.StatusOK { return nil, fmt.Errorf("статус: %s", resp.Status) }; body, err := io.ReadAll(resp.Body); if err != nil { return nil, err }; var siteInfo WpComSite; if err := json.Unmarshal(body, &siteInfo); err != nil { return nil, err }; return &siteInfo, nil }
-func fetchAllWpComPosts(host string) ([]WpComPost, error) { var allPosts []WpComPost; page := 1; for { apiURL := fmt.Sprintf("https://public-api.wordpress.com/rest/v1.1/sites/%s/posts?page=%d&fields=ID,URL,date,title,content,author,tags,slug", host, page); log.Printf("Запрос к API постов: %s", apiURL); resp, err := http.Get(apiURL); if err != nil { return nil, err }; defer resp.Body.Close(); if resp.StatusCode != http.StatusOK { if page > 1 { break }; return nil, fmt.Errorf("статус: %s", resp.Status) }; body, err := io.ReadAll(resp.Body); if err != nil { return nil, err }; var apiResponse struct { Posts []WpComPost `json:"posts"` }; if err := json.Unmarshal(body, &apiResponse); err != nil { return nil, err }; if len(apiResponse.Posts) == 0 { break }; allPosts = append(allPosts, apiResponse.Posts...); log.Printf("Загружено %d постов со страницы %d.", len(apiResponse.Posts), page); page++; time.Sleep(250 * time.Millisecond) }; return allPosts, nil }
-func fetchAllWpComCommentsForPost(host string, postID int) ([]WpComComment, error) { var allComments []WpComComment; apiURL := fmt.Sprintf("https://public-api.wordpress.com/rest/v1.1/sites/%s/posts/%d/replies/?order=ASC", host, postID); log.Printf("   -> Запрос комментариев: %s", apiURL); resp, err := http.Get(apiURL); if err != nil { return nil, err }; defer resp.Body.Close(); if resp.StatusCode != http.StatusOK { return nil, fmt.Errorf("статус: %s", resp.Status) }; body, err := io.ReadAll(resp.Body); if err != nil { return nil, err }; var apiResponse struct { Comments []WpComComment `json:"comments"` }; if err := json.Unmarshal(body, &apiResponse); err != nil { return nil, err }; allComments = append(allComments, apiResponse.Comments...); log.Printf("   <- Найдено %d комментариев.", len(allComments)); time.Sleep(250 * time.Millisecond); return allComments, nil }
-func fetchSelfHostedSiteInfo(host string) (*SelfHostedSite, error) { apiURL := fmt.Sprintf("https://%s/wp-json/", host); resp, err := http.Get(apiURL); if err != nil { return nil, err }; defer resp.Body.Close(); if resp.StatusCode != http.StatusOK { return nil, fmt.Errorf("статус: %s", resp.Status) }; body, err := io.ReadAll(resp.Body); if err != nil { return nil, err }; var siteInfo SelfHostedSite; if err := json.Unmarshal(body, &siteInfo); err != nil { return nil, err }; return &siteInfo, nil }
-func fetchAllSelfHostedPosts(host string) ([]SelfHostedPost, error) { var allPosts []SelfHostedPost; page := 1; for { apiURL := fmt.Sprintf("https://%s/wp-json/wp/v2/posts?page=%d&_embed=author,wp:term", host, page); log.Printf("Запрос к API постов: %s", apiURL); resp, err := http.Get(apiURL); if err != nil { return nil, err }; defer resp.Body.Close(); if resp.StatusCode != http.StatusOK { if page > 1 { break }; return nil, fmt.Errorf("статус: %s", resp.Status) }; body, err := io.ReadAll(resp.Body); if err != nil { return nil, err }; var posts []SelfHostedPost; if err := json.Unmarshal(body, &posts); err != nil { return nil, err }; if len(posts) == 0 { break }; allPosts = append(allPosts, posts...); log.Printf("Загружено %d постов со страницы %d.", len(posts), page); page++; time.Sleep(250 * time.Millisecond) }; return allPosts, nil }
-func fetchAllSelfHostedComments(host string) ([]SelfHostedComment, error) { var allComments []SelfHostedComment; page := 1; for { apiURL := fmt.Sprintf("https://%s/wp-json/wp/v2/comments?page=%d&per_page=100&order=asc", host, page); log.Printf("Запрос к API комментариев: %s", apiURL); resp, err := http.Get(apiURL); if err != nil { return nil, err }; defer resp.Body.Close(); if resp.StatusCode != http.StatusOK { if page > 1 { break }; return nil, fmt.Errorf("статус: %s", resp.Status) }; body, err := io.ReadAll(resp.Body); if err != nil { return nil, err }; var comments []SelfHostedComment; if err := json.Unmarshal(body, &comments); err != nil { return nil, err }; if len(comments) == 0 { break }; allComments = append(allComments, comments...); log.Printf("Загружено %d комментариев со страницы %d.", len(comments), page); page++; time.Sleep(250 * time.Millisecond) }; return allComments, nil }
\ No newline at end of file
+
+// editQuery - параметры запроса, которые имеют смысл только при авторизации.
+func editQuery(client *apiClient, status string) string {
+	if !client.creds.Authenticated() {
+		return ""
+	}
+	return "&status=" + status + "&context=edit"
+}
+
+// isLastPage сообщает, что ошибка означает выход за последнюю страницу,
+// а не сбой: WordPress отвечает 400 с кодом rest_post_invalid_page_number
+// (rest_user_invalid_page_number и т.п.) на запрос несуществующей страницы.
+// Остальные ошибки (401, 403, 429, 500 ...) означают, что данные не получены.
+func isLastPage(err error, page int) bool {
+	var se *statusError
+	return page > 1 && errors.As(err, &se) && se.Code == http.StatusBadRequest &&
+		strings.HasPrefix(se.APICode, "rest_") && strings.HasSuffix(se.APICode, "_invalid_page_number")
+}
+
+func fetchWpComSiteInfo(client *apiClient, host string) (*WpComSite, error) {
+	var siteInfo WpComSite
+	if _, err := client.fetchJSON(fmt.Sprintf("https://public-api.wordpress.com/rest/v1.1/sites/%s", host), &siteInfo); err != nil { return nil, err }
+	return &siteInfo, nil
+}
+
+// wpComPageSize - максимальное значение параметра number в API WordPress.com.
+const wpComPageSize = 100
+
+func fetchAllWpComPosts(client *apiClient, host string) ([]WpComPost, error) {
+	return fetchFoundPages(func(page int) ([]WpComPost, int, error) {
+		apiURL := fmt.Sprintf("https://public-api.wordpress.com/rest/v1.1/sites/%s/posts?number=%d&page=%d&order=ASC&fields=ID,URL,date,title,content,author,tags,slug,status%s", host, wpComPageSize, page, editQuery(client, "any"))
+		log.Printf("Запрос к API постов: %s", apiURL)
+		var apiResponse struct { Found int `json:"found"`; Posts []WpComPost `json:"posts"` }
+		if _, err := client.fetchJSON(apiURL, &apiResponse); err != nil { return nil, 0, err }
+		log.Printf("Загружено %d постов со страницы %d.", len(apiResponse.Posts), page)
+		return apiResponse.Posts, apiResponse.Found, nil
+	})
+}
+
+func fetchAllWpComCommentsForPost(client *apiClient, host string, postID int) ([]WpComComment, error) {
+	return fetchFoundPages(func(page int) ([]WpComComment, int, error) {
+		apiURL := fmt.Sprintf("https://public-api.wordpress.com/rest/v1.1/sites/%s/posts/%d/replies/?number=%d&page=%d&order=ASC%s", host, postID, wpComPageSize, page, editQuery(client, "all"))
+		var apiResponse struct { Found int `json:"found"`; Comments []WpComComment `json:"comments"` }
+		if _, err := client.fetchJSON(apiURL, &apiResponse); err != nil { return nil, 0, err }
+		return apiResponse.Comments, apiResponse.Found, nil
+	})
+}
+
+// fetchFoundPages загружает первую страницу ответа WordPress.com, по полю found
+// вычисляет число страниц и загружает остальные параллельно, сохраняя порядок.
+func fetchFoundPages[T any](fetch func(page int) ([]T, int, error)) ([]T, error) {
+	all, found, err := fetch(1)
+	if err != nil { return nil, err }
+	total := (found + wpComPageSize - 1) / wpComPageSize
+	if total <= 1 { return all, nil }
+
+	pages := make([][]T, total-1)
+	errs := make([]error, total-1)
+	forEachConcurrently(total-1, restWorkers, func(i int) { pages[i], _, errs[i] = fetch(i + 2) })
+	for i, page := range pages {
+		if errs[i] != nil { return nil, fmt.Errorf("страница %d: %w", i+2, errs[i]) }
+		all = append(all, page...)
+	}
+	return all, nil
+}
+
+func fetchSelfHostedSiteInfo(client *apiClient, host string) (*SelfHostedSite, error) {
+	var siteInfo SelfHostedSite
+	if _, err := client.fetchJSON(fmt.Sprintf("https://%s/wp-json/", host), &siteInfo); err != nil { return nil, err }
+	return &siteInfo, nil
+}
+
+func fetchAllSelfHostedPosts(client *apiClient, host string) ([]SelfHostedPost, error) {
+	return fetchAllPages[SelfHostedPost](client, fmt.Sprintf("https://%s/wp-json/wp/v2/posts?_embed=author,wp:term%s", host, editQuery(client, "any")), "посты")
+}
+
+func fetchAllSelfHostedComments(client *apiClient, host string) ([]SelfHostedComment, error) {
+	return fetchAllPages[SelfHostedComment](client, fmt.Sprintf("https://%s/wp-json/wp/v2/comments?order=asc%s", host, editQuery(client, "all")), "комментарии")
+}
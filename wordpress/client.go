@@ -0,0 +1,207 @@
+package wordpress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// restWorkers - сколько запросов к API выполняется одновременно.
+	restWorkers = 8
+	// requestInterval - минимальный промежуток между запросами всех воркеров вместе.
+	requestInterval = 100 * time.Millisecond
+	// maxRetries - сколько раз повторять запрос после ответа 429/503.
+	maxRetries = 3
+	// wpComAPIHost - единственный хост, которому передается токен WordPress.com.
+	wpComAPIHost = "public-api.wordpress.com"
+)
+
+// Credentials - данные для авторизованного доступа к REST API. Нужны, чтобы
+// получить черновики, личные записи и комментарии на модерации, а также
+// для сайтов, где REST API закрыт для анонимных запросов.
+type Credentials struct {
+	// Username и AppPassword - пароль приложения WordPress (Пользователи -> Профиль ->
+	// Пароли приложений), передается через Basic-авторизацию.
+	Username    string
+	AppPassword string
+	// BearerToken - OAuth-токен WordPress.com.
+	BearerToken string
+}
+
+// CredentialsFromMap читает ключи wp_username, wp_app_password и wpcom_token,
+// а если они не заданы - переменные окружения WP_USERNAME, WP_APP_PASSWORD
+// и WPCOM_TOKEN. Флагов командной строки для них нет намеренно: аргументы
+// видны другим пользователям системы и попадают в историю оболочки.
+func CredentialsFromMap(config map[string]string) Credentials {
+	get := func(key, env string) string {
+		if v := strings.TrimSpace(config[key]); v != "" {
+			return v
+		}
+		return strings.TrimSpace(os.Getenv(env))
+	}
+	return Credentials{
+		Username: get("wp_username", "WP_USERNAME"),
+		// Пароль приложения показывается с пробелами, WordPress принимает оба варианта.
+		AppPassword: get("wp_app_password", "WP_APP_PASSWORD"),
+		BearerToken: get("wpcom_token", "WPCOM_TOKEN"),
+	}
+}
+
+// Authenticated сообщает, заданы ли какие-либо учетные данные.
+func (c Credentials) Authenticated() bool {
+	return (c.Username != "" && c.AppPassword != "") || c.BearerToken != ""
+}
+
+// apiClient выполняет запросы к REST API с авторизацией, если она задана.
+// Клиент общий для всех воркеров, поэтому ограничение частоты запросов
+// действует на импорт целиком.
+type apiClient struct {
+	http     *http.Client
+	creds    Credentials
+	siteHost string // хост импортируемого сайта, ему передается пароль приложения
+
+	mu   sync.Mutex
+	next time.Time // раньше этого момента новый запрос не отправляется
+}
+
+func newAPIClient(creds Credentials, siteHost string) *apiClient {
+	c := &apiClient{creds: creds, siteHost: strings.ToLower(siteHost)}
+	c.http = &http.Client{
+		Timeout: 60 * time.Second,
+		// При переадресации учетные данные выставляются заново по адресу назначения.
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("слишком много переадресаций")
+			}
+			return c.authorize(req)
+		},
+	}
+	return c
+}
+
+// authorize добавляет учетные данные, только если запрос идет на их хост:
+// токен WordPress.com - на public-api.wordpress.com, пароль приложения -
+// на сам сайт. Адреса из ответов сайта могут вести на сторонние хосты.
+// Учетные данные передаются только по https: если запрос на их хост идет
+// по http (например, после переадресации), он не выполняется.
+func (c *apiClient) authorize(req *http.Request) error {
+	req.Header.Del("Authorization")
+	host := strings.ToLower(req.URL.Hostname())
+	bearer := c.creds.BearerToken != "" && host == wpComAPIHost
+	basic := c.creds.Username != "" && c.creds.AppPassword != "" && c.siteHost != "" && strings.ToLower(req.URL.Host) == c.siteHost
+	if !bearer && !basic {
+		return nil
+	}
+	if req.URL.Scheme != "https" {
+		return fmt.Errorf("учетные данные не передаются по незащищенному соединению: %s", req.URL.Redacted())
+	}
+	if bearer {
+		req.Header.Set("Authorization", "Bearer "+c.creds.BearerToken)
+	} else {
+		req.SetBasicAuth(c.creds.Username, c.creds.AppPassword)
+	}
+	return nil
+}
+
+// statusError - ответ API с кодом, отличным от 200.
+type statusError struct {
+	URL    string
+	Code   int
+	Status string
+	// APICode - код ошибки WordPress из тела ответа, например rest_post_invalid_page_number.
+	APICode string
+}
+
+func (e *statusError) Error() string {
+	switch e.Code {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Sprintf("статус: %s (проверьте учетные данные WP_USERNAME/WP_APP_PASSWORD или WPCOM_TOKEN)", e.Status)
+	}
+	return fmt.Sprintf("статус: %s", e.Status)
+}
+
+// wait выдерживает паузу между запросами.
+func (c *apiClient) wait(delay time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if next := time.Now().Add(delay); next.After(c.next) {
+		c.next = next
+	}
+	time.Sleep(time.Until(c.next))
+	c.next = time.Now().Add(requestInterval)
+}
+
+// fetchJSON выполняет GET-запрос и декодирует ответ в target.
+// Возвращает заголовки ответа: в них API сообщает число страниц.
+// На ответы 429 и 503 запрос повторяется после паузы из Retry-After.
+func (c *apiClient) fetchJSON(apiURL string, target interface{}) (http.Header, error) {
+	var delay time.Duration
+	for attempt := 0; ; attempt++ {
+		c.wait(delay)
+		header, err := c.fetchOnce(apiURL, target)
+		se, ok := err.(*statusError)
+		if !ok || attempt == maxRetries || (se.Code != http.StatusTooManyRequests && se.Code != http.StatusServiceUnavailable) {
+			return header, err
+		}
+		delay = time.Duration(attempt+1) * 5 * time.Second
+		if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil {
+			delay = time.Duration(seconds) * time.Second
+		}
+		log.Printf("API ограничивает частоту запросов (%s), повтор через %s.", se.Status, delay)
+	}
+}
+
+func (c *apiClient) fetchOnce(apiURL string, target interface{}) (http.Header, error) {
+	req, err := http.NewRequest(http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if err := c.authorize(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Code string `json:"code"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&apiErr)
+		io.Copy(io.Discard, resp.Body)
+		return resp.Header, &statusError{URL: apiURL, Code: resp.StatusCode, Status: resp.Status, APICode: apiErr.Code}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return resp.Header, fmt.Errorf("ошибка разбора ответа %s: %w", apiURL, err)
+	}
+	return resp.Header, nil
+}
+
+// forEachConcurrently вызывает fn для индексов 0..n-1, не более workers
+// одновременно. Результаты fn должна складывать по индексу, тогда порядок
+// не зависит от того, какой запрос завершится первым.
+func forEachConcurrently(n, workers int, fn func(i int)) {
+	var wg sync.WaitGroup
+	guard := make(chan struct{}, workers)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		guard <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-guard }()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
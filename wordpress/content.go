@@ -0,0 +1,290 @@
+package wordpress
+
+import (
+	"encoding/json"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// --- ШОРТКОДЫ И БЛОКИ GUTENBERG ---
+//
+// Контент WordPress содержит шорткоды ([caption], [gallery], [embed], [code] ...)
+// и разметку блоков редактора (<!-- wp:paragraph --> ... <!-- /wp:paragraph -->).
+// ProcessContent заменяет их на HTML или вики-текст обработчиками из реестра.
+// Незарегистрированные шорткоды остаются как есть, разметка блоков удаляется всегда.
+
+// ContentContext - сведения о записи, доступные обработчикам.
+type ContentContext struct {
+	PostID int
+}
+
+// Shortcode - разобранный шорткод.
+type Shortcode struct {
+	Name        string
+	Attrs       map[string]string // именованные атрибуты, ключи в нижнем регистре
+	Positional  []string          // атрибуты без имени: [embed https://...]
+	Content     string            // текст между [name] и [/name]
+	SelfClosing bool              // у шорткода нет закрывающего тега
+}
+
+// Attr возвращает первый непустой из перечисленных атрибутов.
+func (s Shortcode) Attr(names ...string) string {
+	for _, name := range names {
+		if v := s.Attrs[name]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// Block - блок редактора Gutenberg.
+type Block struct {
+	Name  string                 // полное имя, например "core/code"
+	Attrs map[string]interface{} // JSON-атрибуты из комментария-разделителя
+	Inner string                 // HTML блока с уже обработанными вложенными блоками
+}
+
+// StringAttr возвращает строковый атрибут блока.
+func (b Block) StringAttr(name string) string {
+	s, _ := b.Attrs[name].(string)
+	return s
+}
+
+type ShortcodeHandler func(sc Shortcode, ctx *ContentContext) string
+type BlockHandler func(b Block, ctx *ContentContext) string
+
+var (
+	shortcodeHandlers = make(map[string]ShortcodeHandler)
+	blockHandlers     = make(map[string]BlockHandler)
+)
+
+// RegisterShortcode добавляет или заменяет обработчик шорткода.
+// Регистрировать обработчики нужно до начала импорта.
+func RegisterShortcode(name string, handler ShortcodeHandler) {
+	shortcodeHandlers[strings.ToLower(name)] = handler
+}
+
+// RegisterBlock добавляет или заменяет обработчик блока. Имя без пространства
+// имен относится к core: "code" и "core/code" - один и тот же блок.
+func RegisterBlock(name string, handler BlockHandler) {
+	blockHandlers[blockName(name)] = handler
+}
+
+// ProcessContent преобразует блоки и шорткоды в тексте записи.
+func ProcessContent(content string, ctx *ContentContext) string {
+	if ctx == nil {
+		ctx = &ContentContext{}
+	}
+	if strings.Contains(content, "<!-- wp:") || strings.Contains(content, "<!-- /wp:") {
+		content = processBlocks(content, ctx)
+	}
+	if strings.Contains(content, "[") {
+		content = processShortcodes(content, ctx)
+	}
+	return content
+}
+
+// --- БЛОКИ ---
+
+var blockDelimiter = regexp.MustCompile(`<!--\s+(/)?wp:([a-z][a-z0-9_-]*(?:/[a-z][a-z0-9_-]*)?)\s+(\{.*?\}\s+)?(/)?-->`)
+
+func blockName(name string) string {
+	if !strings.Contains(name, "/") {
+		return "core/" + name
+	}
+	return name
+}
+
+// openBlock - блок, для которого еще не встретился закрывающий разделитель.
+type openBlock struct {
+	block Block
+	out   strings.Builder
+}
+
+// processBlocks проходит по разделителям блоков со стеком открытых блоков.
+// Содержимое каждого блока передается обработчику уже с обработанными вложенными
+// блоками. Незакрытые блоки в конце текста закрываются неявно.
+func processBlocks(content string, ctx *ContentContext) string {
+	root := &openBlock{}
+	stack := []*openBlock{root}
+	last := 0
+	for _, m := range blockDelimiter.FindAllStringSubmatchIndex(content, -1) {
+		top := stack[len(stack)-1]
+		top.out.WriteString(content[last:m[0]])
+		last = m[1]
+
+		closing := m[2] != -1
+		name := blockName(content[m[4]:m[5]])
+		var attrs map[string]interface{}
+		if m[6] != -1 {
+			_ = json.Unmarshal([]byte(content[m[6]:m[7]]), &attrs)
+		}
+
+		switch {
+		case closing:
+			// Закрывающий разделитель без пары игнорируется.
+			for i := len(stack) - 1; i > 0; i-- {
+				if stack[i].block.Name == name {
+					for len(stack) > i {
+						finishBlock(&stack, ctx)
+					}
+					break
+				}
+			}
+		case m[8] != -1: // самозакрывающийся блок <!-- wp:name /-->
+			top.out.WriteString(renderBlock(Block{Name: name, Attrs: attrs}, ctx))
+		default:
+			stack = append(stack, &openBlock{block: Block{Name: name, Attrs: attrs}})
+		}
+	}
+	stack[len(stack)-1].out.WriteString(content[last:])
+	for len(stack) > 1 {
+		finishBlock(&stack, ctx)
+	}
+	return root.out.String()
+}
+
+func finishBlock(stack *[]*openBlock, ctx *ContentContext) {
+	s := *stack
+	top := s[len(s)-1]
+	top.block.Inner = top.out.String()
+	*stack = s[:len(s)-1]
+	s[len(s)-2].out.WriteString(renderBlock(top.block, ctx))
+}
+
+func renderBlock(b Block, ctx *ContentContext) string {
+	if handler, ok := blockHandlers[b.Name]; ok {
+		return handler(b, ctx)
+	}
+	// Старые встраивания назывались core-embed/youtube и т.п.
+	if strings.HasPrefix(b.Name, "core-embed/") {
+		if handler, ok := blockHandlers["core/embed"]; ok {
+			return handler(b, ctx)
+		}
+	}
+	return b.Inner
+}
+
+// --- ШОРТКОДЫ ---
+
+// processShortcodes ищет шорткоды из реестра. Как и в WordPress, [[name]]
+// экранирует шорткод и выводится как [name]. Результат обработчика
+// повторно не разбирается, поэтому содержимое [code] остается нетронутым.
+func processShortcodes(content string, ctx *ContentContext) string {
+	var out strings.Builder
+	for {
+		i := strings.IndexByte(content, '[')
+		if i == -1 {
+			out.WriteString(content)
+			break
+		}
+		out.WriteString(content[:i])
+		content = content[i:]
+
+		sc, consumed, ok := parseShortcode(content)
+		if !ok {
+			out.WriteByte('[')
+			content = content[1:]
+			continue
+		}
+		if strings.HasPrefix(content, "[[") {
+			if strings.HasPrefix(content[consumed:], "]") {
+				out.WriteString(content[1:consumed])
+				content = content[consumed+1:]
+			} else {
+				out.WriteByte('[')
+				content = content[1:]
+			}
+			continue
+		}
+		out.WriteString(shortcodeHandlers[sc.Name](sc, ctx))
+		content = content[consumed:]
+	}
+	return out.String()
+}
+
+var shortcodeAttr = regexp.MustCompile(`([\w-]+)\s*=\s*"([^"]*)"|([\w-]+)\s*=\s*'([^']*)'|([\w-]+)\s*=\s*([^\s'"]+)|"([^"]*)"|'([^']*)'|(\S+)`)
+
+// parseShortcode разбирает шорткод в начале s. Возвращает число прочитанных байт.
+func parseShortcode(s string) (Shortcode, int, bool) {
+	start := 1
+	if strings.HasPrefix(s, "[[") {
+		start = 2
+	}
+	end := start
+	for end < len(s) && (isNameByte(s[end])) {
+		end++
+	}
+	name := strings.ToLower(s[start:end])
+	if _, ok := shortcodeHandlers[name]; !ok || end == len(s) {
+		return Shortcode{}, 0, false
+	}
+	if c := s[end]; c != ']' && c != '/' && c != ' ' && c != '\t' && c != '\n' {
+		return Shortcode{}, 0, false
+	}
+	closeIdx := strings.IndexByte(s[end:], ']')
+	if closeIdx == -1 {
+		return Shortcode{}, 0, false
+	}
+	closeIdx += end
+
+	sc := Shortcode{Name: name, Attrs: make(map[string]string)}
+	rawAttrs := s[end:closeIdx]
+	if strings.HasSuffix(rawAttrs, "/") {
+		sc.SelfClosing = true
+		rawAttrs = strings.TrimSuffix(rawAttrs, "/")
+	}
+	parseShortcodeAttrs(rawAttrs, &sc)
+	consumed := closeIdx + 1
+
+	// Экранированный шорткод [[name]] без содержимого: закрывающий тег не ищем.
+	escaped := start == 2 && strings.HasPrefix(s[consumed:], "]")
+	if !sc.SelfClosing && !escaped {
+		closer := "[/" + s[start:end] + "]"
+		if j := strings.Index(strings.ToLower(s[consumed:]), strings.ToLower(closer)); j != -1 {
+			sc.Content = s[consumed : consumed+j]
+			consumed += j + len(closer)
+		} else {
+			sc.SelfClosing = true
+		}
+	}
+	return sc, consumed, true
+}
+
+func isNameByte(c byte) bool {
+	return c == '_' || c == '-' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// parseShortcodeAttrs разбирает атрибуты. Редактор WordPress иногда
+// превращает кавычки в типографские (&#8221;, ″), их приводим к обычным.
+func parseShortcodeAttrs(raw string, sc *Shortcode) {
+	raw = html.UnescapeString(raw)
+	raw = strings.NewReplacer("“", `"`, "”", `"`, "″", `"`, "′", "'", "\u00a0", " ").Replace(raw)
+	for _, m := range shortcodeAttr.FindAllStringSubmatch(raw, -1) {
+		switch {
+		case m[1] != "":
+			sc.Attrs[strings.ToLower(m[1])] = m[2]
+		case m[3] != "":
+			sc.Attrs[strings.ToLower(m[3])] = m[4]
+		case m[5] != "":
+			sc.Attrs[strings.ToLower(m[5])] = m[6]
+		case m[7] != "" || m[8] != "":
+			sc.Positional = append(sc.Positional, m[7]+m[8])
+		default:
+			sc.Positional = append(sc.Positional, m[9])
+		}
+	}
+}
+
+// intList разбирает список чисел через запятую, пропуская некорректные значения.
+func intList(s string) []int {
+	var result []int
+	for _, part := range strings.Split(s, ",") {
+		if n, err := strconv.Atoi(strings.TrimSpace(part)); err == nil {
+			result = append(result, n)
+		}
+	}
+	return result
+}
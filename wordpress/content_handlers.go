@@ -0,0 +1,214 @@
+package wordpress
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Встроенные обработчики шорткодов и блоков ядра WordPress.
+func init() {
+	RegisterShortcode("caption", captionShortcode)
+	RegisterShortcode("wp_caption", captionShortcode)
+	RegisterShortcode("gallery", galleryShortcode)
+	RegisterShortcode("embed", embedShortcode)
+	RegisterShortcode("code", codeShortcode)
+	RegisterShortcode("sourcecode", codeShortcode)
+	RegisterShortcode("audio", mediaShortcode)
+	RegisterShortcode("video", mediaShortcode)
+	RegisterShortcode("playlist", func(sc Shortcode, ctx *ContentContext) string { return "" })
+
+	RegisterBlock("code", codeBlock)
+	RegisterBlock("preformatted", codeBlock)
+	RegisterBlock("syntaxhighlighter/code", codeBlock)
+	RegisterBlock("embed", embedBlock)
+	RegisterBlock("more", func(b Block, ctx *ContentContext) string { return "" })
+	RegisterBlock("nextpage", func(b Block, ctx *ContentContext) string { return "" })
+}
+
+// captionImage отделяет картинку (возможно, обернутую в ссылку) от подписи
+// в старом формате [caption]<img ...> Подпись[/caption].
+var captionImage = regexp.MustCompile(`(?s)^\s*((?:<a\s[^>]*>\s*)?<img\s[^>]*>(?:\s*</a>)?)(.*)$`)
+
+func captionShortcode(sc Shortcode, ctx *ContentContext) string {
+	image, caption := sc.Content, sc.Attr("caption")
+	if m := captionImage.FindStringSubmatch(sc.Content); m != nil {
+		image = m[1]
+		if caption == "" {
+			caption = strings.TrimSpace(m[2])
+		}
+	}
+	class := "wp-caption"
+	if align := sc.Attr("align"); align != "" {
+		class += " " + align
+	}
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf(`<figure class="%s">%s`, html.EscapeString(class), image))
+	if caption != "" {
+		b.WriteString("<figcaption>" + caption + "</figcaption>")
+	}
+	b.WriteString("</figure>")
+	return b.String()
+}
+
+// galleryShortcode строит сетку изображений. Вложения к этому моменту могут быть
+// еще не прочитаны (в WXR они обычно идут после записи), поэтому галерея
+// выбирает тиддлеры вложений фильтром при отображении: по post-id из ids
+// или по wp-post-parent, если ids не указан.
+func galleryShortcode(sc Shortcode, ctx *ContentContext) string {
+	columns, err := strconv.Atoi(sc.Attr("columns"))
+	if err != nil || columns <= 0 {
+		columns = 3
+	}
+
+	var filter string
+	if ids := intList(sc.Attr("ids", "include")); len(ids) > 0 {
+		var runs []string
+		for _, id := range ids {
+			runs = append(runs, fmt.Sprintf("[field:post-id[%d]]", id))
+		}
+		filter = strings.Join(runs, " ")
+	} else if ctx.PostID != 0 {
+		filter = fmt.Sprintf("[field:wp-post-parent[%d]sort[title]]", ctx.PostID)
+	} else {
+		return ""
+	}
+
+	return fmt.Sprintf(`<div class="wp-gallery" style="display:grid;grid-template-columns:repeat(%d,1fr);gap:8px">
+<$list filter="%s :filter[get[type]prefix[image/]]" variable="attachment">
+<figure class="wp-gallery-item"><$image source=<<attachment>>/><figcaption><$view tiddler=<<attachment>> field="caption"/></figcaption></figure>
+</$list>
+</div>`, columns, filter)
+}
+
+func embedShortcode(sc Shortcode, ctx *ContentContext) string {
+	src := strings.TrimSpace(sc.Content)
+	if src == "" {
+		src = sc.Attr("url", "src")
+	}
+	if src == "" && len(sc.Positional) > 0 {
+		src = sc.Positional[0]
+	}
+	return embedHTML(src)
+}
+
+func embedBlock(b Block, ctx *ContentContext) string {
+	src := b.StringAttr("url")
+	if src == "" {
+		return b.Inner
+	}
+	out := embedHTML(src)
+	if caption := figcaption.FindStringSubmatch(b.Inner); caption != nil {
+		out = "<figure>" + out + "<figcaption>" + caption[1] + "</figcaption></figure>"
+	}
+	return out
+}
+
+var figcaption = regexp.MustCompile(`(?s)<figcaption[^>]*>(.*?)</figcaption>`)
+
+// embedHTML превращает ссылку на видео известного сервиса в iframe,
+// остальные ссылки выводятся обычной ссылкой.
+func embedHTML(raw string) string {
+	raw = html.UnescapeString(strings.TrimSpace(raw))
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return html.EscapeString(raw)
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	var player string
+	switch {
+	case host == "youtube.com" || host == "m.youtube.com":
+		if id := u.Query().Get("v"); id != "" {
+			player = "https://www.youtube.com/embed/" + url.PathEscape(id)
+		}
+	case host == "youtu.be":
+		player = "https://www.youtube.com/embed/" + url.PathEscape(strings.Trim(u.Path, "/"))
+	case host == "vimeo.com":
+		if id := strings.Trim(u.Path, "/"); id != "" {
+			player = "https://player.vimeo.com/video/" + url.PathEscape(id)
+		}
+	case host == "rutube.ru" && strings.HasPrefix(u.Path, "/video/"):
+		player = "https://rutube.ru/play/embed/" + url.PathEscape(strings.Trim(strings.TrimPrefix(u.Path, "/video/"), "/"))
+	}
+	escaped := html.EscapeString(raw)
+	if player == "" {
+		return fmt.Sprintf(`<a href="%s">%s</a>`, escaped, escaped)
+	}
+	return fmt.Sprintf(`<iframe width="560" height="315" src="%s" frameborder="0" allowfullscreen></iframe>`, html.EscapeString(player))
+}
+
+// codeShortcode выводит код блоком ``` вики-текста TiddlyWiki с подсветкой
+// по атрибуту lang/language. Сущности HTML в коде раскодируются.
+func codeShortcode(sc Shortcode, ctx *ContentContext) string {
+	lang := sc.Attr("lang", "language")
+	if lang == "" && len(sc.Positional) > 0 && !strings.Contains(sc.Positional[0], "=") {
+		lang = sc.Positional[0]
+	}
+	return fencedCode(html.UnescapeString(sc.Content), lang)
+}
+
+var (
+	codeElement   = regexp.MustCompile(`(?s)<code[^>]*>(.*?)</code>`)
+	preElement    = regexp.MustCompile(`(?s)<pre[^>]*>(.*?)</pre>`)
+	languageClass = regexp.MustCompile(`(?:lang(?:uage)?-)([\w+#-]+)`)
+	htmlTag       = regexp.MustCompile(`<[^>]+>`)
+)
+
+func codeBlock(b Block, ctx *ContentContext) string {
+	m := codeElement.FindStringSubmatch(b.Inner)
+	if m == nil {
+		m = preElement.FindStringSubmatch(b.Inner)
+	}
+	if m == nil {
+		return b.Inner
+	}
+	lang := b.StringAttr("language")
+	if lang == "" {
+		if cm := languageClass.FindStringSubmatch(b.StringAttr("className") + " " + b.Inner); cm != nil {
+			lang = cm[1]
+		}
+	}
+	code := htmlTag.ReplaceAllString(strings.ReplaceAll(m[1], "<br>", "\n"), "")
+	return fencedCode(html.UnescapeString(code), lang)
+}
+
+func fencedCode(code, lang string) string {
+	code = strings.Trim(strings.ReplaceAll(code, "\r\n", "\n"), "\n")
+	return "\n\n```" + strings.ToLower(lang) + "\n" + code + "\n```\n\n"
+}
+
+// mediaShortcode обрабатывает [audio] и [video]. Источник может быть задан
+// в src или в атрибуте с именем формата (mp3="...", mp4="..." и т.д.).
+func mediaShortcode(sc Shortcode, ctx *ContentContext) string {
+	src := sc.Attr("src")
+	if src == "" {
+		for _, format := range []string{"mp3", "m4a", "ogg", "oga", "wav", "flac", "mp4", "m4v", "webm", "ogv", "wmv", "flv", "mov"} {
+			if src = sc.Attr(format); src != "" {
+				break
+			}
+		}
+	}
+	if src == "" {
+		src = strings.TrimSpace(sc.Content)
+	}
+	if src == "" {
+		return ""
+	}
+	escaped := html.EscapeString(src)
+	if sc.Name == "audio" {
+		return fmt.Sprintf(`<audio controls preload="none" src="%s"><a href="%s">%s</a></audio>`, escaped, escaped, escaped)
+	}
+	attrs := ""
+	if poster := sc.Attr("poster"); poster != "" {
+		attrs += fmt.Sprintf(` poster="%s"`, html.EscapeString(poster))
+	}
+	for _, dim := range []string{"width", "height"} {
+		if v := sc.Attr(dim); v != "" {
+			attrs += fmt.Sprintf(` %s="%s"`, dim, html.EscapeString(v))
+		}
+	}
+	return fmt.Sprintf(`<video controls preload="none" src="%s"%s><a href="%s">%s</a></video>`, escaped, attrs, escaped, escaped)
+}
@@ -1,111 +1,577 @@
 package wordpress
 
 import (
-	"bytes" // Импортируем новый пакет
 	"encoding/xml"
 	"fmt"
-	"io"
-	"os"
+	"html"
+	"log"
+	"mime"
+	"path"
+	"sort"
 	"strings"
 	"time"
 
+	"tiddlywiki-converter/tags"
 	"tiddlywiki-converter/tiddlywiki"
 )
 
-// --- ВОЗВРАЩАЕМСЯ К ПРОСТЫМ СТРУКТУРАМ ---
-type WXRFile struct {
-	Channel struct {
-		Items []Item `xml:"item"`
-	} `xml:"channel"`
+// --- МОДЕЛЬ WXR (WordPress eXtended RSS) ---
+//
+// Элементы из пространства имен wp: описаны только локальным именем: encoding/xml
+// тогда принимает их из любого пространства имен, а URI у wp: меняется от версии
+// к версии формата (export/1.0/, 1.1/, 1.2/). content:encoded и excerpt:encoded
+// имеют одинаковое локальное имя, поэтому они читаются вместе и различаются по URI.
+
+const nsContent = "http://purl.org/rss/1.0/modules/content/"
+
+// Author - элемент wp:author.
+type Author struct {
+	ID          int    `xml:"author_id"`
+	Login       string `xml:"author_login"`
+	Email       string `xml:"author_email"`
+	DisplayName string `xml:"author_display_name"`
+	FirstName   string `xml:"author_first_name"`
+	LastName    string `xml:"author_last_name"`
+}
+
+// WXRCategory - элемент wp:category из справочника рубрик.
+type WXRCategory struct {
+	TermID      int    `xml:"term_id"`
+	Nicename    string `xml:"category_nicename"`
+	Parent      string `xml:"category_parent"` // nicename родительской рубрики
+	Name        string `xml:"cat_name"`
+	Description string `xml:"category_description"`
+}
+
+// WXRTag - элемент wp:tag из справочника меток.
+type WXRTag struct {
+	TermID      int    `xml:"term_id"`
+	Slug        string `xml:"tag_slug"`
+	Name        string `xml:"tag_name"`
+	Description string `xml:"tag_description"`
+}
+
+// nsText - элемент, у которого важно пространство имен (content:encoded, excerpt:encoded).
+type nsText struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
 }
 
 type Item struct {
-	Title      string     `xml:"title"`
-	PubDate    string     `xml:"pubDate"`
-	// ИЗМЕНЕНО: Ищем новый тег без префикса
-	Content    string     `xml:"content_encoded"`
-	PostID     int        `xml:"post_id"`
-	PostType   string     `xml:"post_type"`
-	Status     string     `xml:"status"`
-	Categories []Category `xml:"category"`
-	Comments   []Comment  `xml:"comment"`
+	Title         string     `xml:"title"`
+	Link          string     `xml:"link"`
+	PubDate       string     `xml:"pubDate"`
+	Creator       string     `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	GUID          string     `xml:"guid"`
+	Encoded       []nsText   `xml:"encoded"`
+	PostID        int        `xml:"post_id"`
+	PostDate      string     `xml:"post_date"`
+	PostDateGMT   string     `xml:"post_date_gmt"`
+	PostName      string     `xml:"post_name"`
+	PostType      string     `xml:"post_type"`
+	Status        string     `xml:"status"`
+	PostParent    int        `xml:"post_parent"`
+	MenuOrder     int        `xml:"menu_order"`
+	AttachmentURL string     `xml:"attachment_url"`
+	Categories    []Category `xml:"category"`
+	Comments      []Comment  `xml:"comment"`
+}
+
+// Content возвращает content:encoded - основной текст записи.
+func (it *Item) Content() string { return it.encoded(nsContent) }
+
+// Excerpt возвращает excerpt:encoded. URI этого пространства имен зависит
+// от версии WXR, поэтому ищем по характерному фрагменту.
+func (it *Item) Excerpt() string {
+	for _, e := range it.Encoded {
+		if strings.Contains(e.XMLName.Space, "/excerpt/") {
+			return e.Value
+		}
+	}
+	return ""
+}
+
+func (it *Item) encoded(space string) string {
+	for _, e := range it.Encoded {
+		if e.XMLName.Space == space {
+			return e.Value
+		}
+	}
+	return ""
 }
 
+// Category - термин, привязанный к записи (<category domain="post_tag" nicename="...">).
 type Category struct {
 	Domain   string `xml:"domain,attr"`
-	Value    string `xml:",cdata"`
+	Nicename string `xml:"nicename,attr"`
+	Value    string `xml:",chardata"`
 }
 
 type Comment struct {
-	Author  string `xml:"comment_author"`
-	DateGMT string `xml:"comment_date_gmt"`
-	Content string `xml:"comment_content"`
+	ID        int           `xml:"comment_id"`
+	Author    string        `xml:"comment_author"`
+	AuthorURL string        `xml:"comment_author_url"`
+	Date      string        `xml:"comment_date"`
+	DateGMT   string        `xml:"comment_date_gmt"`
+	Content   string        `xml:"comment_content"`
+	Approved  string        `xml:"comment_approved"` // "1", "0", "spam", "trash"
+	Type      string        `xml:"comment_type"`     // "", "comment", "pingback", "trackback"
+	Parent    int           `xml:"comment_parent"`
+	Meta      []CommentMeta `xml:"commentmeta"`
+}
+
+// CommentMeta - элемент wp:commentmeta.
+type CommentMeta struct {
+	Key   string `xml:"meta_key"`
+	Value string `xml:"meta_value"`
+}
+
+// WXROptions управляет тем, какие записи попадут в вики.
+type WXROptions struct {
+	IncludeDrafts  bool // черновики, записи на утверждении и запланированные
+	IncludePrivate bool // личные записи
+
+	// IncludeUnapprovedComments добавляет комментарии на модерации, в спаме и в корзине.
+	IncludeUnapprovedComments bool
 }
 
+// ConvertFromXMLFile импортирует экспорт WordPress с настройками по умолчанию.
 func ConvertFromXMLFile(filePath string) ([]*tiddlywiki.Tiddler, error) {
-	xmlFile, err := os.Open(filePath)
+	return ConvertFromXMLFileWithOptions(filePath, WXROptions{})
+}
+
+// ConvertFromXMLFileWithOptions разбирает экспорт WordPress и создает тиддлеры
+// для записей, страниц, вложений, авторов, рубрик и меток. filePath может указывать
+// на один файл (.xml или .xml.gz), каталог, шаблон (*.xml) или список через запятую -
+// так импортируются экспорты, разбитые на несколько файлов.
+//
+// Все тиддлеры собираются в срез - это нужно для разбиения вики на части
+// и детерминированного режима. В остальных случаях CLI пишет вики потоково
+// через StreamXMLFiles, не держа импорт в памяти.
+func ConvertFromXMLFileWithOptions(filePath string, opts WXROptions) ([]*tiddlywiki.Tiddler, error) {
+	var tiddlers []*tiddlywiki.Tiddler
+	err := StreamXMLFiles(filePath, opts, func(t *tiddlywiki.Tiddler) error {
+		tiddlers = append(tiddlers, t)
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("ошибка открытия файла %s: %w", filePath, err)
+		return nil, err
 	}
-	defer xmlFile.Close()
+	return tiddlers, nil
+}
 
-	byteValue, _ := io.ReadAll(xmlFile)
+// wxrConverter превращает элементы WXR в тиддлеры и хранит справочники,
+// нужные для разбора следующих записей. Готовые тиддлеры сразу передаются в emit.
+type wxrConverter struct {
+	opts WXROptions
+	emit func(*tiddlywiki.Tiddler) error
+	err  error // первая ошибка emit, после нее тиддлеры больше не передаются
 
-	// --- НОВЫЙ ТРЮК: УДАЛЯЕМ ПРОБЛЕМНЫЕ ПРЕФИКСЫ ---
-	// Заменяем "content:encoded" на "content_encoded", "dc:creator" на "creator" и т.д.
-	byteValue = bytes.ReplaceAll(byteValue, []byte("<content:encoded>"), []byte("<content_encoded>"))
-	byteValue = bytes.ReplaceAll(byteValue, []byte("</content:encoded>"), []byte("</content_encoded>"))
-	// Можно добавить и другие замены для wp:, dc: и т.д., если они понадобятся
-	// --- КОНЕЦ ТРЮКА ---
+	created        int
+	siteInfo       bool
+	authorNames    map[string]string             // login -> отображаемое имя
+	categoryTitles map[string]string             // nicename -> название рубрики
+	tagSlugs       map[string]bool               // метки, для которых уже создан тиддлер
+	pageTitles     map[int]string                // post_id страницы -> заголовок
+	waitingPages   map[int][]*tiddlywiki.Tiddler // post_id родителя -> страницы, ждущие его
+	skipped        map[string]int                // причина пропуска -> количество
+}
 
-	var wxr WXRFile
-	if err := xml.Unmarshal(byteValue, &wxr); err != nil {
-		return nil, fmt.Errorf("ошибка парсинга XML: %w", err)
+func newWXRConverter(opts WXROptions, emit func(*tiddlywiki.Tiddler) error) *wxrConverter {
+	return &wxrConverter{
+		opts:           opts,
+		emit:           emit,
+		authorNames:    make(map[string]string),
+		categoryTitles: make(map[string]string),
+		tagSlugs:       make(map[string]bool),
+		pageTitles:     make(map[int]string),
+		waitingPages:   make(map[int][]*tiddlywiki.Tiddler),
+		skipped:        make(map[string]int),
 	}
+}
 
-	var tiddlers []*tiddlywiki.Tiddler
+func (c *wxrConverter) add(t *tiddlywiki.Tiddler) {
+	if c.err != nil {
+		return
+	}
+	c.err = c.emit(t)
+	c.created++
+}
 
-	for _, item := range wxr.Channel.Items {
-		if item.PostType != "post" || item.Status != "publish" {
-			continue
+// addSiteInfo вызывается для каждого файла, но название сайта берется из первого:
+// в разбитом экспорте заголовок канала повторяется в каждой части.
+func (c *wxrConverter) addSiteInfo(title, description string) {
+	if c.siteInfo {
+		return
+	}
+	c.siteInfo = true
+	if title != "" {
+		c.add(tiddlywiki.NewTiddler("$:/SiteTitle", html.UnescapeString(title), ""))
+	}
+	if description != "" {
+		c.add(tiddlywiki.NewTiddler("$:/SiteSubtitle", html.UnescapeString(description), ""))
+	}
+}
+
+// addAuthor создает тиддлер автора из wp:author. Адрес почты
+// намеренно не переносится: вики часто публикуют.
+func (c *wxrConverter) addAuthor(a Author) {
+	if _, seen := c.authorNames[a.Login]; seen {
+		return
+	}
+	name := a.DisplayName
+	if name == "" {
+		name = a.Login
+	}
+	c.authorNames[a.Login] = name
+
+	var b strings.Builder
+	if full := strings.TrimSpace(a.FirstName + " " + a.LastName); full != "" {
+		b.WriteString(fmt.Sprintf("''Имя:'' %s\n\n", full))
+	}
+	b.WriteString(fmt.Sprintf("''Логин:'' %s\n\n", a.Login))
+	b.WriteString(fmt.Sprintf("<<list-links filter:\"[field:%s[%s]field:%s<currentTiddler>]\">>",
+		tiddlywiki.FieldImportType, tiddlywiki.ImportTypePost, tiddlywiki.FieldAuthor))
+
+	authorTiddler := tiddlywiki.NewTiddler(name, b.String(), "author")
+	authorTiddler.Fields[tiddlywiki.FieldImportType] = tiddlywiki.ImportTypeAuthor
+	authorTiddler.Fields["wp-login"] = a.Login
+	c.add(authorTiddler)
+}
+
+// addCategory создает тиддлер рубрики. WordPress выгружает родительские
+// рубрики раньше дочерних, поэтому родитель уже известен.
+func (c *wxrConverter) addCategory(cat WXRCategory) {
+	if _, seen := c.categoryTitles[cat.Nicename]; seen {
+		return
+	}
+	// Заголовок рубрики нормализуется так же, как теги записей, иначе тег не совпадет с тиддлером рубрики.
+	title := tags.Normalize(html.UnescapeString(cat.Name))
+	if title == "" {
+		return
+	}
+	c.categoryTitles[cat.Nicename] = title
+	c.add(newCategoryTiddler(title, c.categoryTitles[cat.Parent], cat.Nicename, html.UnescapeString(cat.Description)))
+}
+
+// addTag создает тиддлер метки из wp:tag, как addCategory для рубрик:
+// записи ссылаются на него своими тегами. Метка с тем же названием,
+// что и рубрика, отдельного тиддлера не получает.
+func (c *wxrConverter) addTag(tag WXRTag) {
+	if c.tagSlugs[tag.Slug] {
+		return
+	}
+	c.tagSlugs[tag.Slug] = true
+	title := tags.Normalize(html.UnescapeString(tag.Name))
+	if title == "" {
+		return
+	}
+	for _, categoryTitle := range c.categoryTitles {
+		if categoryTitle == title {
+			return
 		}
-		
-		postTitle := item.Title
-		postID := fmt.Sprintf("%d", item.PostID)
+	}
+	tagTiddler := newCategoryTiddler(title, "", tag.Slug, html.UnescapeString(tag.Description))
+	tagTiddler.Fields["wp-taxonomy"] = "post_tag"
+	c.add(tagTiddler)
+}
 
-		var postTags []string
-		for _, cat := range item.Categories {
-			if cat.Domain == "post_tag" {
-				postTags = append(postTags, cat.Value)
+// addItem преобразует одну запись WXR в зависимости от ее типа и статуса.
+func (c *wxrConverter) addItem(item *Item) {
+	switch item.Status {
+	case "publish", "inherit":
+	case "draft", "pending", "future", "auto-draft":
+		if !c.opts.IncludeDrafts || item.Status == "auto-draft" {
+			c.skipped["статус "+item.Status]++
+			return
+		}
+	case "private":
+		if !c.opts.IncludePrivate {
+			c.skipped["статус private"]++
+			return
+		}
+	default:
+		c.skipped["статус "+item.Status]++
+		return
+	}
+
+	switch item.PostType {
+	case "post":
+		c.addPost(item, tiddlywiki.ImportTypePost)
+	case "page":
+		c.addPost(item, tiddlywiki.ImportTypePage)
+	case "attachment":
+		c.addAttachment(item)
+	default:
+		c.skipped["тип "+item.PostType]++
+	}
+}
+
+func (c *wxrConverter) addPost(item *Item, importType string) {
+	postTitle := html.UnescapeString(item.Title)
+	if postTitle == "" {
+		postTitle = fmt.Sprintf("Без названия (%d)", item.PostID)
+	}
+	postID := fmt.Sprintf("%d", item.PostID)
+
+	var postTags []string
+	for _, cat := range item.Categories {
+		if cat.Domain == "post_tag" || cat.Domain == "category" {
+			postTags = append(postTags, html.UnescapeString(cat.Value))
+		}
+	}
+	postTags = tags.NormalizeList(postTags)
+	if item.Status == "private" {
+		postTags = append(postTags, "private")
+	} else if item.Status != "publish" {
+		postTags = append(postTags, "draft")
+		// Черновики, записи на утверждении и запланированные не попадают в навигацию.
+		if importType == tiddlywiki.ImportTypePost {
+			importType = tiddlywiki.ImportTypeDraft
+		}
+	}
+
+	tiddlyTime := itemTime(item).UTC().Format(tiddlywiki.TiddlyTimeFormat)
+	postTiddler := tiddlywiki.NewTiddler(postTitle, ProcessContent(item.Content(), &ContentContext{PostID: item.PostID}), tiddlywiki.StringifyList(postTags))
+	postTiddler.Created = tiddlyTime
+	postTiddler.Modified = tiddlyTime
+	postTiddler.Fields["post-id"] = postID
+	postTiddler.Fields["post-slug"] = item.PostName
+	postTiddler.Fields["wp-status"] = item.Status
+	postTiddler.Fields[tiddlywiki.FieldImportType] = importType
+	postTiddler.Fields[tiddlywiki.FieldSourceURL] = item.Link
+	if author := c.authorName(item.Creator); author != "" {
+		postTiddler.Fields[tiddlywiki.FieldAuthor] = author
+	}
+	if excerpt := strings.TrimSpace(item.Excerpt()); excerpt != "" {
+		postTiddler.Fields["excerpt"] = excerpt
+	}
+	if importType == tiddlywiki.ImportTypePage {
+		c.addPage(item, postTiddler)
+	} else {
+		c.add(postTiddler)
+	}
+
+	c.addComments(item, postTitle, postID)
+}
+
+// addPage добавляет страницу в иерархию: она помечается тегом родительской
+// страницы. Если родитель в экспорте идет позже, страница ждет его в waitingPages,
+// а дети, ждавшие эту страницу, передаются в emit.
+func (c *wxrConverter) addPage(item *Item, page *tiddlywiki.Tiddler) {
+	c.pageTitles[item.PostID] = page.Title
+	switch parent, ok := c.pageTitles[item.PostParent]; {
+	case item.PostParent == 0:
+		setPageParent(page, "")
+		c.add(page)
+	case ok:
+		setPageParent(page, parent)
+		c.add(page)
+	default:
+		c.waitingPages[item.PostParent] = append(c.waitingPages[item.PostParent], page)
+	}
+	for _, child := range c.waitingPages[item.PostID] {
+		setPageParent(child, page.Title)
+		c.add(child)
+	}
+	delete(c.waitingPages, item.PostID)
+}
+
+// flushPages передает страницы, родитель которых так и не встретился в экспорте.
+func (c *wxrConverter) flushPages() {
+	ids := make([]int, 0, len(c.waitingPages))
+	for id := range c.waitingPages {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		for _, page := range c.waitingPages[id] {
+			log.Printf("WXR: родительская страница %d для «%s» не найдена в экспорте", id, page.Title)
+			page.Fields["wp-post-parent"] = fmt.Sprintf("%d", id)
+			setPageParent(page, "")
+			c.add(page)
+		}
+	}
+	c.waitingPages = make(map[int][]*tiddlywiki.Tiddler)
+}
+
+// setPageParent помечает страницу тегом родителя, страницу верхнего уровня - тегом "page".
+func setPageParent(page *tiddlywiki.Tiddler, parentTitle string) {
+	tag := "page"
+	if parentTitle != "" {
+		tag = parentTitle
+		page.Fields["page-parent"] = parentTitle
+	}
+	page.Tags = tiddlywiki.StringifyList(append(tiddlywiki.ParseList(page.Tags), tag))
+}
+
+// addComments создает дерево комментариев записи так же, как REST-импорт:
+// заголовок "<пост>-comment-<id>", родитель - пост или другой комментарий.
+// Если родительский комментарий пропущен (спам, модерация), ответ
+// привязывается к ближайшему сохраненному предку.
+func (c *wxrConverter) addComments(item *Item, postTitle, postID string) {
+	parents := make(map[int]int, len(item.Comments))
+	kept := make(map[int]bool, len(item.Comments))
+	for _, comment := range item.Comments {
+		parents[comment.ID] = comment.Parent
+		if comment.Approved == "1" || c.opts.IncludeUnapprovedComments {
+			kept[comment.ID] = true
+		} else {
+			c.skipped["комментарий "+commentStatus(comment.Approved)]++
+		}
+	}
+
+	for _, comment := range item.Comments {
+		if !kept[comment.ID] {
+			continue
+		}
+		parentTitle := postTitle
+		// Ограничение числа шагов защищает от циклов в поврежденном экспорте.
+		for parentID, steps := comment.Parent, 0; parentID != 0 && steps < len(parents); parentID, steps = parents[parentID], steps+1 {
+			if kept[parentID] {
+				parentTitle = fmt.Sprintf("%s-comment-%d", postTitle, parentID)
+				break
 			}
 		}
-		tagsString := strings.Join(postTags, " ")
 
-		created, _ := time.Parse(time.RFC1123Z, item.PubDate)
-		tiddlyTime := created.UTC().Format(tiddlywiki.TiddlyTimeFormat)
+		created, err := time.Parse("2006-01-02 15:04:05", comment.DateGMT)
+		if err != nil || created.Year() <= 1 {
+			created, _ = time.Parse("2006-01-02 15:04:05", comment.Date)
+		}
+		sourceURL := ""
+		if item.Link != "" {
+			sourceURL = fmt.Sprintf("%s#comment-%d", item.Link, comment.ID)
+		}
 
-		postTiddler := tiddlywiki.NewTiddler(postTitle, item.Content, tagsString)
-		postTiddler.Created = tiddlyTime
-		postTiddler.Modified = tiddlyTime
-		postTiddler.Fields["post-id"] = postID
-		tiddlers = append(tiddlers, postTiddler)
+		commentTiddler := newCommentTiddler(
+			fmt.Sprintf("%s-comment-%d", postTitle, comment.ID),
+			parentTitle, postTitle, comment.Author, created, sourceURL, comment.Content,
+		)
+		commentTiddler.Fields["parent-post"] = postID
+		commentTiddler.Fields["comment-id"] = fmt.Sprintf("%d", comment.ID)
+		if comment.AuthorURL != "" {
+			commentTiddler.Fields["comment-author-url"] = comment.AuthorURL
+		}
+		if comment.Type == "pingback" || comment.Type == "trackback" {
+			commentTiddler.Fields["comment-type"] = comment.Type
+		}
+		if comment.Approved != "1" {
+			commentTiddler.Fields["wp-comment-status"] = commentStatus(comment.Approved)
+		}
+		for _, meta := range comment.Meta {
+			// Служебные ключи (_wp_trash_meta_status и т.п.) и технические данные Akismet не нужны.
+			if strings.HasPrefix(meta.Key, "_") || strings.HasPrefix(meta.Key, "akismet") {
+				continue
+			}
+			if name := metaFieldName(meta.Key); name != "" {
+				commentTiddler.Fields["comment-meta-"+name] = meta.Value
+			}
+		}
+		c.add(commentTiddler)
+	}
+}
 
-		for _, comment := range item.Comments {
-			author := comment.Author
-			commentText := fmt.Sprintf("<blockquote>%s</blockquote>\n\n''- %s''", comment.Content, author)
-			createdComm, _ := time.Parse("2006-01-02 15:04:05", comment.DateGMT)
-			tiddlyCommTime := createdComm.UTC().Format(tiddlywiki.TiddlyTimeFormat)
+func commentStatus(approved string) string {
+	switch approved {
+	case "1":
+		return "approved"
+	case "0", "":
+		return "pending"
+	}
+	return approved
+}
 
-			commentTiddler := tiddlywiki.NewTiddler(
-				fmt.Sprintf("Комментарий от %s к посту «%s»", author, postTitle),
-				commentText, "comment",
-			)
-			commentTiddler.Created = tiddlyCommTime
-			commentTiddler.Modified = tiddlyCommTime
-			commentTiddler.Fields["parent-post"] = postID
-			tiddlers = append(tiddlers, commentTiddler)
+// metaFieldName приводит ключ метаданных к допустимому имени поля TiddlyWiki:
+// строчные латинские буквы, цифры, "-", "_" и ".".
+func metaFieldName(key string) string {
+	return strings.Trim(strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '.':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
 		}
+		return '-'
+	}, key), "-")
+}
+
+// addAttachment создает тиддлер-ссылку на файл из медиатеки: сам файл
+// не скачивается, TiddlyWiki загрузит его по _canonical_uri.
+func (c *wxrConverter) addAttachment(item *Item) {
+	if item.AttachmentURL == "" {
+		c.skipped["вложение без URL"]++
+		return
 	}
+	attachment := newAttachmentTiddler(html.UnescapeString(item.Title), item.AttachmentURL, "", item.PostID, item.PostParent, itemTime(item))
+	if caption := strings.TrimSpace(item.Excerpt()); caption != "" {
+		attachment.Fields["caption"] = caption
+	}
+	c.add(attachment)
+}
 
-	return tiddlers, nil
-}
\ No newline at end of file
+// newAttachmentTiddler создает тиддлер файла медиатеки. Общий для WXR и REST:
+// галереи находят вложения по полям post-id и wp-post-parent.
+// Если mimeType не известен, он определяется по расширению файла.
+func newAttachmentTiddler(title, fileURL, mimeType string, id, parentID int, created time.Time) *tiddlywiki.Tiddler {
+	if title == "" {
+		title = path.Base(fileURL)
+	}
+	tiddlyTime := created.UTC().Format(tiddlywiki.TiddlyTimeFormat)
+	attachment := tiddlywiki.NewTiddler(title, "", "attachment")
+	attachment.Created = tiddlyTime
+	attachment.Modified = tiddlyTime
+	attachment.Fields["_canonical_uri"] = fileURL
+	attachment.Fields["post-id"] = fmt.Sprintf("%d", id)
+	attachment.Fields[tiddlywiki.FieldImportType] = tiddlywiki.ImportTypeAttachment
+	if mimeType == "" {
+		mimeType = mime.TypeByExtension(path.Ext(fileURL))
+	}
+	if mimeType != "" {
+		attachment.Fields["type"] = strings.SplitN(mimeType, ";", 2)[0]
+	}
+	if parentID != 0 {
+		attachment.Fields["wp-post-parent"] = fmt.Sprintf("%d", parentID)
+	}
+	return attachment
+}
+
+// newCategoryTiddler создает тиддлер рубрики. Вложенность рубрик передается
+// тегами: дочерняя рубрика помечена тегом родительской (теги тегов).
+func newCategoryTiddler(title, parentTitle, slug, description string) *tiddlywiki.Tiddler {
+	var tags []string
+	if parentTitle != "" {
+		tags = append(tags, parentTitle)
+	}
+	catTiddler := tiddlywiki.NewTiddler(title, description, tiddlywiki.StringifyList(tags))
+	catTiddler.Fields["wp-taxonomy"] = "category"
+	catTiddler.Fields["wp-slug"] = slug
+	return catTiddler
+}
+
+func (c *wxrConverter) authorName(login string) string {
+	if name, ok := c.authorNames[login]; ok {
+		return name
+	}
+	return login
+}
+
+func (c *wxrConverter) logSummary() {
+	log.Printf("WXR: создано тиддлеров: %d.", c.created)
+	for reason, n := range c.skipped {
+		log.Printf("   пропущено (%s): %d", reason, n)
+	}
+}
+
+// itemTime возвращает дату публикации записи. У черновиков post_date_gmt
+// равна "0000-00-00 00:00:00", тогда берется локальная post_date или pubDate.
+func itemTime(item *Item) time.Time {
+	const layout = "2006-01-02 15:04:05"
+	if t, err := time.Parse(layout, item.PostDateGMT); err == nil && t.Year() > 1 {
+		return t
+	}
+	if t, err := time.Parse(layout, item.PostDate); err == nil && t.Year() > 1 {
+		return t
+	}
+	t, _ := time.Parse(time.RFC1123Z, item.PubDate)
+	return t
+}
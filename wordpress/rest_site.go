@@ -0,0 +1,307 @@
+package wordpress
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"tiddlywiki-converter/tags"
+	"tiddlywiki-converter/tiddlywiki"
+)
+
+// --- ОСТАЛЬНАЯ ЧАСТЬ САЙТА ЧЕРЕЗ REST (самохостинг) ---
+// Кроме записей блога импортируются рубрики, страницы, записи произвольных
+// типов (товары, портфолио и т.п.) и медиатека.
+
+type SelfHostedTerm struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Slug     string `json:"slug"`
+	Taxonomy string `json:"taxonomy"`
+}
+
+type SelfHostedCategory struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Slug        string `json:"slug"`
+	Parent      int    `json:"parent"`
+	Description string `json:"description"`
+}
+
+// SelfHostedPage - страница или запись произвольного типа. У иерархических
+// типов заполнено поле parent.
+type SelfHostedPage struct {
+	ID        int                     `json:"id"`
+	Date      string                  `json:"date_gmt"`
+	Type      string                  `json:"type"`
+	Parent    int                     `json:"parent"`
+	MenuOrder int                     `json:"menu_order"`
+	Title     SelfHostedRenderedField `json:"title"`
+	Content   SelfHostedRenderedField `json:"content"`
+	Slug      string                  `json:"slug"`
+	Link      string                  `json:"link"`
+	Status    string                  `json:"status"`
+	Embedded  SelfHostedEmbeddedData  `json:"_embedded"`
+}
+
+type SelfHostedMedia struct {
+	ID        int                     `json:"id"`
+	Date      string                  `json:"date_gmt"`
+	Title     SelfHostedRenderedField `json:"title"`
+	Caption   SelfHostedRenderedField `json:"caption"`
+	AltText   string                  `json:"alt_text"`
+	MimeType  string                  `json:"mime_type"`
+	SourceURL string                  `json:"source_url"`
+	Post      int                     `json:"post"`
+}
+
+type SelfHostedPostType struct {
+	Slug     string `json:"slug"`
+	Name     string `json:"name"`
+	RestBase string `json:"rest_base"`
+}
+
+// fetchAllPages загружает все страницы коллекции REST API. Первая страница
+// запрашивается отдельно: из ее заголовка X-WP-TotalPages становится известно
+// число страниц, и остальные загружаются параллельно. Если заголовка нет,
+// страницы читаются по очереди до пустого ответа.
+func fetchAllPages[T any](client *apiClient, collectionURL, what string) ([]T, error) {
+	sep := "?"
+	if strings.Contains(collectionURL, "?") {
+		sep = "&"
+	}
+	pageURL := func(page int) string {
+		return fmt.Sprintf("%s%spage=%d&per_page=100", collectionURL, sep, page)
+	}
+
+	log.Printf("Запрос к API (%s): %s", what, pageURL(1))
+	var all []T
+	header, err := client.fetchJSON(pageURL(1), &all)
+	if err != nil {
+		return nil, err
+	}
+	total, err := strconv.Atoi(header.Get("X-WP-TotalPages"))
+	if err != nil {
+		return fetchPagesSequentially(client, pageURL, what, all)
+	}
+	log.Printf("Загружено %s: %d (страница 1 из %d).", what, len(all), total)
+	if total <= 1 {
+		return all, nil
+	}
+
+	pages := make([][]T, total-1)
+	errs := make([]error, total-1)
+	forEachConcurrently(total-1, restWorkers, func(i int) {
+		_, errs[i] = client.fetchJSON(pageURL(i+2), &pages[i])
+		if errs[i] == nil {
+			log.Printf("Загружено %s: %d (страница %d из %d).", what, len(pages[i]), i+2, total)
+		}
+	})
+	for i, page := range pages {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("%s, страница %d: %w", what, i+2, errs[i])
+		}
+		all = append(all, page...)
+	}
+	return all, nil
+}
+
+// fetchPagesSequentially - запасной путь для серверов, которые не сообщают
+// число страниц (например, из-за прокси, вырезающего заголовки).
+func fetchPagesSequentially[T any](client *apiClient, pageURL func(int) string, what string, first []T) ([]T, error) {
+	all := first
+	if len(first) == 0 {
+		return all, nil
+	}
+	for page := 2; ; page++ {
+		log.Printf("Запрос к API (%s): %s", what, pageURL(page))
+		var items []T
+		if _, err := client.fetchJSON(pageURL(page), &items); err != nil {
+			if isLastPage(err, page) {
+				break
+			}
+			return nil, err
+		}
+		if len(items) == 0 {
+			break
+		}
+		all = append(all, items...)
+		log.Printf("Загружено %s: %d (страница %d).", what, len(items), page)
+	}
+	return all, nil
+}
+
+// fetchSelfHostedCategories загружает рубрики и создает их тиддлеры.
+// API отдает рубрики по алфавиту, поэтому заголовки всех рубрик
+// собираются до того, как назначаются родители.
+func fetchSelfHostedCategories(client *apiClient, host string) ([]*tiddlywiki.Tiddler, error) {
+	categories, err := fetchAllPages[SelfHostedCategory](client, fmt.Sprintf("https://%s/wp-json/wp/v2/categories", host), "рубрики")
+	if err != nil {
+		return nil, err
+	}
+	titles := make(map[int]string, len(categories))
+	for _, cat := range categories {
+		titles[cat.ID] = tags.Normalize(html.UnescapeString(cat.Name))
+	}
+	var tiddlers []*tiddlywiki.Tiddler
+	for _, cat := range categories {
+		if titles[cat.ID] == "" {
+			continue
+		}
+		tiddlers = append(tiddlers, newCategoryTiddler(titles[cat.ID], titles[cat.Parent], cat.Slug, html.UnescapeString(cat.Description)))
+	}
+	return tiddlers, nil
+}
+
+// restTitle возвращает заголовок тиддлера для любой записи REST API: поста,
+// страницы или записи произвольного типа. Пробелы заменяются на "_", как
+// в заголовках постов с первых версий конвертера, чтобы весь сайт получал
+// заголовки по одному правилу.
+func restTitle(rendered string, id int) string {
+	title := strings.ReplaceAll(html.UnescapeString(rendered), " ", "_")
+	if title == "" {
+		title = fmt.Sprintf("Без_названия_(%d)", id)
+	}
+	return title
+}
+
+// fetchSelfHostedPages загружает страницы (collection = "pages") или записи
+// произвольного типа и строит из них тиддлеры с иерархией: дочерняя страница
+// помечена тегом родительской и полем page-parent.
+func fetchSelfHostedPages(client *apiClient, host, collection, importType string) ([]*tiddlywiki.Tiddler, error) {
+	collectionURL := fmt.Sprintf("https://%s/wp-json/wp/v2/%s?_embed=author%s", host, collection, editQuery(client, "any"))
+	pages, err := fetchAllPages[SelfHostedPage](client, collectionURL, collection)
+	if err != nil {
+		return nil, err
+	}
+	titles := make(map[int]string, len(pages))
+	for _, page := range pages {
+		titles[page.ID] = restTitle(page.Title.Rendered, page.ID)
+	}
+
+	var tiddlers []*tiddlywiki.Tiddler
+	for _, page := range pages {
+		tags := []string{importType}
+		if parent, ok := titles[page.Parent]; ok {
+			tags = []string{parent}
+		}
+		created, _ := time.Parse("2006-01-02T15:04:05", page.Date)
+		tiddlyTime := created.UTC().Format(tiddlywiki.TiddlyTimeFormat)
+
+		pageTiddler := tiddlywiki.NewTiddler(titles[page.ID],
+			ProcessContent(page.Content.Rendered, &ContentContext{PostID: page.ID}),
+			tiddlywiki.StringifyList(tags))
+		pageTiddler.Created = tiddlyTime
+		pageTiddler.Modified = tiddlyTime
+		pageTiddler.Fields[tiddlywiki.FieldImportType] = importType
+		pageTiddler.Fields[tiddlywiki.FieldSourceURL] = page.Link
+		pageTiddler.Fields["post-id"] = strconv.Itoa(page.ID)
+		pageTiddler.Fields["post-slug"] = page.Slug
+		if page.Parent != 0 {
+			pageTiddler.Fields["page-parent"] = titles[page.Parent]
+		}
+		if page.MenuOrder != 0 {
+			pageTiddler.Fields["wp-menu-order"] = strconv.Itoa(page.MenuOrder)
+		}
+		if len(page.Embedded.Author) > 0 {
+			pageTiddler.Fields[tiddlywiki.FieldAuthor] = html.UnescapeString(page.Embedded.Author[0].Name)
+		}
+		applyPostStatus(pageTiddler, page.Status)
+		tiddlers = append(tiddlers, pageTiddler)
+	}
+	return tiddlers, nil
+}
+
+// fetchSelfHostedCustomTypes импортирует записи перечисленных типов. Адрес
+// коллекции (rest_base) может не совпадать с именем типа, поэтому он берется
+// из /wp/v2/types. Тип становится значением поля import-type и тегом,
+// так что такие записи не смешиваются с постами блога в навигации.
+func fetchSelfHostedCustomTypes(client *apiClient, host string, postTypes []string) ([]*tiddlywiki.Tiddler, error) {
+	if len(postTypes) == 0 {
+		return nil, nil
+	}
+	var types map[string]SelfHostedPostType
+	if _, err := client.fetchJSON(fmt.Sprintf("https://%s/wp-json/wp/v2/types", host), &types); err != nil {
+		return nil, fmt.Errorf("не удалось получить список типов записей: %w", err)
+	}
+	var tiddlers []*tiddlywiki.Tiddler
+	for _, slug := range postTypes {
+		postType, ok := types[slug]
+		if !ok || postType.RestBase == "" {
+			log.Printf("Предупреждение: тип записей '%s' не найден или недоступен через REST API.", slug)
+			continue
+		}
+		typeTiddlers, err := fetchSelfHostedPages(client, host, postType.RestBase, slug)
+		if err != nil {
+			return nil, fmt.Errorf("тип записей '%s': %w", slug, err)
+		}
+		tiddlers = append(tiddlers, typeTiddlers...)
+	}
+	return tiddlers, nil
+}
+
+// fetchSelfHostedMedia загружает медиатеку. Файлы не скачиваются:
+// тиддлеры ссылаются на них через _canonical_uri.
+func fetchSelfHostedMedia(client *apiClient, host string) ([]*tiddlywiki.Tiddler, error) {
+	media, err := fetchAllPages[SelfHostedMedia](client, fmt.Sprintf("https://%s/wp-json/wp/v2/media", host), "медиафайлы")
+	if err != nil {
+		return nil, err
+	}
+	var tiddlers []*tiddlywiki.Tiddler
+	for _, m := range media {
+		if m.SourceURL == "" {
+			continue
+		}
+		created, _ := time.Parse("2006-01-02T15:04:05", m.Date)
+		title := "" // без заголовка newAttachmentTiddler возьмет имя файла
+		if m.Title.Rendered != "" {
+			title = restTitle(m.Title.Rendered, m.ID)
+		}
+		attachment := newAttachmentTiddler(title, m.SourceURL, m.MimeType, m.ID, m.Post, created)
+		if caption := strings.TrimSpace(stripHTML(m.Caption.Rendered)); caption != "" {
+			attachment.Fields["caption"] = html.UnescapeString(caption)
+		}
+		if m.AltText != "" {
+			attachment.Fields["alt"] = m.AltText
+		}
+		tiddlers = append(tiddlers, attachment)
+	}
+	return tiddlers, nil
+}
+
+// termFields раскладывает термины записи по таксономиям: теги TiddlyWiki
+// получают и рубрики, и метки, а поля wp-categories и wp-tags сохраняют различие.
+func termFields(t *tiddlywiki.Tiddler, terms [][]SelfHostedTerm) {
+	var categories, postTags []string
+	for _, termList := range terms {
+		for _, term := range termList {
+			name := html.UnescapeString(term.Name)
+			switch term.Taxonomy {
+			case "category":
+				categories = append(categories, name)
+			case "post_tag":
+				postTags = append(postTags, name)
+			}
+		}
+	}
+	if categories = tags.NormalizeList(categories); len(categories) > 0 {
+		t.Fields["wp-categories"] = tiddlywiki.StringifyList(categories)
+	}
+	if postTags = tags.NormalizeList(postTags); len(postTags) > 0 {
+		t.Fields["wp-tags"] = tiddlywiki.StringifyList(postTags)
+	}
+}
+
+// ParsePostTypes разбирает список типов записей через запятую.
+func ParsePostTypes(s string) []string {
+	var types []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			types = append(types, part)
+		}
+	}
+	return types
+}
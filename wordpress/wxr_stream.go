@@ -0,0 +1,195 @@
+package wordpress
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"tiddlywiki-converter/tiddlywiki"
+)
+
+// StreamXMLFiles читает экспорт WordPress потоково: документ разбирается по токенам,
+// в памяти одновременно находится только одна запись <item>, а каждый готовый
+// тиддлер сразу передается в emit. Так обрабатываются экспорты размером в гигабайты,
+// если emit не накапливает тиддлеры, а сразу пишет их (tiddlywiki.HTMLWriter).
+// Ошибка, возвращенная emit, прерывает импорт.
+//
+// pathSpec - файл (.xml или .xml.gz), каталог, шаблон вида "export-*.xml"
+// или несколько таких значений через запятую. Файлы читаются по алфавиту,
+// справочники авторов и рубрик общие для всех частей.
+func StreamXMLFiles(pathSpec string, opts WXROptions, emit func(*tiddlywiki.Tiddler) error) error {
+	files, err := expandXMLPaths(pathSpec)
+	if err != nil {
+		return err
+	}
+	conv := newWXRConverter(opts, emit)
+	for i, file := range files {
+		log.Printf("WXR: чтение файла %d из %d: %s", i+1, len(files), file)
+		if err := conv.streamFile(file); err != nil {
+			return err
+		}
+	}
+	conv.flushPages()
+	if conv.err != nil {
+		return conv.err
+	}
+	conv.logSummary()
+	return nil
+}
+
+// expandXMLPaths превращает значение xml_path в упорядоченный список файлов.
+func expandXMLPaths(pathSpec string) ([]string, error) {
+	var files []string
+	for _, part := range strings.Split(pathSpec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if strings.ContainsAny(part, "*?[") {
+			matches, err := filepath.Glob(part)
+			if err != nil {
+				return nil, fmt.Errorf("некорректный шаблон пути %q: %w", part, err)
+			}
+			sort.Strings(matches)
+			files = append(files, matches...)
+			continue
+		}
+		info, err := os.Stat(part)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка открытия файла %s: %w", part, err)
+		}
+		if !info.IsDir() {
+			files = append(files, part)
+			continue
+		}
+		entries, err := os.ReadDir(part)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения каталога %s: %w", part, err)
+		}
+		for _, e := range entries {
+			name := strings.ToLower(e.Name())
+			if !e.IsDir() && (strings.HasSuffix(name, ".xml") || strings.HasSuffix(name, ".xml.gz")) {
+				files = append(files, filepath.Join(part, e.Name()))
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("по пути %q не найдено ни одного файла экспорта WordPress", pathSpec)
+	}
+	return files, nil
+}
+
+// streamFile открывает файл и при необходимости распаковывает gzip.
+// Сжатие определяется по сигнатуре, а не по расширению.
+func (c *wxrConverter) streamFile(filePath string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("ошибка открытия файла %s: %w", filePath, err)
+	}
+	defer f.Close()
+
+	br := bufio.NewReaderSize(f, 1<<20)
+	var r io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("ошибка распаковки %s: %w", filePath, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	if err := c.stream(r); err != nil {
+		return fmt.Errorf("%s: %w", filePath, err)
+	}
+	return nil
+}
+
+// stream проходит по токенам документа. Прямые потомки <channel> (записи,
+// авторы, рубрики, название сайта) декодируются целиком по одному,
+// все остальное только отслеживается по глубине вложенности.
+func (c *wxrConverter) stream(r io.Reader) error {
+	dec := xml.NewDecoder(r)
+	var stack []string
+	var title, description string
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("ошибка парсинга XML: %w", err)
+		}
+
+		switch el := tok.(type) {
+		case xml.StartElement:
+			if len(stack) == 2 && stack[1] == "channel" {
+				handled, err := c.channelChild(dec, &el, &title, &description)
+				if err != nil {
+					return err
+				}
+				if handled {
+					continue
+				}
+			}
+			stack = append(stack, el.Name.Local)
+		case xml.EndElement:
+			if len(stack) == 0 {
+				continue
+			}
+			if stack[len(stack)-1] == "channel" {
+				c.addSiteInfo(title, description)
+			}
+			stack = stack[:len(stack)-1]
+		}
+		if c.err != nil {
+			return c.err
+		}
+	}
+	return c.err
+}
+
+// channelChild декодирует один прямой потомок <channel>. Возвращает false,
+// если элемент не интересен и его нужно просто пропустить.
+func (c *wxrConverter) channelChild(dec *xml.Decoder, el *xml.StartElement, title, description *string) (bool, error) {
+	var target interface{}
+	switch el.Name.Local {
+	case "title":
+		target = title
+	case "description":
+		target = description
+	case "author":
+		target = &Author{}
+	case "category":
+		target = &WXRCategory{}
+	case "tag":
+		target = &WXRTag{}
+	case "item":
+		// Название сайта идет в начале канала, к первой записи оно уже прочитано.
+		c.addSiteInfo(*title, *description)
+		target = &Item{}
+	default:
+		return false, nil
+	}
+	if err := dec.DecodeElement(target, el); err != nil {
+		return false, fmt.Errorf("ошибка парсинга элемента <%s>: %w", el.Name.Local, err)
+	}
+	switch v := target.(type) {
+	case *Author:
+		c.addAuthor(*v)
+	case *WXRCategory:
+		c.addCategory(*v)
+	case *WXRTag:
+		c.addTag(*v)
+	case *Item:
+		c.addItem(v)
+	}
+	return true, nil
+}